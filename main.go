@@ -1,27 +1,73 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 
 	"github.com/JimmaaBinyamin/drone-gemini-cli-plugin/plugin"
-	"github.com/kelseyhightower/envconfig"
 )
 
+// exitCodeCancelled is the exit code of a run cancelled by SIGTERM or SIGINT (128 + SIGTERM)
+const exitCodeCancelled = 143
+
 func main() {
+	// Subcommands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "report":
+			if err := plugin.RunLedgerReport(os.Args[2:], os.Stdout); err != nil && !errors.Is(err, flag.ErrHelp) {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		case plugin.SandboxCommand:
+			// Only returns when the sandboxed command could not be started
+			err := plugin.RunSandbox(os.Args[2:])
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(126)
+		case "config":
+			if err := plugin.RunConfigCommand(os.Args[2:], os.Stdout); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			return
+		}
+	}
+
 	fmt.Println("=== Drone Gemini CLI Plugin ===")
 	fmt.Println()
 
-	var cfg plugin.Config
-	if err := envconfig.Process("plugin", &cfg); err != nil {
-		fmt.Fprintf(os.Stderr, "Error: failed to parse configuration: %v\n", err)
+	cfg, sources, err := plugin.LoadConfig()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
+	if keys := sources.FromFile(); len(keys) > 0 {
+		fmt.Printf("Loaded %d settings from %s: %s\n", len(keys), cfg.ConfigFile, strings.Join(keys, ", "))
+	}
+
+	// Drone sends SIGTERM when the build is cancelled
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		// A second signal terminates immediately
+		stop()
+	}()
 
 	p := plugin.New(cfg)
 
-	if err := p.Exec(); err != nil {
+	if err := p.Exec(ctx); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		if errors.Is(err, plugin.ErrCancelled) {
+			os.Exit(exitCodeCancelled)
+		}
 		os.Exit(1)
 	}
 
@@ -0,0 +1,222 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// bytesPerToken is a conservative estimate of how many bytes of source code or
+// prose make up one Gemini token
+const bytesPerToken = 4
+
+// Budget actions applied when a run goes over budget after execution
+const (
+	BudgetActionFail = "fail"
+	BudgetActionWarn = "warn"
+)
+
+// Budget limits the tokens and cost of a single run and of all runs in the
+// same pipeline. Zero values disable a limit.
+type Budget struct {
+	MaxCostUSD         float64
+	MaxTokens          int
+	PipelineMaxCostUSD float64
+	PipelineMaxTokens  int
+	Action             string // fail or warn
+
+	// Spent is the usage of earlier steps in the same pipeline
+	Spent BudgetUsage
+}
+
+// BudgetEstimate is the pre-execution estimate of a run's input
+type BudgetEstimate struct {
+	InputTokens int
+	CostUSD     float64
+	CostKnown   bool
+}
+
+// BudgetUsage is the actual usage reported by the CLI
+type BudgetUsage struct {
+	Tokens      int     `json:"tokens"`
+	CostUSD     float64 `json:"cost_usd"`
+	UnknownCost bool    `json:"unknown_cost,omitempty"` // some models had no pricing
+}
+
+// PipelineUsage is the usage of all plugin steps of one build, shared between
+// steps through a file in the workspace
+type PipelineUsage struct {
+	Build string `json:"build"`
+	Runs  int    `json:"runs"`
+	BudgetUsage
+}
+
+// NewBudget creates a budget from configuration
+func NewBudget(cfg *Config) Budget {
+	return Budget{
+		MaxCostUSD:         cfg.MaxCostUSD,
+		MaxTokens:          cfg.MaxTokens,
+		PipelineMaxCostUSD: cfg.PipelineMaxCostUSD,
+		PipelineMaxTokens:  cfg.PipelineMaxTokens,
+		Action:             cfg.BudgetAction,
+	}
+}
+
+// Enabled reports whether any limit is set
+func (b Budget) Enabled() bool {
+	return b.MaxCostUSD > 0 || b.MaxTokens > 0 || b.PipelineEnabled()
+}
+
+// PipelineEnabled reports whether a pipeline-wide limit is set
+func (b Budget) PipelineEnabled() bool {
+	return b.PipelineMaxCostUSD > 0 || b.PipelineMaxTokens > 0
+}
+
+// LoadPipelineUsage reads the usage of earlier steps of build. A missing file or
+// a file left over from another build counts as no usage.
+func LoadPipelineUsage(path, build string) PipelineUsage {
+	usage := PipelineUsage{Build: build}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return usage
+	}
+
+	var stored PipelineUsage
+	if err := json.Unmarshal(data, &stored); err != nil || stored.Build != build {
+		return usage
+	}
+	return stored
+}
+
+// SavePipelineUsage adds a run's usage to the pipeline total
+func SavePipelineUsage(path string, usage PipelineUsage, run BudgetUsage) error {
+	usage.Runs++
+	usage.Tokens += run.Tokens
+	usage.CostUSD += run.CostUSD
+	usage.UnknownCost = usage.UnknownCost || run.UnknownCost
+
+	data, err := json.MarshalIndent(usage, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// EstimateInputTokens estimates the input tokens of a prompt and its stdin context
+func EstimateInputTokens(prompt, stdinInput string) int {
+	size := len(prompt) + len(stdinInput)
+	return (size + bytesPerToken - 1) / bytesPerToken
+}
+
+// CheckEstimate estimates the input of a run and refuses it when the input alone
+// would already exceed the budget. Output tokens are unknown before execution,
+// so the estimate is a lower bound.
+func (b Budget) CheckEstimate(model, prompt, stdinInput string) (BudgetEstimate, error) {
+	est := BudgetEstimate{InputTokens: EstimateInputTokens(prompt, stdinInput)}
+	est.CostUSD, est.CostKnown = calculateModelCost(model, ModelStats{Tokens: TokenStats{Prompt: est.InputTokens}})
+
+	var problems []string
+	if b.MaxTokens > 0 && est.InputTokens > b.MaxTokens {
+		problems = append(problems, fmt.Sprintf(
+			"estimated input of %d tokens (%d bytes of prompt and context) exceeds max_tokens %d",
+			est.InputTokens, len(prompt)+len(stdinInput), b.MaxTokens))
+	}
+	if !est.CostKnown && (b.MaxCostUSD > 0 || b.PipelineMaxCostUSD > 0) {
+		problems = append(problems, fmt.Sprintf(
+			"cannot enforce the cost budget: no pricing for model %s (add it to a pricing_file)", model))
+	}
+	if b.MaxCostUSD > 0 && est.CostUSD > b.MaxCostUSD {
+		problems = append(problems, fmt.Sprintf(
+			"estimated input cost $%.4f for %s exceeds max_cost_usd $%.4f",
+			est.CostUSD, model, b.MaxCostUSD))
+	}
+	if b.PipelineMaxTokens > 0 && b.Spent.Tokens+est.InputTokens > b.PipelineMaxTokens {
+		problems = append(problems, fmt.Sprintf(
+			"pipeline already used %d tokens, estimated input of %d tokens would exceed pipeline_max_tokens %d",
+			b.Spent.Tokens, est.InputTokens, b.PipelineMaxTokens))
+	}
+	if b.PipelineMaxCostUSD > 0 && b.Spent.CostUSD+est.CostUSD > b.PipelineMaxCostUSD {
+		problems = append(problems, fmt.Sprintf(
+			"pipeline already spent $%.4f, estimated input cost $%.4f would exceed pipeline_max_cost_usd $%.4f",
+			b.Spent.CostUSD, est.CostUSD, b.PipelineMaxCostUSD))
+	}
+	if len(problems) > 0 {
+		return est, fmt.Errorf("%w: %s; reduce the context (git_diff, context_file, stdin_input) or raise the limit",
+			ErrBudgetExceeded, strings.Join(problems, "; "))
+	}
+
+	return est, nil
+}
+
+// Usage sums the tokens and cost of all models in the stats
+func (b Budget) Usage(stats *CLIStats) BudgetUsage {
+	var usage BudgetUsage
+	if stats == nil {
+		return usage
+	}
+	for modelName, modelStats := range stats.Models {
+		usage.Tokens += modelStats.Tokens.Total
+		cost, known := calculateModelCost(modelName, modelStats)
+		usage.CostUSD += cost
+		usage.UnknownCost = usage.UnknownCost || !known
+	}
+	return usage
+}
+
+// CheckActual compares the reported usage against the budget. It returns an
+// error when over budget; with the warn action the caller only reports it.
+func (b Budget) CheckActual(stats *CLIStats) (BudgetUsage, error) {
+	usage := b.Usage(stats)
+
+	var problems []string
+	if b.MaxTokens > 0 && usage.Tokens > b.MaxTokens {
+		problems = append(problems, fmt.Sprintf("used %d tokens, over max_tokens %d", usage.Tokens, b.MaxTokens))
+	}
+	if b.MaxCostUSD > 0 && usage.CostUSD > b.MaxCostUSD {
+		problems = append(problems, fmt.Sprintf("cost $%.4f, over max_cost_usd $%.4f", usage.CostUSD, b.MaxCostUSD))
+	}
+	if usage.UnknownCost && (b.MaxCostUSD > 0 || b.PipelineMaxCostUSD > 0) {
+		problems = append(problems, "cost budget not verifiable: some models have no pricing (add them to a pricing_file)")
+	}
+	if b.PipelineMaxTokens > 0 && b.Spent.Tokens+usage.Tokens > b.PipelineMaxTokens {
+		problems = append(problems, fmt.Sprintf("pipeline used %d tokens, over pipeline_max_tokens %d",
+			b.Spent.Tokens+usage.Tokens, b.PipelineMaxTokens))
+	}
+	if b.PipelineMaxCostUSD > 0 && b.Spent.CostUSD+usage.CostUSD > b.PipelineMaxCostUSD {
+		problems = append(problems, fmt.Sprintf("pipeline cost $%.4f, over pipeline_max_cost_usd $%.4f",
+			b.Spent.CostUSD+usage.CostUSD, b.PipelineMaxCostUSD))
+	}
+	if len(problems) > 0 {
+		return usage, fmt.Errorf("%w: %s", ErrBudgetExceeded, strings.Join(problems, "; "))
+	}
+
+	return usage, nil
+}
+
+// Allows checks whether another run using about as much as next still fits the
+// budget after spent, and describes the limit it would exceed otherwise
+func (b Budget) Allows(spent, next BudgetUsage) error {
+	total := addUsage(spent, next)
+
+	var problems []string
+	if b.MaxTokens > 0 && total.Tokens > b.MaxTokens {
+		problems = append(problems, fmt.Sprintf("used %d tokens, another ~%d would exceed max_tokens %d", spent.Tokens, next.Tokens, b.MaxTokens))
+	}
+	if b.MaxCostUSD > 0 && total.CostUSD > b.MaxCostUSD {
+		problems = append(problems, fmt.Sprintf("spent $%.4f, another ~$%.4f would exceed max_cost_usd $%.4f", spent.CostUSD, next.CostUSD, b.MaxCostUSD))
+	}
+	if b.PipelineMaxTokens > 0 && b.Spent.Tokens+total.Tokens > b.PipelineMaxTokens {
+		problems = append(problems, fmt.Sprintf("pipeline used %d tokens, another ~%d would exceed pipeline_max_tokens %d",
+			b.Spent.Tokens+spent.Tokens, next.Tokens, b.PipelineMaxTokens))
+	}
+	if b.PipelineMaxCostUSD > 0 && b.Spent.CostUSD+total.CostUSD > b.PipelineMaxCostUSD {
+		problems = append(problems, fmt.Sprintf("pipeline spent $%.4f, another ~$%.4f would exceed pipeline_max_cost_usd $%.4f",
+			b.Spent.CostUSD+spent.CostUSD, next.CostUSD, b.PipelineMaxCostUSD))
+	}
+	if len(problems) > 0 {
+		return fmt.Errorf("%w: %s", ErrBudgetExceeded, strings.Join(problems, "; "))
+	}
+	return nil
+}
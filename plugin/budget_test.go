@@ -0,0 +1,115 @@
+package plugin
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBudgetCheckEstimate(t *testing.T) {
+	prompt := "Review this code"
+	stdin := strings.Repeat("x", 4000) // ~1000 tokens
+
+	tests := []struct {
+		name    string
+		budget  Budget
+		wantErr bool
+	}{
+		{name: "no limits", budget: Budget{}, wantErr: false},
+		{name: "within token limit", budget: Budget{MaxTokens: 2000}, wantErr: false},
+		{name: "over token limit", budget: Budget{MaxTokens: 500}, wantErr: true},
+		{name: "within cost limit", budget: Budget{MaxCostUSD: 1}, wantErr: false},
+		{name: "over cost limit", budget: Budget{MaxCostUSD: 0.0001}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			est, err := tt.budget.CheckEstimate("gemini-2.5-pro", prompt, stdin)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("CheckEstimate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !errors.Is(err, ErrBudgetExceeded) {
+				t.Errorf("CheckEstimate() error = %v, want ErrBudgetExceeded", err)
+			}
+			if est.InputTokens != 1004 {
+				t.Errorf("InputTokens = %d, want 1004", est.InputTokens)
+			}
+		})
+	}
+}
+
+func TestBudgetCheckActual(t *testing.T) {
+	stats := &CLIStats{Models: map[string]ModelStats{
+		"gemini-2.5-pro": {Tokens: TokenStats{Prompt: 100000, Candidates: 10000, Total: 110000}},
+	}}
+
+	usage, err := Budget{MaxTokens: 200000, MaxCostUSD: 1}.CheckActual(stats)
+	if err != nil {
+		t.Errorf("CheckActual() unexpected error: %v", err)
+	}
+	// 100K input at $1.25/M + 10K output at $10/M
+	if usage.Tokens != 110000 || usage.CostUSD < 0.2249 || usage.CostUSD > 0.2251 {
+		t.Errorf("CheckActual() usage = %+v, want 110000 tokens and $0.225", usage)
+	}
+
+	if _, err := (Budget{MaxCostUSD: 0.10}).CheckActual(stats); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("CheckActual() error = %v, want ErrBudgetExceeded", err)
+	}
+	if _, err := (Budget{MaxTokens: 50000}).CheckActual(stats); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("CheckActual() error = %v, want ErrBudgetExceeded", err)
+	}
+}
+
+func TestBudgetAllows(t *testing.T) {
+	spent := BudgetUsage{Tokens: 1000, CostUSD: 0.02}
+	next := BudgetUsage{Tokens: 800, CostUSD: 0.015}
+
+	tests := []struct {
+		budget  Budget
+		wantErr string
+	}{
+		{budget: Budget{}},
+		{budget: Budget{MaxTokens: 2000, MaxCostUSD: 0.05}},
+		{budget: Budget{MaxTokens: 1500}, wantErr: "another ~800 would exceed max_tokens 1500"},
+		{budget: Budget{MaxCostUSD: 0.03}, wantErr: "another ~$0.0150 would exceed max_cost_usd $0.0300"},
+		{budget: Budget{PipelineMaxTokens: 3000, Spent: BudgetUsage{Tokens: 1500}}, wantErr: "pipeline used 2500 tokens"},
+	}
+
+	for _, tt := range tests {
+		err := tt.budget.Allows(spent, next)
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("%+v Allows() unexpected error: %v", tt.budget, err)
+		}
+		if tt.wantErr != "" && (!errors.Is(err, ErrBudgetExceeded) || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%+v Allows() error = %v, want %q", tt.budget, err, tt.wantErr)
+		}
+	}
+}
+
+func TestPipelineBudget(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "usage.json")
+
+	usage := LoadPipelineUsage(path, "42")
+	if usage.Runs != 0 || usage.Tokens != 0 {
+		t.Errorf("LoadPipelineUsage() on missing file = %+v, want empty", usage)
+	}
+
+	if err := SavePipelineUsage(path, usage, BudgetUsage{Tokens: 9000, CostUSD: 0.05}); err != nil {
+		t.Fatalf("SavePipelineUsage() error: %v", err)
+	}
+	usage = LoadPipelineUsage(path, "42")
+	if usage.Runs != 1 || usage.Tokens != 9000 {
+		t.Errorf("LoadPipelineUsage() = %+v, want 1 run with 9000 tokens", usage)
+	}
+
+	// Usage from another build does not count
+	if other := LoadPipelineUsage(path, "43"); other.Tokens != 0 {
+		t.Errorf("LoadPipelineUsage() for another build = %+v, want empty", other)
+	}
+
+	budget := Budget{PipelineMaxTokens: 10000, Spent: usage.BudgetUsage}
+	if _, err := budget.CheckEstimate("gemini-2.5-flash", "", strings.Repeat("x", 8000)); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("CheckEstimate() error = %v, want ErrBudgetExceeded for pipeline limit", err)
+	}
+}
@@ -0,0 +1,204 @@
+package plugin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// cacheVersion is part of every cache key; bump it when the entry format changes
+const cacheVersion = "v1"
+
+// CacheEntry is a stored CLI execution result
+type CacheEntry struct {
+	Key       string       `json:"key"`
+	CreatedAt time.Time    `json:"created_at"`
+	Model     string       `json:"model"`
+	RawOutput string       `json:"raw_output"`
+	Response  *CLIResponse `json:"response"`
+	ExitCode  int          `json:"exit_code"`
+}
+
+// ResponseCache stores CLI responses on disk (e.g. a Drone volume) so identical
+// runs are not billed twice
+type ResponseCache struct {
+	dir     string
+	ttl     time.Duration
+	maxSize int64
+	debug   bool
+}
+
+// NewResponseCache creates a cache in dir. Entries older than ttl are ignored and
+// the oldest entries are evicted once the directory exceeds maxSize bytes.
+func NewResponseCache(dir string, ttl time.Duration, maxSize int64, debug bool) *ResponseCache {
+	return &ResponseCache{
+		dir:     dir,
+		ttl:     ttl,
+		maxSize: maxSize,
+		debug:   debug,
+	}
+}
+
+// CacheKey hashes everything that influences the CLI response: model, rendered
+// prompt, stdin content, the options passed to gemini and the workspace the CLI
+// reads on its own (the resolved Target and the commit checked out there)
+func CacheKey(cfg *Config, commitSHA, prompt, stdinInput string) string {
+	target := cfg.Target
+	if abs, err := filepath.Abs(target); err == nil {
+		target = abs
+	}
+
+	h := sha256.New()
+	for _, part := range []string{
+		cacheVersion,
+		target,
+		commitSHA,
+		cfg.Model,
+		cfg.OutputFormat,
+		cfg.ApprovalMode,
+		cfg.IncludeDirs,
+		fmt.Sprintf("yolo=%t", cfg.Yolo),
+		prompt,
+		stdinInput,
+	} {
+		// Length-prefix each part so adjacent values cannot collide
+		fmt.Fprintf(h, "%d:%s\n", len(part), part)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Cacheable reports whether results for this configuration may be cached.
+// Runs that modify the workspace must always execute.
+func Cacheable(cfg *Config) bool {
+	return !cfg.ModifiesFiles()
+}
+
+// Get returns the cached result for key, or false on a miss or expired entry
+func (c *ResponseCache) Get(key string) (*ExecutionResult, bool) {
+	data, err := os.ReadFile(c.entryPath(key))
+	if err != nil {
+		return nil, false
+	}
+
+	var entry CacheEntry
+	if err := json.Unmarshal(data, &entry); err != nil || entry.Key != key || entry.Response == nil {
+		if c.debug {
+			fmt.Printf("[DEBUG] Ignoring invalid cache entry %s: %v\n", key[:12], err)
+		}
+		return nil, false
+	}
+
+	if c.ttl > 0 && time.Since(entry.CreatedAt) > c.ttl {
+		if c.debug {
+			fmt.Printf("[DEBUG] Cache entry %s expired (created %s)\n", key[:12], entry.CreatedAt.Format(time.RFC3339))
+		}
+		os.Remove(c.entryPath(key))
+		return nil, false
+	}
+
+	return &ExecutionResult{
+		RawOutput: entry.RawOutput,
+		Response:  entry.Response,
+		ExitCode:  entry.ExitCode,
+		Cached:    true,
+	}, true
+}
+
+// Put stores a successful result and prunes the cache
+func (c *ResponseCache) Put(key, model string, result *ExecutionResult) error {
+	if result == nil || result.Response == nil || result.Response.Error != nil || result.ExitCode != 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create cache dir: %w", err)
+	}
+
+	data, err := json.Marshal(CacheEntry{
+		Key:       key,
+		CreatedAt: time.Now(),
+		Model:     model,
+		RawOutput: result.RawOutput,
+		Response:  result.Response,
+		ExitCode:  result.ExitCode,
+	})
+	if err != nil {
+		return err
+	}
+
+	// Write atomically so concurrent pipelines never read a partial entry
+	tmp, err := os.CreateTemp(c.dir, ".entry-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	tmp.Close()
+	if err := os.Rename(tmp.Name(), c.entryPath(key)); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return c.prune()
+}
+
+// prune removes expired entries, then evicts the oldest until the cache fits maxSize
+func (c *ResponseCache) prune() error {
+	matches, err := filepath.Glob(filepath.Join(c.dir, "*.json"))
+	if err != nil {
+		return err
+	}
+
+	type file struct {
+		path    string
+		size    int64
+		modTime time.Time
+	}
+	var files []file
+	var total int64
+	for _, path := range matches {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if c.ttl > 0 && time.Since(info.ModTime()) > c.ttl {
+			os.Remove(path)
+			continue
+		}
+		files = append(files, file{path: path, size: info.Size(), modTime: info.ModTime()})
+		total += info.Size()
+	}
+
+	if c.maxSize <= 0 || total <= c.maxSize {
+		return nil
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	for _, f := range files {
+		if total <= c.maxSize {
+			break
+		}
+		if err := os.Remove(f.path); err == nil {
+			total -= f.size
+			if c.debug {
+				fmt.Printf("[DEBUG] Evicted cache entry %s\n", strings.TrimSuffix(filepath.Base(f.path), ".json"))
+			}
+		}
+	}
+
+	return nil
+}
+
+// entryPath returns the file path for a cache key
+func (c *ResponseCache) entryPath(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
@@ -0,0 +1,134 @@
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCacheKey(t *testing.T) {
+	cfg := &Config{Model: "gemini-2.5-flash", OutputFormat: "json"}
+	key := CacheKey(cfg, "abc123", "review", "diff")
+
+	if key != CacheKey(cfg, "abc123", "review", "diff") {
+		t.Error("CacheKey() should be deterministic")
+	}
+	if key == CacheKey(cfg, "abc123", "review", "other diff") {
+		t.Error("CacheKey() should change with stdin content")
+	}
+	if key == CacheKey(cfg, "abc123", "reviewdiff", "") {
+		t.Error("CacheKey() should not collide when content moves between prompt and stdin")
+	}
+	other := *cfg
+	other.Model = "gemini-2.5-pro"
+	if key == CacheKey(&other, "abc123", "review", "diff") {
+		t.Error("CacheKey() should change with model")
+	}
+	if key == CacheKey(cfg, "def456", "review", "diff") {
+		t.Error("CacheKey() should change with commit SHA")
+	}
+	moved := *cfg
+	moved.Target = "/other/workspace"
+	if key == CacheKey(&moved, "abc123", "review", "diff") {
+		t.Error("CacheKey() should change with target directory")
+	}
+}
+
+func TestCacheable(t *testing.T) {
+	if !Cacheable(&Config{}) {
+		t.Error("read-only runs should be cacheable")
+	}
+	if Cacheable(&Config{Yolo: true}) || Cacheable(&Config{ApprovalMode: "auto_edit"}) {
+		t.Error("runs that modify files should not be cacheable")
+	}
+}
+
+func TestResponseCache(t *testing.T) {
+	dir := t.TempDir()
+	cache := NewResponseCache(dir, time.Hour, 0, false)
+
+	result := &ExecutionResult{
+		RawOutput: `{"response":"ok"}`,
+		Response: &CLIResponse{
+			Response: "ok",
+			Stats: &CLIStats{Models: map[string]ModelStats{
+				"gemini-2.5-flash": {Tokens: TokenStats{Prompt: 100, Candidates: 10, Total: 110}},
+			}},
+		},
+	}
+
+	if _, ok := cache.Get("missing"); ok {
+		t.Error("Get() on empty cache should miss")
+	}
+
+	if err := cache.Put("k1", "gemini-2.5-flash", result); err != nil {
+		t.Fatalf("Put() error: %v", err)
+	}
+	got, ok := cache.Get("k1")
+	if !ok {
+		t.Fatal("Get() should hit after Put()")
+	}
+	if !got.Cached || got.Response.Response != "ok" || got.Response.Stats.Models["gemini-2.5-flash"].Tokens.Total != 110 {
+		t.Errorf("Get() = %+v, want cached response with stats", got)
+	}
+
+	// Failed responses are never stored
+	failed := &ExecutionResult{Response: &CLIResponse{Error: &CLIError{Message: "quota"}}}
+	if err := cache.Put("k2", "gemini-2.5-flash", failed); err != nil {
+		t.Fatalf("Put() error: %v", err)
+	}
+	if _, ok := cache.Get("k2"); ok {
+		t.Error("error responses should not be cached")
+	}
+}
+
+func TestResponseCacheExpiryAndEviction(t *testing.T) {
+	dir := t.TempDir()
+	result := &ExecutionResult{Response: &CLIResponse{Response: "ok"}}
+
+	expiring := NewResponseCache(dir, time.Minute, 0, false)
+	if err := expiring.Put("old", "m", result); err != nil {
+		t.Fatal(err)
+	}
+	stale := time.Now().Add(-2 * time.Minute)
+	writeCacheEntryTime(t, dir, "old", stale)
+	if _, ok := expiring.Get("old"); ok {
+		t.Error("expired entry should miss")
+	}
+
+	if err := NewResponseCache(dir, 0, 0, false).Put("first", "m", result); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(filepath.Join(dir, "first.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Room for one and a half entries, so only the newest survives
+	small := NewResponseCache(dir, 0, info.Size()*3/2, false)
+	os.Chtimes(filepath.Join(dir, "first.json"), stale, stale)
+	if err := small.Put("second", "m", result); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "first.json")); !os.IsNotExist(err) {
+		t.Error("oldest entry should be evicted when the cache exceeds its size limit")
+	}
+	if _, ok := small.Get("second"); !ok {
+		t.Error("newest entry should survive eviction")
+	}
+}
+
+// writeCacheEntryTime rewrites an entry's creation time
+func writeCacheEntryTime(t *testing.T, dir, key string, created time.Time) {
+	t.Helper()
+	cache := NewResponseCache(dir, 0, 0, false)
+	entry, ok := cache.Get(key)
+	if !ok {
+		t.Fatalf("entry %s not found", key)
+	}
+	data := []byte(`{"key":"` + key + `","created_at":"` + created.Format(time.RFC3339Nano) + `","response":{"response":"` + entry.Response.Response + `"}}`)
+	if err := os.WriteFile(filepath.Join(dir, key+".json"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -6,14 +6,21 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"path"
 	"path/filepath"
 	"strings"
 	"time"
+
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // CLIExecutor executes gemini CLI commands
 type CLIExecutor struct {
 	config *Config
+	ctx    context.Context
+
+	// credentialsFile is the service account JSON written for a run, removed after it
+	credentialsFile string
 }
 
 // ExecutionResult holds the result of a CLI execution
@@ -21,15 +28,51 @@ type ExecutionResult struct {
 	RawOutput string
 	Response  *CLIResponse
 	ExitCode  int
+	Cached    bool          // replayed from the response cache
+	Truncated bool          // partial output of a run stopped by a timeout or cancellation
+	Events    []StreamEvent // stream-json events in order, nil for other formats
+}
+
+// baseEnvKeys are the variables of the plugin environment passed to the commands
+// the plugin runs, as names or globs; PLUGIN_* settings, Drone secrets and
+// DRONE_NETRC_* are not
+var baseEnvKeys = []string{
+	"PATH", "HOME", "TMPDIR", "USER", "LOGNAME", "SHELL", "TERM", "TZ", "CI", "NO_COLOR",
+	"LANG", "LANGUAGE", "LC_*",
+	"SSL_CERT_FILE", "SSL_CERT_DIR", "NODE_EXTRA_CA_CERTS",
+	"HTTP_PROXY", "HTTPS_PROXY", "NO_PROXY", "http_proxy", "https_proxy", "no_proxy",
 }
 
+// cliEnvKeys are the variables passed to the gemini CLI: the base environment and
+// the authentication, when it is not configured through the plugin settings
+var cliEnvKeys = append(append([]string(nil), baseEnvKeys...),
+	"GEMINI_API_KEY", "GOOGLE_API_KEY", "GOOGLE_APPLICATION_CREDENTIALS",
+	"GOOGLE_CLOUD_PROJECT", "GOOGLE_CLOUD_LOCATION", "GOOGLE_GENAI_USE_VERTEXAI",
+)
+
+// maxPartialOutput bounds the output of a cancelled run printed to the build log
+const maxPartialOutput = 16 * 1024
+
+// cliWaitDelay bounds the wait for the output of a CLI that was killed
+const cliWaitDelay = 5 * time.Second
+
 // NewCLIExecutor creates a new CLI executor
 func NewCLIExecutor(config *Config) *CLIExecutor {
-	return &CLIExecutor{config: config}
+	return &CLIExecutor{config: config, ctx: context.Background()}
+}
+
+// WithContext sets the context that CLI runs are traced under and derive their timeout
+// from; cancelling it kills the CLI and its process group
+func (e *CLIExecutor) WithContext(ctx context.Context) *CLIExecutor {
+	e.ctx = ctx
+	return e
 }
 
 // CheckGeminiCLI verifies that gemini CLI is installed
-func (e *CLIExecutor) CheckGeminiCLI() error {
+func (e *CLIExecutor) CheckGeminiCLI() (err error) {
+	_, span := startSpan(e.ctx, "cli.version_check")
+	defer func() { endSpan(span, err) }()
+
 	cmd := exec.Command("gemini", "--version")
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
@@ -49,12 +92,24 @@ func (e *CLIExecutor) CheckGeminiCLI() error {
 		}
 		return ErrGeminiCLINotFound
 	}
-	fmt.Printf("Gemini CLI version: %s\n", strings.TrimSpace(stdout.String()))
+	version := strings.TrimSpace(stdout.String())
+	span.SetAttributes(attribute.String("gemini.cli.version", version))
+	fmt.Printf("Gemini CLI version: %s\n", version)
 	return nil
 }
 
 // Execute runs the gemini CLI with the configured options
-func (e *CLIExecutor) Execute(prompt string, stdinInput string) (*ExecutionResult, error) {
+func (e *CLIExecutor) Execute(prompt string, stdinInput string) (result *ExecutionResult, err error) {
+	spanCtx, span := startSpan(e.ctx, "cli.execute",
+		attribute.String("gemini.model", e.config.Model),
+		attribute.String("gemini.output_format", e.config.OutputFormat),
+		attribute.Int("gemini.stdin_bytes", len(stdinInput)),
+	)
+	defer func() {
+		span.SetAttributes(resultAttributes(result)...)
+		endSpan(span, err)
+	}()
+
 	// Build command arguments
 	args := e.buildArgs(prompt)
 
@@ -63,12 +118,43 @@ func (e *CLIExecutor) Execute(prompt string, stdinInput string) (*ExecutionResul
 	}
 
 	// Create context with timeout
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(e.config.Timeout)*time.Second)
+	ctx, cancel := context.WithTimeout(e.ctx, time.Duration(e.config.Timeout)*time.Second)
 	defer cancel()
 
-	// Create command
-	cmd := exec.CommandContext(ctx, "gemini", args...)
+	// Create command, in the sandbox when enabled
+	name, cmdArgs := "gemini", args
+	allowed := append(append([]string(nil), cliEnvKeys...), splitList(e.config.EnvPassthrough)...)
+	env := filterEnv(os.Environ(), allowed)
+	if e.config.Sandbox {
+		sandbox, err := NewSandbox(e.config)
+		if err != nil {
+			return nil, err
+		}
+		defer sandbox.Close()
+		name, cmdArgs = sandbox.Command(name, args)
+		env = sandbox.Env(env)
+		fmt.Printf("Sandbox: %s\n", sandbox.Describe())
+	}
+	cmd := exec.CommandContext(ctx, name, cmdArgs...)
 	cmd.Dir = e.config.Target
+	// The CLI runs in its own process group so a timeout also kills the shells it spawned
+	setProcessGroup(cmd)
+	// At the timeout the CLI first gets SIGTERM and timeout_grace to stop, so it can
+	// still flush its output, before it is killed
+	grace := time.Duration(e.config.TimeoutGrace) * time.Second
+	var graceTimer *time.Timer
+	if grace > 0 {
+		kill := cmd.Cancel
+		cmd.Cancel = func() error {
+			if ctx.Err() != context.DeadlineExceeded {
+				return kill()
+			}
+			fmt.Printf("\nWarning: timeout of %ds reached, stopping the gemini CLI (killed in %s)\n", e.config.Timeout, grace)
+			graceTimer = time.AfterFunc(grace, func() { kill() })
+			return terminateProcessGroup(cmd)
+		}
+	}
+	cmd.WaitDelay = grace + cliWaitDelay
 
 	// Set up input/output
 	var stdout, stderr bytes.Buffer
@@ -81,78 +167,216 @@ func (e *CLIExecutor) Execute(prompt string, stdinInput string) (*ExecutionResul
 	}
 
 	// Set environment with authentication
-	cmd.Env = e.buildEnv()
+	cmd.Env = e.buildEnv(env)
+	defer e.removeCredentials()
 
 	if e.config.Debug {
-		fmt.Println("[DEBUG] Environment variables set for authentication")
+		fmt.Printf("[DEBUG] CLI environment: %s\n", strings.Join(envKeys(cmd.Env), ", "))
 	}
 
 	// Execute
-	err := cmd.Run()
-
-	result := &ExecutionResult{
-		RawOutput: stdout.String(),
-		ExitCode:  0,
+	start := time.Now()
+	runErr := cmd.Run()
+	if graceTimer != nil {
+		graceTimer.Stop()
+	}
+	// Stop processes the agent left running in the background
+	killProcessGroup(cmd)
+
+	rec := &Recording{
+		Version:      recordingVersion,
+		RecordedAt:   start.UTC(),
+		Args:         args,
+		EnvKeys:      envKeys(cmd.Env),
+		OutputFormat: e.config.OutputFormat,
+		Stdin:        stdinInput,
+		Stdout:       stdout.String(),
+		Stderr:       stderr.String(),
+		DurationMs:   time.Since(start).Milliseconds(),
 	}
+	rec.TimedOut, rec.Cancelled = stopReason(ctx, runErr)
 
-	// Handle errors
-	if err != nil {
-		if ctx.Err() == context.DeadlineExceeded {
-			return nil, ErrTimeout
+	if runErr != nil && !rec.TimedOut && !rec.Cancelled {
+		exitErr, ok := runErr.(*exec.ExitError)
+		if !ok {
+			return nil, fmt.Errorf("%w: %v (stderr: %s)", ErrCLIExecution, runErr, stderr.String())
 		}
+		rec.ExitCode = exitErr.ExitCode()
+	}
 
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			result.ExitCode = exitErr.ExitCode()
+	// Save the invocation for offline replay
+	if e.config.RecordFile != "" {
+		path := resolveTargetPath(e.config.Target, e.config.RecordFile)
+		if saveErr := SaveRecording(path, rec); saveErr != nil {
+			fmt.Printf("Warning: failed to save recording: %v\n", saveErr)
+		} else {
+			fmt.Printf("Recorded invocation to %s\n", path)
 		}
+	}
 
+	result, err = e.processOutput(rec)
+	if rec.TimedOut || rec.Cancelled {
+		flushPartialOutput(rec, result)
+	}
+	if result != nil {
+		recordToolSpans(spanCtx, result.Events)
+	}
+	return result, err
+}
+
+// stopReason reports whether a CLI run that ended with runErr was stopped by the
+// timeout or by a cancellation of ctx. A run that exited cleanly is never stopped,
+// even when ctx expired just as it finished.
+func stopReason(ctx context.Context, runErr error) (timedOut, cancelled bool) {
+	if runErr == nil {
+		return false, false
+	}
+	return ctx.Err() == context.DeadlineExceeded, ctx.Err() == context.Canceled
+}
+
+// flushPartialOutput tells how much of a stopped run is kept. Output that did not
+// yield a partial response is printed so the build log keeps it.
+func flushPartialOutput(rec *Recording, result *ExecutionResult) {
+	stopped := "Timed out"
+	if rec.Cancelled {
+		stopped = "Cancelled"
+	}
+	fmt.Printf("\n%s after %s", stopped, time.Duration(rec.DurationMs)*time.Millisecond)
+	if result == nil {
+		fmt.Println(", no output yet")
+		return
+	}
+	if result.Response != nil && result.Response.Response != "" {
+		fmt.Printf(", keeping the partial response (%d bytes, %d events)\n", len(result.Response.Response), len(result.Events))
+		return
+	}
+
+	output, truncated := tailLines(rec.Stdout, maxPartialOutput)
+	if truncated {
+		fmt.Printf(", last %d bytes of output:\n", len(output))
+	} else {
+		fmt.Println(", output so far:")
+	}
+	fmt.Println(strings.TrimRight(output, "\n"))
+}
+
+// Replay feeds a recorded invocation through the same parsing path as Execute
+// without calling the gemini CLI
+func (e *CLIExecutor) Replay(rec *Recording) (result *ExecutionResult, err error) {
+	spanCtx, span := startSpan(e.ctx, "cli.replay",
+		attribute.Int64("gemini.recorded_duration_ms", rec.DurationMs))
+	defer func() {
+		span.SetAttributes(resultAttributes(result)...)
+		endSpan(span, err)
+	}()
+
+	if e.config.Debug {
+		fmt.Printf("[DEBUG] Replaying: gemini %s\n", strings.Join(rec.Args, " "))
+		fmt.Printf("[DEBUG] Recorded env keys: %s\n", strings.Join(rec.EnvKeys, ", "))
+	}
+
+	result, err = e.processOutput(rec)
+	if result != nil {
+		recordToolSpans(spanCtx, result.Events)
+	}
+	return result, err
+}
+
+// processOutput turns captured CLI output into an ExecutionResult
+func (e *CLIExecutor) processOutput(rec *Recording) (*ExecutionResult, error) {
+	if rec.TimedOut || rec.Cancelled {
+		return e.processPartialOutput(rec)
+	}
+
+	result := &ExecutionResult{
+		RawOutput: rec.Stdout,
+		ExitCode:  rec.ExitCode,
+	}
+
+	// Handle errors
+	if rec.ExitCode != 0 {
 		// If we got some output, try to parse it (might contain error details)
-		if stdout.Len() > 0 {
+		if len(rec.Stdout) > 0 {
 			if e.config.Debug {
-				fmt.Printf("[DEBUG] CLI stderr: %s\n", stderr.String())
+				fmt.Printf("[DEBUG] CLI stderr: %s\n", rec.Stderr)
 			}
 		} else {
-			return nil, fmt.Errorf("%w: %v (stderr: %s)", ErrCLIExecution, err, stderr.String())
+			return nil, fmt.Errorf("%w: exit status %d (stderr: %s)", ErrCLIExecution, rec.ExitCode, rec.Stderr)
 		}
 	}
 
+	if err := e.parseOutput(result, rec.OutputFormat); err != nil {
+		return result, err
+	}
+
+	// Check for API errors in response
+	if result.Response != nil && result.Response.Error != nil {
+		return result, fmt.Errorf("%w: %s - %s",
+			ErrCLIExecution,
+			result.Response.Error.Type,
+			result.Response.Error.Message)
+	}
+
+	return result, nil
+}
+
+// processPartialOutput parses what a run stopped by a timeout or cancellation wrote
+// before it was killed. The result is marked as truncated and returned together
+// with ErrTimeout or ErrCancelled; it is nil when nothing arrived.
+func (e *CLIExecutor) processPartialOutput(rec *Recording) (*ExecutionResult, error) {
+	stopErr := ErrTimeout
+	if rec.Cancelled {
+		stopErr = ErrCancelled
+	}
+	if strings.TrimSpace(rec.Stdout) == "" {
+		return nil, stopErr
+	}
+
+	result := &ExecutionResult{
+		RawOutput: rec.Stdout,
+		ExitCode:  rec.ExitCode,
+		Truncated: true,
+	}
+	// stream-json and text keep what arrived; a cut-off json document cannot be parsed
+	if err := e.parseOutput(result, rec.OutputFormat); err != nil && e.config.Debug {
+		fmt.Printf("[DEBUG] Partial output not parsed: %v\n", err)
+	}
+	return result, stopErr
+}
+
+// parseOutput parses the raw output of a result in the recorded output format
+func (e *CLIExecutor) parseOutput(result *ExecutionResult, outputFormat string) error {
+	if outputFormat == "" {
+		outputFormat = e.config.OutputFormat
+	}
+
 	// Parse output based on format
 	parser := NewOutputParser(e.config.Debug)
 
-	switch e.config.OutputFormat {
+	switch outputFormat {
 	case "json":
-		response, parseErr := parser.ParseJSON(result.RawOutput)
-		if parseErr != nil {
-			return result, parseErr
+		response, err := parser.ParseJSON(result.RawOutput)
+		if err != nil {
+			return err
 		}
 		result.Response = response
 
 	case "stream-json":
-		_, response, parseErr := parser.ParseStreamJSON(result.RawOutput)
-		if parseErr != nil {
-			return result, parseErr
+		events, response, err := parser.ParseStreamJSON(result.RawOutput)
+		if err != nil {
+			return err
 		}
+		result.Events = events
 		result.Response = response
 
 	default: // text
 		result.Response = parser.ParseText(result.RawOutput)
 	}
-
-	// Check for API errors in response
-	if result.Response != nil && result.Response.Error != nil {
-		return result, fmt.Errorf("%w: %s - %s",
-			ErrCLIExecution,
-			result.Response.Error.Type,
-			result.Response.Error.Message)
-	}
-
-	return result, nil
+	return nil
 }
 
-// buildEnv constructs environment variables including authentication
-func (e *CLIExecutor) buildEnv() []string {
-	// Start with current environment
-	env := os.Environ()
-
+// buildEnv adds the authentication variables to the base environment
+func (e *CLIExecutor) buildEnv(env []string) []string {
 	authMode := e.config.DetectAuthMode()
 
 	switch authMode {
@@ -196,6 +420,7 @@ func (e *CLIExecutor) buildEnv() []string {
 					tmpFile.WriteString(e.config.GCPCredentials)
 					tmpFile.Close()
 					credPath = tmpFile.Name()
+					e.credentialsFile = credPath
 					if e.config.Debug {
 						fmt.Printf("[DEBUG] Wrote credentials to temp file: %s\n", credPath)
 					}
@@ -222,6 +447,32 @@ func (e *CLIExecutor) buildEnv() []string {
 	return env
 }
 
+// filterEnv keeps the variables of env whose key matches one of the patterns
+func filterEnv(env, patterns []string) []string {
+	var kept []string
+	for _, kv := range env {
+		key, _, _ := strings.Cut(kv, "=")
+		for _, pattern := range patterns {
+			if matched, _ := path.Match(pattern, key); matched {
+				kept = append(kept, kv)
+				break
+			}
+		}
+	}
+	return kept
+}
+
+// removeCredentials removes the service account JSON written by buildEnv
+func (e *CLIExecutor) removeCredentials() {
+	if e.credentialsFile == "" {
+		return
+	}
+	if err := os.Remove(e.credentialsFile); err != nil && !os.IsNotExist(err) {
+		fmt.Printf("Warning: failed to remove credentials file: %v\n", err)
+	}
+	e.credentialsFile = ""
+}
+
 // buildArgs constructs command line arguments based on configuration
 func (e *CLIExecutor) buildArgs(prompt string) []string {
 	var args []string
@@ -0,0 +1,182 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFilterEnv(t *testing.T) {
+	env := []string{
+		"PATH=/usr/bin",
+		"HOME=/root",
+		"LC_CTYPE=C.UTF-8",
+		"GEMINI_API_KEY=key",
+		"PLUGIN_API_KEY=secret",
+		"PLUGIN_SCM_TOKEN=secret",
+		"DRONE_NETRC_PASSWORD=token",
+		"DRONE_BUILD_NUMBER=42",
+		"GOFLAGS=-mod=mod",
+		"NPM_CONFIG_REGISTRY=https://npm.example.com",
+	}
+
+	tests := []struct {
+		name        string
+		passthrough string
+		want        []string
+	}{
+		{
+			name: "allowlist",
+			want: []string{"PATH=/usr/bin", "HOME=/root", "LC_CTYPE=C.UTF-8", "GEMINI_API_KEY=key"},
+		},
+		{
+			name:        "passthrough names and globs",
+			passthrough: "GOFLAGS, NPM_CONFIG_*,DRONE_BUILD_NUMBER",
+			want: []string{"PATH=/usr/bin", "HOME=/root", "LC_CTYPE=C.UTF-8", "GEMINI_API_KEY=key",
+				"DRONE_BUILD_NUMBER=42", "GOFLAGS=-mod=mod", "NPM_CONFIG_REGISTRY=https://npm.example.com"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := filterEnv(env, append(append([]string(nil), cliEnvKeys...), splitList(tt.passthrough)...))
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("filterEnv() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBuildEnv(t *testing.T) {
+	executor := NewCLIExecutor(&Config{APIKey: "configured"})
+	env := executor.buildEnv([]string{"PATH=/usr/bin"})
+	if strings.Join(env, " ") != "PATH=/usr/bin GEMINI_API_KEY=configured" {
+		t.Errorf("buildEnv() = %v", env)
+	}
+}
+
+func TestRemoveCredentials(t *testing.T) {
+	executor := NewCLIExecutor(&Config{GCPProject: "project", GCPCredentials: `{"type": "service_account"}`})
+	env := executor.buildEnv(nil)
+	var path string
+	for _, kv := range env {
+		if value, ok := strings.CutPrefix(kv, "GOOGLE_APPLICATION_CREDENTIALS="); ok {
+			path = value
+		}
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("credentials file %q not written: %v", path, err)
+	}
+	executor.removeCredentials()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("credentials file %q not removed", path)
+	}
+}
+
+func TestExecCancelled(t *testing.T) {
+	target := t.TempDir()
+	installScriptGemini(t, `
+cat > /dev/null
+echo '{"type": "init", "model": "gemini-2.5-pro"}'
+sleep 30
+`)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	time.AfterFunc(500*time.Millisecond, cancel)
+
+	p := New(Config{
+		Target:       target,
+		Prompt:       "Review",
+		Model:        "gemini-2.5-pro",
+		OutputFormat: "stream-json",
+		Timeout:      30,
+		ReportFormat: ReportFormatMarkdown,
+		ReportFile:   "report.md",
+		LedgerFile:   "ledger.jsonl",
+	})
+	err := p.Exec(ctx)
+	if !errors.Is(err, ErrCancelled) {
+		t.Fatalf("Exec() error = %v, want ErrCancelled", err)
+	}
+
+	report, err := os.ReadFile(filepath.Join(target, "report.md"))
+	if err != nil || !strings.Contains(string(report), "the build was cancelled after") {
+		t.Errorf("report_file = %q, %v", report, err)
+	}
+	ledger, err := os.ReadFile(filepath.Join(target, "ledger.jsonl"))
+	if err != nil || !strings.Contains(string(ledger), `"outcome":"cancelled"`) {
+		t.Errorf("ledger = %q, %v", ledger, err)
+	}
+}
+
+func TestExecuteTimeoutPartial(t *testing.T) {
+	tests := []struct {
+		name  string
+		grace int
+		want  string
+	}{
+		{name: "killed", grace: 0, want: "Found two"},
+		// The CLI gets SIGTERM first and can still finish its message
+		{name: "grace", grace: 5, want: "Found two issues"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			installScriptGemini(t, `
+trap 'echo "{\"type\": \"message\", \"role\": \"assistant\", \"content\": \" issues\", \"delta\": true}"; exit 143' TERM
+echo '{"type": "init", "model": "gemini-2.5-pro"}'
+echo '{"type": "message", "role": "assistant", "content": "Found", "delta": true}'
+echo '{"type": "message", "role": "assistant", "content": " two", "delta": true}'
+sleep 30 &
+wait $!
+`)
+			executor := NewCLIExecutor(&Config{Target: t.TempDir(), OutputFormat: "stream-json", Timeout: 1, TimeoutGrace: tt.grace})
+			result, err := executor.Execute("hi", "")
+			if !errors.Is(err, ErrTimeout) {
+				t.Fatalf("Execute() error = %v, want ErrTimeout", err)
+			}
+			if result == nil || !result.Truncated || result.Response == nil {
+				t.Fatalf("Execute() result = %+v, want a truncated response", result)
+			}
+			if result.Response.Response != tt.want {
+				t.Errorf("response = %q, want %q", result.Response.Response, tt.want)
+			}
+		})
+	}
+}
+
+func TestStopReason(t *testing.T) {
+	expired, cancel := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	cancelled, cancelNow := context.WithCancel(context.Background())
+	cancelNow()
+	killed := errors.New("signal: killed")
+
+	tests := []struct {
+		name          string
+		ctx           context.Context
+		runErr        error
+		wantTimedOut  bool
+		wantCancelled bool
+	}{
+		{name: "finished", ctx: context.Background()},
+		// The CLI exited cleanly just as the deadline fired
+		{name: "finished at the timeout", ctx: expired},
+		{name: "finished at a cancellation", ctx: cancelled},
+		{name: "failed", ctx: context.Background(), runErr: killed},
+		{name: "timed out", ctx: expired, runErr: killed, wantTimedOut: true},
+		{name: "cancelled", ctx: cancelled, runErr: killed, wantCancelled: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			timedOut, cancelled := stopReason(tt.ctx, tt.runErr)
+			if timedOut != tt.wantTimedOut || cancelled != tt.wantCancelled {
+				t.Errorf("stopReason() = %v, %v, want %v, %v", timedOut, cancelled, tt.wantTimedOut, tt.wantCancelled)
+			}
+		})
+	}
+}
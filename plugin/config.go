@@ -1,5 +1,10 @@
 package plugin
 
+import (
+	"path"
+	"strings"
+)
+
 // Config holds the plugin configuration from environment variables.
 // Drone CI injects these as PLUGIN_* environment variables.
 type Config struct {
@@ -9,6 +14,18 @@ type Config struct {
 	// PromptFile is a file path to read the prompt from (overrides Prompt)
 	PromptFile string `envconfig:"PROMPT_FILE"`
 
+	// ConfigFile is a YAML file with settings and per-branch/per-event overrides
+	// (relative to Target). The default file is optional.
+	ConfigFile string `envconfig:"CONFIG_FILE" default:".gemini-drone.yml"`
+
+	// Profiles is a YAML or JSON list of named profiles; the first one whose branch, event
+	// and target_branch patterns match the build overrides model, prompt, gating, budget and YOLO
+	Profiles string `envconfig:"PROFILES"`
+
+	// Task selects a built-in preset (review, security-audit, release-notes, test-gen, commit-lint)
+	// that supplies a curated prompt and its git context. Prompt and PromptFile override the preset prompt.
+	Task string `envconfig:"TASK"`
+
 	// ContextFile is a file path to read additional context from (appended to stdin)
 	ContextFile string `envconfig:"CONTEXT_FILE"`
 
@@ -21,6 +38,9 @@ type Config struct {
 	// OutputFormat specifies the output format: text, json, stream-json
 	OutputFormat string `envconfig:"OUTPUT_FORMAT" default:"json"`
 
+	// OutputFile writes the AI response to a file, e.g. CHANGELOG.md (relative to Target)
+	OutputFile string `envconfig:"OUTPUT_FILE"`
+
 	// Yolo enables auto-approval of all actions (--yolo flag)
 	Yolo bool `envconfig:"YOLO" default:"false"`
 
@@ -30,12 +50,45 @@ type Config struct {
 	// IncludeDirs specifies additional directories to include (comma-separated)
 	IncludeDirs string `envconfig:"INCLUDE_DIRS"`
 
+	// ProtectedBranches are comma-separated branch globs on which yolo and auto_edit are
+	// refused, also when they are the target branch of a pull request
+	ProtectedBranches string `envconfig:"PROTECTED_BRANCHES" default:"main,master,release/*"`
+
+	// ProtectedOverride allows yolo and auto_edit on a protected branch, tag or promote.
+	// It is the reason for doing so, and is logged and recorded in the ledger.
+	ProtectedOverride string `envconfig:"PROTECTED_OVERRIDE"`
+
+	// AllowedPaths are comma-separated globs of the files the agent may change in yolo
+	// or auto_edit mode, relative to the repository root (empty allows all but ProtectedPaths)
+	AllowedPaths string `envconfig:"ALLOWED_PATHS"`
+
+	// ProtectedPaths are comma-separated globs of files the agent must never change;
+	// changes to them, or outside AllowedPaths, are reverted and fail the step
+	ProtectedPaths string `envconfig:"PROTECTED_PATHS" default:".drone.yml,.drone.yaml,.drone.jsonnet,.drone.star,.gemini-drone.yml"`
+
+	// ReportFormat selects how the result is reported: plain, markdown, json or ansi
+	ReportFormat string `envconfig:"REPORT_FORMAT" default:"plain"`
+
+	// ReportFile also writes the rendered report to a file, e.g. a PR comment body (relative to Target)
+	ReportFile string `envconfig:"REPORT_FILE"`
+
+	// PatchFile writes the changes of a yolo or auto_edit run as a patch, e.g. gemini.patch
+	// (relative to Target); a summary of the changes is always included in the report
+	PatchFile string `envconfig:"PATCH_FILE"`
+
+	// Locale selects the language of the statistics output: en or zh
+	Locale string `envconfig:"LOCALE" default:"en"`
+
 	// Debug enables debug output
 	Debug bool `envconfig:"DEBUG" default:"false"`
 
 	// Timeout in seconds for CLI execution (default 300s = 5 minutes)
 	Timeout int `envconfig:"TIMEOUT" default:"300"`
 
+	// TimeoutGrace is the time in seconds the CLI gets to stop after SIGTERM at the
+	// timeout before it is killed; 0 kills it at once
+	TimeoutGrace int `envconfig:"TIMEOUT_GRACE" default:"10"`
+
 	// GitDiff enables analyzing the last commit diff
 	GitDiff bool `envconfig:"GIT_DIFF" default:"false"`
 
@@ -45,6 +98,160 @@ type Config struct {
 	// StdinInput is additional content to pass via stdin
 	StdinInput string `envconfig:"STDIN_INPUT"`
 
+	// RecordFile saves the full CLI invocation (args, env keys, stdin, stdout, stderr,
+	// exit code and timing) to this file for offline replay
+	RecordFile string `envconfig:"RECORD_FILE"`
+
+	// ReplayFile replays a recorded invocation instead of calling the gemini CLI
+	ReplayFile string `envconfig:"REPLAY_FILE"`
+
+	// EnvPassthrough are comma-separated names or globs of additional variables of the
+	// step passed to the gemini CLI, e.g. GOFLAGS,NPM_CONFIG_*; the CLI only gets an
+	// allowlist of system, proxy and authentication variables by default
+	EnvPassthrough string `envconfig:"ENV_PASSTHROUGH"`
+
+	// --- Sandbox ---
+
+	// Sandbox runs the gemini CLI with resource limits and a private HOME and TMPDIR;
+	// on kernels with Landlock, writes are limited to Target
+	Sandbox bool `envconfig:"SANDBOX" default:"false"`
+
+	// SandboxCPU limits the CPU time of each sandboxed process, in seconds (0 uses timeout)
+	SandboxCPU int `envconfig:"SANDBOX_CPU"`
+
+	// SandboxMemory limits the heap of each sandboxed process, in MB (0 disables)
+	SandboxMemory int `envconfig:"SANDBOX_MEMORY" default:"4096"`
+
+	// SandboxOpenFiles limits the open files of each sandboxed process (0 disables)
+	SandboxOpenFiles int `envconfig:"SANDBOX_OPEN_FILES" default:"1024"`
+
+	// --- Verification ---
+
+	// VerifyCommand is run with sh -c in Target after a yolo or auto_edit run, e.g.
+	// `go test ./...`; its failures are fed back to the agent for repair
+	VerifyCommand string `envconfig:"VERIFY_COMMAND"`
+
+	// VerifyMaxRepairs is the number of repair runs after a failed verification
+	VerifyMaxRepairs int `envconfig:"VERIFY_MAX_REPAIRS" default:"2"`
+
+	// VerifyTimeout bounds one run of VerifyCommand, in seconds
+	VerifyTimeout int `envconfig:"VERIFY_TIMEOUT" default:"600"`
+
+	// --- Push ---
+
+	// PushChanges commits the changes of a yolo or auto_edit run with a generated
+	// conventional-commit message and pushes them to PushBranch
+	PushChanges bool `envconfig:"PUSH_CHANGES" default:"false"`
+
+	// PushBranch is the new branch to push to; {build} is replaced by the build number
+	PushBranch string `envconfig:"PUSH_BRANCH" default:"gemini/fix-{build}"`
+
+	// PushRemote is the git remote name or URL to push to
+	PushRemote string `envconfig:"PUSH_REMOTE" default:"origin"`
+
+	// CommitAuthorName is the author and committer name of pushed commits
+	CommitAuthorName string `envconfig:"COMMIT_AUTHOR_NAME" default:"Gemini CLI"`
+
+	// CommitAuthorEmail is the author and committer email of pushed commits
+	CommitAuthorEmail string `envconfig:"COMMIT_AUTHOR_EMAIL" default:"gemini-cli@noreply.localhost"`
+
+	// PushForce replaces PushBranch when it already exists, e.g. to refresh the pull
+	// request of a scheduled pipeline that always pushes to the same branch
+	PushForce bool `envconfig:"PUSH_FORCE" default:"false"`
+
+	// --- Pull Request ---
+
+	// PullRequest opens a pull request for the pushed branch, or updates the open one
+	PullRequest bool `envconfig:"PULL_REQUEST" default:"false"`
+
+	// PullRequestBase is the branch to merge into; defaults to the build's source branch
+	PullRequestBase string `envconfig:"PULL_REQUEST_BASE"`
+
+	// SCMProvider is the API used to open pull requests: gitea, github or gitlab.
+	// Detected from DRONE_REPO_LINK for github.com and gitlab.com.
+	SCMProvider string `envconfig:"SCM_PROVIDER"`
+
+	// SCMURL is the API base URL, e.g. https://gitea.example.com/api/v1; derived
+	// from DRONE_REPO_LINK when empty
+	SCMURL string `envconfig:"SCM_URL"`
+
+	// SCMToken authenticates API requests; defaults to the Drone netrc password
+	SCMToken string `envconfig:"SCM_TOKEN" secret:"true"`
+
+	// --- Gating ---
+
+	// FailOn fails the step when the response reports findings at or above this
+	// severity: critical, warning or info
+	FailOn string `envconfig:"FAIL_ON"`
+
+	// --- Budget ---
+
+	// MaxCostUSD refuses runs whose estimated input cost exceeds this amount and
+	// flags runs whose actual cost went over it (0 disables)
+	MaxCostUSD float64 `envconfig:"MAX_COST_USD"`
+
+	// MaxTokens refuses runs whose estimated input exceeds this many tokens and
+	// flags runs whose actual total went over it (0 disables)
+	MaxTokens int `envconfig:"MAX_TOKENS"`
+
+	// PipelineMaxCostUSD limits the total cost of all plugin steps in the same build (0 disables)
+	PipelineMaxCostUSD float64 `envconfig:"PIPELINE_MAX_COST_USD"`
+
+	// PipelineMaxTokens limits the total tokens of all plugin steps in the same build (0 disables)
+	PipelineMaxTokens int `envconfig:"PIPELINE_MAX_TOKENS"`
+
+	// PipelineUsageFile shares usage between steps of a build (relative to Target)
+	PipelineUsageFile string `envconfig:"PIPELINE_USAGE_FILE" default:".gemini-usage.json"`
+
+	// BudgetAction is applied when actual usage exceeds the budget: fail or warn
+	BudgetAction string `envconfig:"BUDGET_ACTION" default:"fail"`
+
+	// LedgerFile appends every run (repo, build, model, tokens, cost, outcome) to this
+	// JSONL file, e.g. on a shared volume; aggregate it with the report subcommand
+	LedgerFile string `envconfig:"LEDGER_FILE"`
+
+	// MonthlyMaxCostUSD refuses new runs once the repo's spend this month, as recorded
+	// in LedgerFile, reaches this amount (0 disables)
+	MonthlyMaxCostUSD float64 `envconfig:"MONTHLY_MAX_COST_USD"`
+
+	// PricingFile is a YAML or JSON file with model prices merged over the built-in table
+	PricingFile string `envconfig:"PRICING_FILE"`
+
+	// --- Response Cache ---
+
+	// CacheDir enables response caching in this directory (e.g. a Drone volume)
+	CacheDir string `envconfig:"CACHE_DIR"`
+
+	// CacheTTL in seconds before a cached response expires (default 86400s = 24 hours)
+	CacheTTL int `envconfig:"CACHE_TTL" default:"86400"`
+
+	// CacheMaxSize in MB before the oldest cached responses are evicted
+	CacheMaxSize int `envconfig:"CACHE_MAX_SIZE" default:"100"`
+
+	// --- Metrics ---
+
+	// MetricsFile writes Prometheus metrics of the run to this path for node_exporter's
+	// textfile collector (should end in .prom)
+	MetricsFile string `envconfig:"METRICS_FILE"`
+
+	// MetricsPushgateway pushes Prometheus metrics of the run to this Pushgateway URL
+	MetricsPushgateway string `envconfig:"METRICS_PUSHGATEWAY"`
+
+	// MetricsJob is the job label used when pushing to the Pushgateway
+	MetricsJob string `envconfig:"METRICS_JOB" default:"drone-gemini-cli"`
+
+	// --- Tracing ---
+
+	// TraceEndpoint exports OpenTelemetry spans of the run to this OTLP/HTTP endpoint,
+	// e.g. http://otel-collector:4318 (the standard OTEL_EXPORTER_OTLP_* variables also work)
+	TraceEndpoint string `envconfig:"TRACE_ENDPOINT"`
+
+	// TraceHeaders are extra OTLP request headers as comma-separated key=value pairs
+	TraceHeaders string `envconfig:"TRACE_HEADERS" secret:"true"`
+
+	// TraceServiceName is the service.name resource attribute of exported spans
+	TraceServiceName string `envconfig:"TRACE_SERVICE_NAME" default:"drone-gemini-cli-plugin"`
+
 	// --- Authentication Options ---
 	// Compatible with drone-gemini-plugin configuration
 
@@ -52,7 +259,7 @@ type Config struct {
 	// 1. Gemini API Key (Google AI Studio) - when GCPProject is NOT set
 	// 2. Google API Key (Vertex AI) - when GCPProject IS set
 	// Maps to GEMINI_API_KEY or GOOGLE_API_KEY environment variable for gemini CLI
-	APIKey string `envconfig:"API_KEY"`
+	APIKey string `envconfig:"API_KEY" secret:"true"`
 
 	// GCPProject is the Google Cloud Project ID (for Vertex AI)
 	// Maps to GOOGLE_CLOUD_PROJECT environment variable for gemini CLI
@@ -64,7 +271,7 @@ type Config struct {
 
 	// GCPCredentials is the path to or content of service account JSON (for Vertex AI)
 	// Maps to GOOGLE_APPLICATION_CREDENTIALS environment variable for gemini CLI
-	GCPCredentials string `envconfig:"GCP_CREDENTIALS"`
+	GCPCredentials string `envconfig:"GCP_CREDENTIALS" secret:"true"`
 }
 
 // AuthMode represents the authentication mode
@@ -100,10 +307,82 @@ func (c *Config) DetectAuthMode() AuthMode {
 	return AuthModeNone
 }
 
-// Validate checks if the configuration is valid
+// ModifiesFiles reports whether the agent may modify files without approval
+func (c *Config) ModifiesFiles() bool {
+	return c.Yolo || c.ApprovalMode == "auto_edit" || c.ApprovalMode == "yolo"
+}
+
+// Validate checks the configuration and returns every problem found at once,
+// with the closest valid value suggested for misspelled settings
 func (c *Config) Validate() error {
-	if c.Prompt == "" && c.PromptFile == "" {
-		return ErrPromptRequired
+	var v validator
+
+	if c.Prompt == "" && c.PromptFile == "" && c.Task == "" {
+		v.add(ErrPromptRequired)
+	}
+	if c.Task != "" {
+		if _, err := LookupTask(c.Task); err != nil {
+			v.add(err)
+		}
+	}
+	if _, err := NewReportRenderer(c.ReportFormat); err != nil {
+		v.add(err)
+	}
+
+	v.enum("output_format", c.OutputFormat, OutputFormats)
+	v.enum("approval_mode", c.ApprovalMode, ApprovalModes)
+	v.enum("budget_action", c.BudgetAction, BudgetActions)
+	v.enum("fail_on", c.FailOn, FailOnSeverities)
+	if _, ok := NormalizeLocale(c.Locale); !ok {
+		v.addf("locale %q is not supported%s (valid: %s)", c.Locale, suggestion(c.Locale, Locales()), strings.Join(Locales(), ", "))
+	}
+
+	if c.Timeout <= 0 {
+		v.addf("timeout must be greater than 0 seconds, got %d", c.Timeout)
+	}
+	if c.TimeoutGrace < 0 {
+		v.addf("timeout_grace must not be negative, got %d", c.TimeoutGrace)
+	}
+
+	if c.PushChanges {
+		if !c.ModifiesFiles() {
+			v.addf("push_changes requires yolo or approval_mode auto_edit")
+		}
+		if c.PushBranch == "" || c.PushRemote == "" {
+			v.addf("push_changes requires push_branch and push_remote")
+		}
+	}
+	if c.VerifyCommand != "" {
+		if !c.ModifiesFiles() {
+			v.addf("verify_command requires yolo or approval_mode auto_edit")
+		}
+		if c.VerifyMaxRepairs < 0 {
+			v.addf("verify_max_repairs must not be negative, got %d", c.VerifyMaxRepairs)
+		}
+		if c.VerifyTimeout <= 0 {
+			v.addf("verify_timeout must be greater than 0 seconds, got %d", c.VerifyTimeout)
+		}
 	}
-	return nil
+	for _, pattern := range splitList(c.EnvPassthrough) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			v.addf("env_passthrough pattern %q is invalid: %v", pattern, err)
+		}
+	}
+	if c.Sandbox {
+		if !sandboxSupported {
+			v.addf("sandbox requires Linux")
+		}
+		if c.SandboxCPU < 0 || c.SandboxMemory < 0 || c.SandboxOpenFiles < 0 {
+			v.addf("sandbox_cpu, sandbox_memory and sandbox_open_files must not be negative")
+		}
+	}
+	if c.PullRequest && !c.PushChanges {
+		v.addf("pull_request requires push_changes")
+	}
+	v.enum("scm_provider", c.SCMProvider, SCMProviders())
+
+	v.validateTarget(c.Target)
+	v.validateAuth(c)
+
+	return v.err()
 }
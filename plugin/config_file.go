@@ -0,0 +1,409 @@
+package plugin
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kelseyhightower/envconfig"
+	"gopkg.in/yaml.v3"
+)
+
+// envPrefix is the prefix Drone adds to plugin settings
+const envPrefix = "PLUGIN_"
+
+// Sources of a setting's value, from lowest to highest precedence
+const (
+	SourceDefault  = "default"
+	SourceFile     = "file"
+	SourceEnv      = "env"      // unprefixed environment variable, e.g. MODEL
+	SourceSettings = "settings" // PLUGIN_* variable, i.e. a Drone setting
+)
+
+// Config file sections holding per-branch and per-event overrides
+const (
+	configBranchesKey = "branches"
+	configEventsKey   = "events"
+)
+
+// configFileForbidden are settings that cannot be set in the config file: they
+// locate or bootstrap the file itself, or they are security controls that a
+// branch editing the file must not be able to weaken. Drone's protected-repo
+// review only covers .drone.yml, so these stay settings-only.
+var configFileForbidden = map[string]bool{
+	"target":      true,
+	"config_file": true,
+
+	// File modifications and the policy around them
+	"yolo":               true,
+	"approval_mode":      true,
+	"protected_branches": true,
+	"protected_override": true,
+	"allowed_paths":      true,
+	"protected_paths":    true,
+
+	// What the agent and verify_command can run and read
+	"env_passthrough":    true,
+	"sandbox":            true,
+	"sandbox_cpu":        true,
+	"sandbox_memory":     true,
+	"sandbox_open_files": true,
+	"verify_command":     true,
+
+	// Where changes, credentials and telemetry are sent
+	"push_changes":        true,
+	"push_branch":         true,
+	"push_remote":         true,
+	"push_force":          true,
+	"pull_request":        true,
+	"pull_request_base":   true,
+	"scm_provider":        true,
+	"scm_url":             true,
+	"trace_endpoint":      true,
+	"metrics_pushgateway": true,
+}
+
+// ConfigSources maps setting names to where their effective value came from
+type ConfigSources map[string]string
+
+// FromFile returns the sorted settings whose value came from the config file
+func (s ConfigSources) FromFile() []string {
+	var keys []string
+	for key, source := range s {
+		if strings.HasPrefix(source, SourceFile) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// configField is a Config field addressable by its setting name
+type configField struct {
+	name   string // setting name, e.g. output_format
+	envKey string // environment key without prefix, e.g. OUTPUT_FORMAT
+	index  int
+	secret bool
+}
+
+// configFields returns the settings of Config in declaration order
+func configFields() []configField {
+	t := reflect.TypeOf(Config{})
+	fields := make([]configField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		tag := t.Field(i).Tag.Get("envconfig")
+		if tag == "" {
+			continue
+		}
+		fields = append(fields, configField{
+			name:   strings.ToLower(tag),
+			envKey: tag,
+			index:  i,
+			secret: t.Field(i).Tag.Get("secret") == "true",
+		})
+	}
+	return fields
+}
+
+// SettingNames returns the names of all settings
+func SettingNames() []string {
+	fields := configFields()
+	names := make([]string, 0, len(fields))
+	for _, f := range fields {
+		names = append(names, f.name)
+	}
+	return names
+}
+
+// LoadConfig builds the effective configuration. Precedence, from lowest to highest:
+// defaults, the config file (base settings, then matching events, then matching
+// branches), unprefixed environment variables, and PLUGIN_* settings. Profiles are
+// applied on top by ApplyProfiles.
+func LoadConfig() (Config, ConfigSources, error) {
+	var cfg Config
+	if err := envconfig.Process("plugin", &cfg); err != nil {
+		return cfg, nil, fmt.Errorf("failed to parse configuration: %w", err)
+	}
+
+	sources := ConfigSources{}
+	for _, f := range configFields() {
+		switch {
+		case lookupEnvSet(envPrefix + f.envKey):
+			sources[f.name] = SourceSettings
+		case lookupEnvSet(f.envKey):
+			sources[f.name] = SourceEnv
+		default:
+			sources[f.name] = SourceDefault
+		}
+	}
+
+	if cfg.ConfigFile == "" {
+		return cfg, sources, nil
+	}
+	filePath := resolveTargetPath(cfg.Target, cfg.ConfigFile)
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		// The default config file is optional
+		if os.IsNotExist(err) && sources["config_file"] == SourceDefault {
+			return cfg, sources, nil
+		}
+		if os.IsNotExist(err) {
+			return cfg, sources, fmt.Errorf("%w: config_file %s", ErrFileNotFound, filePath)
+		}
+		return cfg, sources, fmt.Errorf("%w: %v", ErrFileRead, err)
+	}
+
+	if err := ApplyConfigFile(&cfg, data, sources, os.Getenv("DRONE_BRANCH"), os.Getenv("DRONE_BUILD_EVENT")); err != nil {
+		return cfg, sources, fmt.Errorf("config_file %s: %w", cfg.ConfigFile, err)
+	}
+	return cfg, sources, nil
+}
+
+// lookupEnvSet reports whether an environment variable is set to a non-empty value
+func lookupEnvSet(key string) bool {
+	value, ok := os.LookupEnv(key)
+	return ok && value != ""
+}
+
+// ApplyConfigFile merges a YAML config file into cfg. Settings already set in the
+// environment keep their value. Overrides under `events` apply when the pattern
+// matches event, then overrides under `branches` when it matches branch, in file
+// order. All problems are reported together.
+//
+//	model: gemini-2.5-flash
+//	include_dirs: [docs, api]
+//	events:
+//	  pull_request:
+//	    task: review
+//	branches:
+//	  main:
+//	    model: gemini-2.5-pro
+//	  "release/*":
+//	    budget_action: fail
+func ApplyConfigFile(cfg *Config, data []byte, sources ConfigSources, branch, event string) error {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidConfig, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("%w: expected a mapping of settings", ErrInvalidConfig)
+	}
+
+	var v validator
+	fields := map[string]configField{}
+	for _, f := range configFields() {
+		fields[f.name] = f
+	}
+
+	var overrides []*yaml.Node
+	for i := 0; i+1 < len(root.Content); i += 2 {
+		key, value := root.Content[i].Value, root.Content[i+1]
+		if key == configBranchesKey || key == configEventsKey {
+			overrides = append(overrides, root.Content[i], value)
+			continue
+		}
+		applyConfigValue(&v, cfg, fields, sources, key, value, SourceFile)
+	}
+
+	// Events first, so the more specific branch overrides win
+	for _, section := range []struct{ key, label, current string }{
+		{configEventsKey, "event", event},
+		{configBranchesKey, "branch", branch},
+	} {
+		for i := 0; i+1 < len(overrides); i += 2 {
+			if overrides[i].Value != section.key {
+				continue
+			}
+			applyConfigOverrides(&v, cfg, fields, sources, section.key, section.label, section.current, overrides[i+1])
+		}
+	}
+
+	return v.err()
+}
+
+// applyConfigOverrides applies the override blocks whose pattern matches current
+func applyConfigOverrides(v *validator, cfg *Config, fields map[string]configField, sources ConfigSources, section, label, current string, node *yaml.Node) {
+	if node.Kind != yaml.MappingNode {
+		v.addf("%s must map patterns to settings", section)
+		return
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		pattern, block := node.Content[i].Value, node.Content[i+1]
+		matched, err := path.Match(pattern, current)
+		if err != nil {
+			v.addf("%s pattern %q is invalid: %v", section, pattern, err)
+			continue
+		}
+		if !matched || current == "" {
+			continue
+		}
+		if block.Kind != yaml.MappingNode {
+			v.addf("%s.%s must be a mapping of settings", section, pattern)
+			continue
+		}
+		source := fmt.Sprintf("%s (%s %s)", SourceFile, label, pattern)
+		for j := 0; j+1 < len(block.Content); j += 2 {
+			applyConfigValue(v, cfg, fields, sources, block.Content[j].Value, block.Content[j+1], source)
+		}
+	}
+}
+
+// applyConfigValue decodes one setting into cfg unless the environment already set it
+func applyConfigValue(v *validator, cfg *Config, fields map[string]configField, sources ConfigSources, key string, node *yaml.Node, source string) {
+	f, ok := fields[key]
+	if !ok {
+		v.addf("unknown setting %q%s", key, suggestion(key, SettingNames()))
+		return
+	}
+	if configFileForbidden[key] {
+		v.addf("%s cannot be set in the config file; set it in the step settings", key)
+		return
+	}
+	if f.secret {
+		v.addf("%s must not be stored in the config file; use a Drone secret (from_secret)", key)
+		return
+	}
+
+	field := reflect.ValueOf(cfg).Elem().Field(f.index)
+	value, err := decodeConfigValue(field.Type(), node)
+	if err != nil {
+		v.addf("%s: %v", key, err)
+		return
+	}
+
+	if key == "profiles" {
+		checkFileProfiles(v, value.String())
+	}
+
+	if source := sources[key]; source == SourceEnv || source == SourceSettings {
+		return
+	}
+	field.Set(value)
+	sources[key] = source
+}
+
+// checkFileProfiles rejects profile overrides of settings the config file cannot
+// set, so a profile does not become a way around configFileForbidden. Other
+// problems with the profiles are reported when they are applied.
+func checkFileProfiles(v *validator, data string) {
+	profiles, err := ParseProfiles(data)
+	if err != nil {
+		return
+	}
+	for _, profile := range profiles {
+		for i := 0; i < len(profile.settings); i += 2 {
+			if key := profile.settings[i].Value; configFileForbidden[key] {
+				v.addf("profile %q: %s cannot be set in the config file; set the profiles setting in the step settings", profile.Name, key)
+			}
+		}
+	}
+}
+
+// decodeConfigValue decodes a YAML value into a setting of type typ. A list of
+// scalars is joined with commas for settings such as include_dirs; other
+// structured values, such as profiles, are kept as YAML.
+func decodeConfigValue(typ reflect.Type, node *yaml.Node) (reflect.Value, error) {
+	value := reflect.New(typ).Elem()
+	if typ.Kind() == reflect.String && node.Kind != yaml.ScalarNode {
+		var items []string
+		if node.Kind == yaml.SequenceNode && node.Decode(&items) == nil {
+			value.SetString(strings.Join(items, ","))
+			return value, nil
+		}
+		data, err := yaml.Marshal(node)
+		if err != nil {
+			return value, err
+		}
+		value.SetString(string(data))
+		return value, nil
+	}
+	if err := node.Decode(value.Addr().Interface()); err != nil {
+		return value, fmt.Errorf("expected %s, got %q", typ, node.Value)
+	}
+	return value, nil
+}
+
+// FormatConfig renders the effective configuration as YAML, annotating each
+// setting with its source. Secrets are masked.
+func FormatConfig(cfg *Config, sources ConfigSources) (string, error) {
+	mapping := &yaml.Node{Kind: yaml.MappingNode}
+	value := reflect.ValueOf(cfg).Elem()
+
+	for _, f := range configFields() {
+		field := value.Field(f.index)
+		var text string
+		switch field.Kind() {
+		case reflect.String:
+			text = field.String()
+		case reflect.Bool:
+			text = strconv.FormatBool(field.Bool())
+		case reflect.Int:
+			text = strconv.FormatInt(field.Int(), 10)
+		case reflect.Float64:
+			text = strconv.FormatFloat(field.Float(), 'f', -1, 64)
+		default:
+			text = fmt.Sprint(field.Interface())
+		}
+
+		switch {
+		case f.secret && text != "":
+			text = "********"
+		case strings.Contains(text, "://"):
+			text = redactURL(text)
+		}
+
+		valueNode := &yaml.Node{Kind: yaml.ScalarNode, Value: text, LineComment: sources[f.name]}
+		if field.Kind() == reflect.String {
+			valueNode.Tag = "!!str"
+			if strings.Contains(text, "\n") {
+				valueNode.Style = yaml.LiteralStyle
+			}
+		}
+		mapping.Content = append(mapping.Content, &yaml.Node{Kind: yaml.ScalarNode, Value: f.name}, valueNode)
+	}
+
+	data, err := yaml.Marshal(mapping)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// RunConfigCommand implements the config subcommand.
+//
+//	drone-gemini-cli-plugin config print
+func RunConfigCommand(args []string, out io.Writer) error {
+	if len(args) == 0 || args[0] != "print" {
+		return fmt.Errorf("usage: config print")
+	}
+
+	cfg, sources, err := LoadConfig()
+	if err != nil {
+		return err
+	}
+	match, err := ApplyProfiles(&cfg, sources, BuildContextFromEnv())
+	if err != nil {
+		return err
+	}
+	text, err := FormatConfig(&cfg, sources)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "# Effective configuration (config file: %s)\n", resolveTargetPath(cfg.Target, cfg.ConfigFile))
+	fmt.Fprintln(out, "# Precedence: default < file < env < settings < profile")
+	if match != nil {
+		fmt.Fprintf(out, "# Profile: %s\n", match)
+	}
+	_, err = io.WriteString(out, text)
+	return err
+}
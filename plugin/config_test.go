@@ -1,6 +1,8 @@
 package plugin
 
 import (
+	"errors"
+	"strings"
 	"testing"
 )
 
@@ -18,7 +20,8 @@ func TestConfigValidate(t *testing.T) {
 		{
 			name: "valid config with prompt",
 			config: Config{
-				Prompt: "test prompt",
+				Prompt:  "test prompt",
+				Timeout: 300,
 			},
 			wantErr: false,
 		},
@@ -26,6 +29,7 @@ func TestConfigValidate(t *testing.T) {
 			name: "prompt_file without prompt should pass validation",
 			config: Config{
 				PromptFile: "review.md",
+				Timeout:    300,
 			},
 			wantErr: false,
 		},
@@ -34,9 +38,182 @@ func TestConfigValidate(t *testing.T) {
 			config: Config{
 				Prompt:     "fallback prompt",
 				PromptFile: "review.md",
+				Timeout:    300,
+			},
+			wantErr: false,
+		},
+		{
+			name: "task without prompt should pass",
+			config: Config{
+				Task:    "review",
+				Timeout: 300,
+			},
+			wantErr: false,
+		},
+		{
+			name: "unknown task should fail",
+			config: Config{
+				Task: "reveiw",
+			},
+			wantErr: true,
+		},
+		{
+			name: "markdown report format should pass",
+			config: Config{
+				Prompt:       "test prompt",
+				ReportFormat: "markdown",
+				Timeout:      300,
+			},
+			wantErr: false,
+		},
+		{
+			name: "unknown report format should fail",
+			config: Config{
+				Prompt:       "test prompt",
+				ReportFormat: "html",
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing timeout should fail",
+			config: Config{
+				Prompt: "test prompt",
+			},
+			wantErr: true,
+		},
+		{
+			name: "misspelled output format should fail",
+			config: Config{
+				Prompt:       "test prompt",
+				OutputFormat: "jsn",
+				Timeout:      300,
+			},
+			wantErr: true,
+		},
+		{
+			name: "misspelled approval mode should fail",
+			config: Config{
+				Prompt:       "test prompt",
+				ApprovalMode: "autoedit",
+				Timeout:      300,
+			},
+			wantErr: true,
+		},
+		{
+			name: "missing target should fail",
+			config: Config{
+				Prompt:  "test prompt",
+				Target:  "does-not-exist",
+				Timeout: 300,
+			},
+			wantErr: true,
+		},
+		{
+			name: "gcp project without credentials should fail",
+			config: Config{
+				Prompt:     "test prompt",
+				GCPProject: "my-project",
+				Timeout:    300,
+			},
+			wantErr: true,
+		},
+		{
+			name: "model close to a priced model should pass",
+			config: Config{
+				Prompt:  "test prompt",
+				Model:   "gemini-2.5-pro-002",
+				Timeout: 300,
+			},
+			wantErr: false,
+		},
+		{
+			name: "unpriced new model should pass",
+			config: Config{
+				Prompt:  "test prompt",
+				Model:   "my-tuned-model",
+				Timeout: 300,
 			},
 			wantErr: false,
 		},
+		{
+			name: "push_changes without yolo should fail",
+			config: Config{
+				Prompt:      "test prompt",
+				Model:       "gemini-2.5-pro",
+				Timeout:     300,
+				PushChanges: true,
+				PushBranch:  "gemini/fix-{build}",
+				PushRemote:  "origin",
+			},
+			wantErr: true,
+		},
+		{
+			name: "push_changes with yolo should pass",
+			config: Config{
+				Prompt:      "test prompt",
+				Model:       "gemini-2.5-pro",
+				Timeout:     300,
+				Yolo:        true,
+				PushChanges: true,
+				PushBranch:  "gemini/fix-{build}",
+				PushRemote:  "origin",
+			},
+			wantErr: false,
+		},
+		{
+			name: "pull_request without push_changes should fail",
+			config: Config{
+				Prompt:      "test prompt",
+				Model:       "gemini-2.5-pro",
+				Timeout:     300,
+				Yolo:        true,
+				PullRequest: true,
+			},
+			wantErr: true,
+		},
+		{
+			name: "verify_command without yolo should fail",
+			config: Config{
+				Prompt:           "test prompt",
+				Model:            "gemini-2.5-pro",
+				Timeout:          300,
+				VerifyCommand:    "go test ./...",
+				VerifyMaxRepairs: 2,
+				VerifyTimeout:    600,
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid env_passthrough pattern should fail",
+			config: Config{
+				Prompt:         "test prompt",
+				Model:          "gemini-2.5-pro",
+				Timeout:        300,
+				EnvPassthrough: "GOFLAGS,NPM_[",
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative timeout_grace should fail",
+			config: Config{
+				Prompt:       "test prompt",
+				Model:        "gemini-2.5-pro",
+				Timeout:      300,
+				TimeoutGrace: -1,
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative sandbox limit should fail",
+			config: Config{
+				Prompt:        "test prompt",
+				Model:         "gemini-2.5-pro",
+				Timeout:       300,
+				Sandbox:       true,
+				SandboxMemory: -1,
+			},
+			wantErr: true,
+		},
 		{
 			name: "full config should pass",
 			config: Config{
@@ -116,3 +293,55 @@ func TestDetectAuthMode(t *testing.T) {
 		})
 	}
 }
+
+func TestValidateCollectsAllProblems(t *testing.T) {
+	cfg := Config{
+		OutputFormat: "jsn",
+		ApprovalMode: "autoedit",
+		BudgetAction: "warning",
+		Task:         "reveiw",
+	}
+	err := cfg.Validate()
+
+	var verr *ValidationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("Validate() error = %v, want *ValidationError", err)
+	}
+	if len(verr.Problems) != 5 {
+		t.Errorf("Validate() found %d problems, want 5:\n%v", len(verr.Problems), err)
+	}
+	if !errors.Is(err, ErrInvalidConfig) || !errors.Is(err, ErrUnknownTask) {
+		t.Errorf("Validate() error should match ErrInvalidConfig and ErrUnknownTask: %v", err)
+	}
+
+	for _, want := range []string{
+		`did you mean "json"?`,
+		`did you mean "auto_edit"?`,
+		`did you mean "warn"?`,
+		`did you mean "review"?`,
+		"timeout must be greater than 0",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate() error missing %q:\n%v", want, err)
+		}
+	}
+}
+
+func TestClosestMatch(t *testing.T) {
+	tests := []struct {
+		value string
+		want  string
+		ok    bool
+	}{
+		{"jsn", "json", true},
+		{"JSON", "json", true},
+		{"stream_json", "stream-json", true},
+		{"yaml", "", false},
+	}
+	for _, tt := range tests {
+		got, ok := closestMatch(tt.value, OutputFormats, 1+len(tt.value)/3)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("closestMatch(%q) = %q, %v, want %q, %v", tt.value, got, ok, tt.want, tt.ok)
+		}
+	}
+}
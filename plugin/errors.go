@@ -4,7 +4,16 @@ import "errors"
 
 var (
 	// ErrPromptRequired is returned when no prompt is provided
-	ErrPromptRequired = errors.New("prompt is required: set PLUGIN_PROMPT or PLUGIN_PROMPT_FILE")
+	ErrPromptRequired = errors.New("prompt is required: set PLUGIN_PROMPT, PLUGIN_PROMPT_FILE or PLUGIN_TASK")
+
+	// ErrInvalidConfig is returned when one or more settings are invalid
+	ErrInvalidConfig = errors.New("invalid configuration")
+
+	// ErrUnknownTask is returned when the task is not a built-in preset
+	ErrUnknownTask = errors.New("unknown task")
+
+	// ErrUnknownReportFormat is returned when the report format has no renderer
+	ErrUnknownReportFormat = errors.New("unknown report format")
 
 	// ErrGeminiCLINotFound is returned when gemini CLI is not installed
 	ErrGeminiCLINotFound = errors.New("gemini CLI not found: ensure gemini is installed and in PATH")
@@ -18,9 +27,30 @@ var (
 	// ErrTimeout is returned when CLI execution times out
 	ErrTimeout = errors.New("gemini CLI execution timed out")
 
+	// ErrCancelled is returned when the run is cancelled, e.g. by SIGTERM when Drone cancels the build
+	ErrCancelled = errors.New("gemini CLI execution was cancelled")
+
 	// ErrFileNotFound is returned when a specified file does not exist
 	ErrFileNotFound = errors.New("specified file not found")
 
+	// ErrBudgetExceeded is returned when a run exceeds max_tokens or max_cost_usd
+	ErrBudgetExceeded = errors.New("budget exceeded")
+
+	// ErrFindingsGate is returned when the response reports findings at or above fail_on
+	ErrFindingsGate = errors.New("findings at or above fail_on severity")
+
+	// ErrPathViolation is returned when the agent changed files outside the allowed paths
+	ErrPathViolation = errors.New("files changed outside the allowed paths")
+
+	// ErrProtectedBranch is returned when yolo or auto_edit is used on a protected build
+	ErrProtectedBranch = errors.New("file modifications are not allowed on this build")
+
+	// ErrVerifyFailed is returned when verify_command still fails after the repair runs
+	ErrVerifyFailed = errors.New("verify_command failed")
+
+	// ErrPullRequest is returned when a pull request cannot be opened or updated
+	ErrPullRequest = errors.New("failed to open pull request")
+
 	// ErrFileRead is returned when a file cannot be read
 	ErrFileRead = errors.New("failed to read file")
 )
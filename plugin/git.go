@@ -2,9 +2,11 @@ package plugin
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"os"
 	"os/exec"
+	"sort"
 	"strings"
 )
 
@@ -14,13 +16,16 @@ type CommitInfo struct {
 	Author    string
 	Email     string
 	Message   string
+	Body      string
 	Timestamp string
+	IsMerge   bool
 }
 
 // GitAnalyzer handles git operations for code review
 type GitAnalyzer struct {
 	repoPath string
 	debug    bool
+	ctx      context.Context
 }
 
 // NewGitAnalyzer creates a new git analyzer
@@ -28,9 +33,18 @@ func NewGitAnalyzer(repoPath string, debug bool) *GitAnalyzer {
 	return &GitAnalyzer{
 		repoPath: repoPath,
 		debug:    debug,
+		ctx:      context.Background(),
 	}
 }
 
+// WithContext sets the context whose cancellation kills running git commands.
+// Snapshots, restores and pushes keep the background context so a cancelled run
+// can still revert and capture its changes.
+func (g *GitAnalyzer) WithContext(ctx context.Context) *GitAnalyzer {
+	g.ctx = ctx
+	return g
+}
+
 // DetectCommitSHA detects the commit SHA from environment or git
 func (g *GitAnalyzer) DetectCommitSHA(configSHA string) string {
 	// Priority 1: Explicit configuration
@@ -155,6 +169,57 @@ func (g *GitAnalyzer) GetDiffStats(sha string) (string, error) {
 	return output, nil
 }
 
+// GetCommitMessages returns the commits in a revision range with their full messages.
+// A single SHA returns only that commit.
+func (g *GitAnalyzer) GetCommitMessages(revRange string) ([]CommitInfo, error) {
+	if strings.Contains(revRange, "..") {
+		return g.logCommits(revRange)
+	}
+	return g.logCommits("-1", revRange)
+}
+
+// GetChangedFunctions returns the enclosing function of every changed hunk,
+// grouped by file, as reported in git's hunk headers
+func (g *GitAnalyzer) GetChangedFunctions(sha string) (map[string][]string, error) {
+	output, err := g.commitDiff(sha, "--unified=0")
+	if err != nil {
+		return nil, fmt.Errorf("failed to get changed functions: %w", err)
+	}
+
+	functions := make(map[string][]string)
+	seen := make(map[string]bool)
+	file := ""
+	for _, line := range strings.Split(output, "\n") {
+		switch {
+		case strings.HasPrefix(line, "+++ "):
+			file = strings.TrimPrefix(strings.TrimPrefix(line, "+++ "), "b/")
+		case strings.HasPrefix(line, "@@"):
+			// @@ -10,2 +10,3 @@ func (p *Plugin) Exec() error
+			parts := strings.SplitN(line, "@@", 3)
+			if len(parts) < 3 {
+				continue
+			}
+			fn := strings.TrimSpace(parts[2])
+			if fn == "" || file == "" || file == "/dev/null" || seen[file+"\x00"+fn] {
+				continue
+			}
+			seen[file+"\x00"+fn] = true
+			functions[file] = append(functions[file], fn)
+		}
+	}
+
+	return functions, nil
+}
+
+// GetFunctionContextDiff returns the diff of a commit with whole enclosing functions as context
+func (g *GitAnalyzer) GetFunctionContextDiff(sha string) (string, error) {
+	output, err := g.commitDiff(sha, "--function-context")
+	if err != nil {
+		return "", fmt.Errorf("failed to get function context diff: %w", err)
+	}
+	return output, nil
+}
+
 // IsGitRepository checks if the path is a git repository
 func (g *GitAnalyzer) IsGitRepository() bool {
 	_, err := g.runGitCommand("rev-parse", "--git-dir")
@@ -200,12 +265,36 @@ func (g *GitAnalyzer) BuildGitContext(sha string) (string, error) {
 	diff, err := g.GetCommitDiff(sha)
 	if err == nil && diff != "" {
 		context.WriteString("=== Commit Diff ===\n")
-		// Limit diff size to ~50KB to leave room for code context
-		if len(diff) > 50000 {
-			context.WriteString(diff[:50000])
-			context.WriteString("\n... [diff truncated due to size] ...\n")
-		} else {
-			context.WriteString(diff)
+		context.WriteString(truncateDiff(diff))
+		context.WriteString("\n")
+	}
+
+	return context.String(), nil
+}
+
+// BuildCommitMessagesContext builds a context string with only the commit messages
+// between base and sha (or the single commit sha when base is empty)
+func (g *GitAnalyzer) BuildCommitMessagesContext(sha, base string) (string, error) {
+	revRange := sha
+	if base != "" {
+		revRange = base + ".." + sha
+	}
+
+	commits, err := g.GetCommitMessages(revRange)
+	if err != nil {
+		return "", err
+	}
+
+	var context strings.Builder
+	context.WriteString("=== Commit Messages ===\n")
+	for _, c := range commits {
+		context.WriteString(fmt.Sprintf("--- %s ---\n", shortSHA(c.SHA)))
+		context.WriteString(c.Message)
+		context.WriteString("\n")
+		if c.Body != "" {
+			context.WriteString("\n")
+			context.WriteString(c.Body)
+			context.WriteString("\n")
 		}
 		context.WriteString("\n")
 	}
@@ -213,10 +302,122 @@ func (g *GitAnalyzer) BuildGitContext(sha string) (string, error) {
 	return context.String(), nil
 }
 
+// BuildChangedFunctionsContext builds a context string with the functions touched by a commit
+func (g *GitAnalyzer) BuildChangedFunctionsContext(sha string) (string, error) {
+	var context strings.Builder
+
+	functions, err := g.GetChangedFunctions(sha)
+	if err != nil {
+		return "", err
+	}
+
+	context.WriteString("=== Changed Functions ===\n")
+	files := make([]string, 0, len(functions))
+	for file := range functions {
+		files = append(files, file)
+	}
+	sort.Strings(files)
+	for _, file := range files {
+		context.WriteString(fmt.Sprintf("%s:\n", file))
+		for _, name := range functions[file] {
+			context.WriteString(fmt.Sprintf("- %s\n", name))
+		}
+	}
+	context.WriteString("\n")
+
+	diff, err := g.GetFunctionContextDiff(sha)
+	if err == nil && diff != "" {
+		context.WriteString("=== Function Diff ===\n")
+		context.WriteString(truncateDiff(diff))
+		context.WriteString("\n")
+	}
+
+	return context.String(), nil
+}
+
+// logCommits runs git log with the given arguments and parses the commits
+func (g *GitAnalyzer) logCommits(args ...string) ([]CommitInfo, error) {
+	args = append([]string{"log", "--format=%H%x1f%an%x1f%ae%x1f%ci%x1f%P%x1f%s%x1f%b%x1e"}, args...)
+	output, err := g.runGitCommand(args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get commit messages: %w", err)
+	}
+
+	var commits []CommitInfo
+	for _, record := range strings.Split(output, "\x1e") {
+		record = strings.TrimSpace(record)
+		if record == "" {
+			continue
+		}
+		fields := strings.Split(record, "\x1f")
+		if len(fields) < 7 {
+			continue
+		}
+		commits = append(commits, CommitInfo{
+			SHA:       fields[0],
+			Author:    fields[1],
+			Email:     fields[2],
+			Timestamp: fields[3],
+			IsMerge:   len(strings.Fields(fields[4])) > 1,
+			Message:   fields[5],
+			Body:      strings.TrimSpace(fields[6]),
+		})
+	}
+
+	return commits, nil
+}
+
+// commitDiff returns the diff of a commit against its parent with extra diff options,
+// falling back to git show for the initial commit
+func (g *GitAnalyzer) commitDiff(sha string, opts ...string) (string, error) {
+	if sha == "" {
+		sha = "HEAD"
+	}
+
+	args := append([]string{"diff", sha + "^.." + sha}, opts...)
+	output, err := g.runGitCommand(args...)
+	if err != nil {
+		args = append([]string{"show", sha, "--format="}, opts...)
+		output, err = g.runGitCommand(args...)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return output, nil
+}
+
+// maxDiffSize limits diff context to ~50KB to leave room for code context
+const maxDiffSize = 50000
+
+// truncateDiff limits a diff to maxDiffSize bytes
+func truncateDiff(diff string) string {
+	if len(diff) > maxDiffSize {
+		return diff[:maxDiffSize] + "\n... [diff truncated due to size] ...\n"
+	}
+	return diff
+}
+
+// shortSHA returns the abbreviated form of a commit SHA
+func shortSHA(sha string) string {
+	if len(sha) > 12 {
+		return sha[:12]
+	}
+	return sha
+}
+
 // runGitCommand executes a git command and returns the output
 func (g *GitAnalyzer) runGitCommand(args ...string) (string, error) {
-	cmd := exec.Command("git", args...)
+	return g.runGitCommandEnv(nil, args...)
+}
+
+// runGitCommandEnv executes a git command with extra environment variables
+func (g *GitAnalyzer) runGitCommandEnv(env []string, args ...string) (string, error) {
+	cmd := exec.CommandContext(g.ctx, "git", args...)
 	cmd.Dir = g.repoPath
+	if len(env) > 0 {
+		cmd.Env = append(os.Environ(), env...)
+	}
 
 	var stdout, stderr bytes.Buffer
 	cmd.Stdout = &stdout
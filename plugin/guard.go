@@ -0,0 +1,270 @@
+package plugin
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// PathChange is a file added, modified or deleted between two worktree snapshots
+type PathChange struct {
+	Status string // A (added), M (modified), D (deleted) or T (type changed)
+	Path   string // relative to the repository root
+}
+
+// WorktreeSnapshot is the working tree, including uncommitted and untracked files,
+// captured as a git tree object. Files ignored by .gitignore are not included.
+type WorktreeSnapshot struct {
+	Root string
+	Tree string
+	Head string // commit checked out when the snapshot was taken, "" without commits
+}
+
+// SnapshotWorktree captures the working tree without touching the repository's
+// index: files are staged into a temporary index and written as a tree.
+func (g *GitAnalyzer) SnapshotWorktree() (*WorktreeSnapshot, error) {
+	root, err := g.runGitCommand("rev-parse", "--show-toplevel")
+	if err != nil {
+		return nil, fmt.Errorf("not a git repository: %s", g.repoPath)
+	}
+	rootGit := NewGitAnalyzer(strings.TrimSpace(root), g.debug)
+
+	tree, err := rootGit.writeWorktreeTree()
+	if err != nil {
+		return nil, err
+	}
+	head := rootGit.headSHA()
+	if g.debug {
+		fmt.Printf("[DEBUG] Worktree snapshot: %s (HEAD %s)\n", shortSHA(tree), shortSHA(head))
+	}
+	return &WorktreeSnapshot{Root: rootGit.repoPath, Tree: tree, Head: head}, nil
+}
+
+// headSHA returns the commit HEAD points to, or "" in a repository without commits
+func (g *GitAnalyzer) headSHA() string {
+	head, err := g.runGitCommand("rev-parse", "--verify", "-q", "HEAD")
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(head)
+}
+
+// writeWorktreeTree stages the working tree into a temporary index and returns its tree
+func (g *GitAnalyzer) writeWorktreeTree() (string, error) {
+	dir, err := os.MkdirTemp("", "gemini-index-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+	index := filepath.Join(dir, "index")
+
+	// Start from a copy of the real index so unchanged files are not hashed again
+	if realIndex, err := g.runGitCommand("rev-parse", "--path-format=absolute", "--git-path", "index"); err == nil {
+		if err := copyFile(strings.TrimSpace(realIndex), index); err != nil && !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+
+	env := []string{"GIT_INDEX_FILE=" + index}
+	if _, err := g.runGitCommandEnv(env, "add", "-A", "."); err != nil {
+		return "", fmt.Errorf("failed to snapshot worktree: %w", err)
+	}
+	tree, err := g.runGitCommandEnv(env, "write-tree")
+	if err != nil {
+		return "", fmt.Errorf("failed to snapshot worktree: %w", err)
+	}
+	return strings.TrimSpace(tree), nil
+}
+
+// Changes returns the files changed in the working tree since the snapshot
+func (s *WorktreeSnapshot) Changes() ([]PathChange, error) {
+	git := NewGitAnalyzer(s.Root, false)
+	tree, err := git.writeWorktreeTree()
+	if err != nil {
+		return nil, err
+	}
+	if tree == s.Tree {
+		return nil, nil
+	}
+	return git.changedPaths(s.Tree, tree)
+}
+
+// changedPaths lists the files that differ between two trees
+func (g *GitAnalyzer) changedPaths(from, to string) ([]PathChange, error) {
+	output, err := g.runGitCommand("diff-tree", "-r", "-z", "--no-renames", "--name-status", from, to)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare worktree: %w", err)
+	}
+
+	// -z output alternates status and path, each NUL-terminated
+	fields := strings.Split(strings.TrimRight(output, "\x00"), "\x00")
+	var changes []PathChange
+	for i := 0; i+1 < len(fields); i += 2 {
+		changes = append(changes, PathChange{Status: fields[i], Path: fields[i+1]})
+	}
+	return changes, nil
+}
+
+// Restore reverts changed files to their content in the snapshot and removes added files
+func (s *WorktreeSnapshot) Restore(changes []PathChange) error {
+	var restore []string
+	for _, change := range changes {
+		if change.Status == "A" {
+			if err := os.Remove(filepath.Join(s.Root, filepath.FromSlash(change.Path))); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		}
+		restore = append(restore, change.Path)
+	}
+	if len(restore) == 0 {
+		return nil
+	}
+
+	// Only the working tree is restored; literal pathspecs keep glob characters in names inert
+	git := NewGitAnalyzer(s.Root, false)
+	args := append([]string{"restore", "--source=" + s.Tree, "--worktree", "--"}, restore...)
+	if _, err := git.runGitCommandEnv([]string{"GIT_LITERAL_PATHSPECS=1"}, args...); err != nil {
+		return fmt.Errorf("failed to restore files: %w", err)
+	}
+	return nil
+}
+
+// withoutPaths drops the changes to the given files
+func withoutPaths(changes []PathChange, exclude []string) []PathChange {
+	if len(exclude) == 0 {
+		return changes
+	}
+	var kept []PathChange
+	for _, change := range changes {
+		if !containsString(exclude, change.Path) {
+			kept = append(kept, change)
+		}
+	}
+	return kept
+}
+
+// PathGuard decides which files the agent may change
+type PathGuard struct {
+	Allowed   []string
+	Protected []string
+}
+
+// NewPathGuard creates a guard from the allowed_paths and protected_paths settings
+func NewPathGuard(cfg *Config) *PathGuard {
+	return &PathGuard{
+		Allowed:   splitList(cfg.AllowedPaths),
+		Protected: splitList(cfg.ProtectedPaths),
+	}
+}
+
+// Enabled reports whether any path is restricted
+func (g *PathGuard) Enabled() bool {
+	return len(g.Allowed) > 0 || len(g.Protected) > 0
+}
+
+// Check returns why a file may not be changed, or "" when it may.
+// Protected paths win over allowed paths.
+func (g *PathGuard) Check(name string) string {
+	for _, pattern := range g.Protected {
+		if MatchPathGlob(pattern, name) {
+			return fmt.Sprintf("protected by %q", pattern)
+		}
+	}
+	if len(g.Allowed) == 0 {
+		return ""
+	}
+	for _, pattern := range g.Allowed {
+		if MatchPathGlob(pattern, name) {
+			return ""
+		}
+	}
+	return "not in allowed_paths"
+}
+
+// PathViolation is a change the guard does not allow
+type PathViolation struct {
+	PathChange
+	Reason string
+}
+
+// Violations returns the changes the guard does not allow
+func (g *PathGuard) Violations(changes []PathChange) []PathViolation {
+	var violations []PathViolation
+	for _, change := range changes {
+		if reason := g.Check(change.Path); reason != "" {
+			violations = append(violations, PathViolation{PathChange: change, Reason: reason})
+		}
+	}
+	return violations
+}
+
+// MatchPathGlob matches a slash-separated path against a glob. `**` matches any
+// number of directories, a pattern without a slash matches the file name at any
+// depth (like .gitignore), and a trailing slash matches everything below a directory.
+func MatchPathGlob(pattern, name string) bool {
+	pattern = strings.TrimPrefix(pattern, "/")
+	if strings.HasSuffix(pattern, "/") {
+		pattern += "**"
+	}
+	if !strings.Contains(pattern, "/") {
+		matched, _ := path.Match(pattern, path.Base(name))
+		return matched
+	}
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+// matchSegments matches path segments, expanding ** to zero or more segments
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(pattern[0], name[0]); !matched {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// splitList splits a comma-separated setting, dropping empty items
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// copyFile copies src to dst
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
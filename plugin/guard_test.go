@@ -0,0 +1,155 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestMatchPathGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{".drone.yml", ".drone.yml", true},
+		{".drone.yml", "sub/.drone.yml", true},
+		{"*.md", "docs/guide/intro.md", true},
+		{"*.md", "main.go", false},
+		{"docs/", "docs/guide/intro.md", true},
+		{"docs/**", "docs/a.md", true},
+		{"docs/**", "doc/a.md", false},
+		{"src/**/*.go", "src/main.go", true},
+		{"src/**/*.go", "src/pkg/util/strings.go", true},
+		{"src/**/*.go", "src/pkg/README.md", false},
+		{"/ci/*.yml", "ci/build.yml", true},
+		{"ci/*.yml", "ci/nested/build.yml", false},
+		{"**/secrets/**", "deploy/secrets/prod.env", true},
+	}
+
+	for _, tt := range tests {
+		if got := MatchPathGlob(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("MatchPathGlob(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPathGuardCheck(t *testing.T) {
+	guard := NewPathGuard(&Config{AllowedPaths: "src/**, docs/", ProtectedPaths: ".drone.yml,src/secrets/**"})
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"src/main.go", ""},
+		{"docs/a.md", ""},
+		{".drone.yml", `protected by ".drone.yml"`},
+		{"src/secrets/key.pem", `protected by "src/secrets/**"`},
+		{"Makefile", "not in allowed_paths"},
+	}
+	for _, tt := range tests {
+		if got := guard.Check(tt.name); got != tt.want {
+			t.Errorf("Check(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+
+	if NewPathGuard(&Config{}).Enabled() {
+		t.Error("Enabled() = true without paths")
+	}
+}
+
+func TestEnforcePaths(t *testing.T) {
+	dir := newTestRepo(t)
+	commitFile(t, dir, ".drone.yml", "kind: pipeline\n", "ci")
+	commitFile(t, dir, "src/main.go", "package main\n", "main")
+	commitFile(t, dir, "Makefile", "all:\n", "make")
+
+	// Uncommitted work from earlier steps is part of the snapshot, not a violation
+	writeTestFile(t, dir, "build/output.txt", "artifact\n")
+
+	p := New(Config{Target: dir, Yolo: true, AllowedPaths: "src/**,build/**", ProtectedPaths: ".drone.yml"})
+	snapshot, err := p.snapshotWorktree()
+	if err != nil || snapshot == nil {
+		t.Fatalf("snapshotWorktree() = %v, %v", snapshot, err)
+	}
+	// The repository's own index is untouched
+	if status := runGit(t, dir, "status", "--porcelain"); status != "?? build/" {
+		t.Fatalf("git status after snapshot = %q", status)
+	}
+
+	// The agent edits allowed and protected files, adds and deletes files
+	writeTestFile(t, dir, "src/main.go", "package main\n\nfunc main() {}\n")
+	writeTestFile(t, dir, "src/util.go", "package main\n")
+	writeTestFile(t, dir, ".drone.yml", "kind: pipeline\nsteps: []\n")
+	writeTestFile(t, dir, "deploy.sh", "curl evil\n")
+	if err := os.Remove(filepath.Join(dir, "Makefile")); err != nil {
+		t.Fatal(err)
+	}
+
+	err = p.enforcePaths(context.Background(), snapshot)
+	if !errors.Is(err, ErrPathViolation) {
+		t.Fatalf("enforcePaths() error = %v, want ErrPathViolation", err)
+	}
+	for _, file := range []string{".drone.yml", "Makefile", "deploy.sh"} {
+		if !strings.Contains(err.Error(), file) {
+			t.Errorf("enforcePaths() error %q does not list %s", err, file)
+		}
+	}
+	if strings.Contains(err.Error(), "src/") {
+		t.Errorf("enforcePaths() error %q lists allowed files", err)
+	}
+
+	// Violations are reverted, allowed changes are kept
+	for name, want := range map[string]string{
+		".drone.yml":  "kind: pipeline\n",
+		"Makefile":    "all:\n",
+		"src/main.go": "package main\n\nfunc main() {}\n",
+		"src/util.go": "package main\n",
+	} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil || string(data) != want {
+			t.Errorf("%s = %q, %v; want %q", name, data, err, want)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "deploy.sh")); !os.IsNotExist(err) {
+		t.Errorf("added file deploy.sh was not removed: %v", err)
+	}
+
+	// A clean run passes
+	snapshot, _ = p.snapshotWorktree()
+	if err := p.enforcePaths(context.Background(), snapshot); err != nil {
+		t.Errorf("enforcePaths() without changes error: %v", err)
+	}
+}
+
+func TestSnapshotWorktreeSkipped(t *testing.T) {
+	for _, cfg := range []Config{
+		{Target: t.TempDir()},
+		{Target: t.TempDir(), Yolo: true, ReplayFile: "run.json", ProtectedPaths: ".drone.yml"},
+		{Target: t.TempDir(), Yolo: true, ProtectedPaths: ".drone.yml"}, // not a git repository: warning only
+	} {
+		if snapshot, err := New(cfg).snapshotWorktree(); snapshot != nil || err != nil {
+			t.Errorf("snapshotWorktree(%+v) = %v, %v; want skipped", cfg, snapshot, err)
+		}
+	}
+
+	_, err := New(Config{Target: t.TempDir(), Yolo: true, AllowedPaths: "src/**"}).snapshotWorktree()
+	if err == nil {
+		t.Error("snapshotWorktree() with allowed_paths outside a git repository should fail")
+	}
+}
+
+// writeTestFile writes a file below dir, creating parent directories
+func writeTestFile(t *testing.T, dir, name, content string) {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
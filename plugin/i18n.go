@@ -0,0 +1,184 @@
+package plugin
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Supported locales
+const (
+	LocaleEnglish = "en"
+	LocaleChinese = "zh"
+)
+
+// Catalog holds the translated messages of one locale
+type Catalog map[string]string
+
+// catalogs contains the message catalogs for every supported locale.
+// Every key must exist in the English catalog, which is the fallback.
+var catalogs = map[string]Catalog{
+	LocaleEnglish: {
+		"stats.title":           "📊 Execution Statistics",
+		"stats.models":          "🤖 Model Usage:",
+		"stats.requests":        "Requests: %d, Errors: %d, Latency: %dms",
+		"stats.tokens":          "Input: %d, Output: %d, Cached: %d",
+		"stats.thoughts":        "🧠 Thought Tokens: %d",
+		"stats.tool_tokens":     "🔧 Tool Tokens: %d",
+		"stats.cost":            "💵 Cost: %s",
+		"stats.cost_input":      "Input %s, Cached %s, Tool %s",
+		"stats.cost_output":     "Output %s, Thoughts %s",
+		"stats.long_context":    "[long context]",
+		"stats.no_pricing":      "(no pricing)",
+		"stats.total_input":     "Total Input Tokens: %d",
+		"stats.total_output":    "Total Output Tokens: %d",
+		"stats.total_thoughts":  "🧠 Total Thought Tokens: %d",
+		"stats.total_cost":      "💵 Estimated Cost: %s",
+		"stats.tools":           "🔧 Tool Calls:",
+		"stats.tool_calls":      "Total: %d, Success: %d, Failed: %d",
+		"stats.tool_duration":   "Total Duration: %dms",
+		"stats.tool_details":    "Tool Details:",
+		"stats.tool_detail":     "- %s: %d calls (%dms)",
+		"stats.files":           "📁 File Changes:",
+		"stats.lines":           "+%d lines added, -%d lines removed",
+		"report.title":          "AI Response",
+		"report.cached":         "(cached)",
+		"report.partial":        "(partial)",
+		"report.no_response":    "No response received",
+		"report.warning":        "Warning: %s",
+		"report.exit_code":      "Exit Code: %d",
+		"report.model":          "Model: %s",
+		"report.task":           "Task: %s",
+		"report.total":          "Total",
+		"report.col_model":      "Model",
+		"report.col_requests":   "Requests",
+		"report.col_input":      "Input",
+		"report.col_output":     "Output",
+		"report.col_cached":     "Cached",
+		"report.col_thoughts":   "Thoughts",
+		"report.col_cost":       "Cost",
+		"report.changes":        "Changes",
+		"report.changes_count":  "%d files changed, +%d -%d",
+		"report.patch":          "Patch",
+		"report.patch_cut":      "(truncated, see the patch file for the full diff)",
+		"report.body_cut":       "(truncated, see the build log for the full response)",
+		"report.verify":         "Verification",
+		"report.verify_attempt": "Attempt %d",
+		"report.verify_passed":  "passed",
+		"report.verify_failed":  "failed (exit %d)",
+		"report.verify_timeout": "timed out",
+		"report.verify_stopped": "Stopped: %s",
+		"report.verify_output":  "Output",
+		"report.col_attempt":    "Attempt",
+		"report.col_result":     "Result",
+	},
+	LocaleChinese: {
+		"stats.title":           "📊 执行统计",
+		"stats.models":          "🤖 模型使用:",
+		"stats.requests":        "请求: %d, 错误: %d, 延迟: %dms",
+		"stats.tokens":          "输入: %d, 输出: %d, 缓存: %d",
+		"stats.thoughts":        "🧠 思考 Tokens: %d",
+		"stats.tool_tokens":     "🔧 工具 Tokens: %d",
+		"stats.cost":            "💵 成本: %s",
+		"stats.cost_input":      "输入 %s, 缓存 %s, 工具 %s",
+		"stats.cost_output":     "输出 %s, 思考 %s",
+		"stats.long_context":    "[长上下文]",
+		"stats.no_pricing":      "(无定价)",
+		"stats.total_input":     "总输入 Tokens: %d",
+		"stats.total_output":    "总输出 Tokens: %d",
+		"stats.total_thoughts":  "🧠 总思考 Tokens: %d",
+		"stats.total_cost":      "💵 预估成本: %s",
+		"stats.tools":           "🔧 工具调用:",
+		"stats.tool_calls":      "总调用: %d, 成功: %d, 失败: %d",
+		"stats.tool_duration":   "总耗时: %dms",
+		"stats.tool_details":    "工具详情:",
+		"stats.tool_detail":     "- %s: %d次 (%dms)",
+		"stats.files":           "📁 文件修改:",
+		"stats.lines":           "+%d 行添加, -%d 行删除",
+		"report.title":          "AI 响应",
+		"report.cached":         "(缓存)",
+		"report.partial":        "(部分)",
+		"report.no_response":    "未收到响应",
+		"report.warning":        "警告: %s",
+		"report.exit_code":      "退出码: %d",
+		"report.model":          "模型: %s",
+		"report.task":           "任务: %s",
+		"report.total":          "合计",
+		"report.col_model":      "模型",
+		"report.col_requests":   "请求",
+		"report.col_input":      "输入",
+		"report.col_output":     "输出",
+		"report.col_cached":     "缓存",
+		"report.col_thoughts":   "思考",
+		"report.col_cost":       "成本",
+		"report.changes":        "文件变更",
+		"report.changes_count":  "%d 个文件变更，+%d -%d",
+		"report.patch":          "补丁",
+		"report.patch_cut":      "（已截断，完整差异请查看补丁文件）",
+		"report.body_cut":       "（已截断，完整响应请查看构建日志）",
+		"report.verify":         "验证",
+		"report.verify_attempt": "第 %d 次尝试",
+		"report.verify_passed":  "通过",
+		"report.verify_failed":  "失败（退出码 %d）",
+		"report.verify_timeout": "超时",
+		"report.verify_stopped": "已停止：%s",
+		"report.verify_output":  "输出",
+		"report.col_attempt":    "尝试",
+		"report.col_result":     "结果",
+	},
+}
+
+// localeAliases maps common locale spellings to supported locales
+var localeAliases = map[string]string{
+	"en-us":   LocaleEnglish,
+	"en_us":   LocaleEnglish,
+	"zh-cn":   LocaleChinese,
+	"zh_cn":   LocaleChinese,
+	"zh-hans": LocaleChinese,
+}
+
+// NormalizeLocale maps a locale setting to a supported locale, and reports
+// whether it was recognized. Unrecognized locales fall back to English.
+func NormalizeLocale(locale string) (string, bool) {
+	locale = strings.ToLower(strings.TrimSpace(locale))
+	if locale == "" {
+		return LocaleEnglish, true
+	}
+	if _, ok := catalogs[locale]; ok {
+		return locale, true
+	}
+	if alias, ok := localeAliases[locale]; ok {
+		return alias, true
+	}
+	return LocaleEnglish, false
+}
+
+// Locales returns the sorted names of all supported locales
+func Locales() []string {
+	names := make([]string, 0, len(catalogs))
+	for name := range catalogs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// GetCatalog returns the catalog for a locale, falling back to English
+func GetCatalog(locale string) Catalog {
+	normalized, _ := NormalizeLocale(locale)
+	return catalogs[normalized]
+}
+
+// T formats the message for key, falling back to English and then to the key itself
+func (c Catalog) T(key string, args ...interface{}) string {
+	format, ok := c[key]
+	if !ok {
+		if format, ok = catalogs[LocaleEnglish][key]; !ok {
+			format = key
+		}
+	}
+	if len(args) == 0 {
+		return format
+	}
+	return fmt.Sprintf(format, args...)
+}
@@ -0,0 +1,394 @@
+package plugin
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// ledgerMonthFormat is the layout of the month a run is billed to (UTC)
+const ledgerMonthFormat = "2006-01"
+
+// Ledger group-by dimensions
+const (
+	LedgerByRepo  = "repo"
+	LedgerByModel = "model"
+	LedgerByMonth = "month"
+)
+
+// LedgerEntry is one run recorded in the cost ledger
+type LedgerEntry struct {
+	Time         time.Time `json:"time"`
+	Repo         string    `json:"repo"`
+	Build        string    `json:"build,omitempty"`
+	Branch       string    `json:"branch,omitempty"`
+	Event        string    `json:"event,omitempty"`
+	Model        string    `json:"model"`
+	Task         string    `json:"task,omitempty"`
+	InputTokens  int       `json:"input_tokens"`
+	OutputTokens int       `json:"output_tokens"`
+	TotalTokens  int       `json:"total_tokens"`
+	CostUSD      float64   `json:"cost_usd"`
+	CostKnown    bool      `json:"cost_known"`
+	Cached       bool      `json:"cached,omitempty"`
+	Outcome      string    `json:"outcome"`
+	DurationMs   int64     `json:"duration_ms"`
+	Override     string    `json:"override,omitempty"` // protected_override reason, if it was needed
+}
+
+// Month returns the month the entry is billed to
+func (e LedgerEntry) Month() string {
+	return e.Time.UTC().Format(ledgerMonthFormat)
+}
+
+// NewLedgerEntry describes a run for the ledger. Cached runs cost nothing.
+func NewLedgerEntry(cfg *Config, result *ExecutionResult, runErr error, duration time.Duration) LedgerEntry {
+	entry := LedgerEntry{
+		Time:       time.Now().UTC(),
+		Repo:       os.Getenv("DRONE_REPO"),
+		Build:      os.Getenv("DRONE_BUILD_NUMBER"),
+		Branch:     os.Getenv("DRONE_BRANCH"),
+		Event:      os.Getenv("DRONE_BUILD_EVENT"),
+		Model:      cfg.Model,
+		Task:       cfg.Task,
+		CostKnown:  true,
+		Outcome:    RunOutcome(result, runErr),
+		DurationMs: duration.Milliseconds(),
+	}
+	if result == nil {
+		return entry
+	}
+
+	entry.Cached = result.Cached
+	if result.Cached || result.Response == nil || result.Response.Stats == nil {
+		return entry
+	}
+	for name, stats := range result.Response.Stats.Models {
+		entry.InputTokens += stats.Tokens.Prompt
+		entry.OutputTokens += stats.Tokens.Candidates
+		entry.TotalTokens += stats.Tokens.Total
+		cost, known := calculateModelCost(name, stats)
+		entry.CostUSD += cost
+		entry.CostKnown = entry.CostKnown && known
+	}
+	return entry
+}
+
+// AppendLedger appends an entry to a JSONL ledger. Each entry is written with a
+// single append so concurrent builds sharing the volume do not interleave lines.
+func AppendLedger(path string, entry LedgerEntry) error {
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// ReadLedger reads all entries of a ledger. A missing ledger has no entries;
+// malformed lines are skipped and counted.
+func ReadLedger(path string) ([]LedgerEntry, int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, 0, nil
+		}
+		return nil, 0, fmt.Errorf("%w: %v", ErrFileRead, err)
+	}
+	defer f.Close()
+
+	var entries []LedgerEntry
+	skipped := 0
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		var entry LedgerEntry
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			skipped++
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, skipped, fmt.Errorf("%w: %v", ErrFileRead, err)
+	}
+	return entries, skipped, nil
+}
+
+// SpendSummary is the spend of one group of ledger entries
+type SpendSummary struct {
+	Repo     string  `json:"repo,omitempty"`
+	Model    string  `json:"model,omitempty"`
+	Month    string  `json:"month,omitempty"`
+	Runs     int     `json:"runs"`
+	Tokens   int     `json:"tokens"`
+	CostUSD  float64 `json:"cost_usd"`
+	Unpriced int     `json:"unpriced_runs,omitempty"` // runs whose cost is unknown and not included
+}
+
+// add counts an entry in the summary
+func (s *SpendSummary) add(entry LedgerEntry) {
+	s.Runs++
+	s.Tokens += entry.TotalTokens
+	s.CostUSD += entry.CostUSD
+	if !entry.CostKnown {
+		s.Unpriced++
+	}
+}
+
+// AggregateLedger sums entries by the given dimensions (repo, model, month),
+// sorted by month, then repo, then model
+func AggregateLedger(entries []LedgerEntry, by []string) ([]SpendSummary, error) {
+	dims := map[string]bool{}
+	for _, dim := range by {
+		switch dim {
+		case LedgerByRepo, LedgerByModel, LedgerByMonth:
+			dims[dim] = true
+		default:
+			return nil, fmt.Errorf("unknown group-by dimension %q (available: repo, model, month)", dim)
+		}
+	}
+
+	groups := map[SpendSummary]*SpendSummary{}
+	for _, entry := range entries {
+		var key SpendSummary
+		if dims[LedgerByRepo] {
+			key.Repo = entry.Repo
+		}
+		if dims[LedgerByModel] {
+			key.Model = entry.Model
+		}
+		if dims[LedgerByMonth] {
+			key.Month = entry.Month()
+		}
+		group, ok := groups[key]
+		if !ok {
+			group = &SpendSummary{Repo: key.Repo, Model: key.Model, Month: key.Month}
+			groups[key] = group
+		}
+		group.add(entry)
+	}
+
+	summaries := make([]SpendSummary, 0, len(groups))
+	for _, group := range groups {
+		summaries = append(summaries, *group)
+	}
+	sort.Slice(summaries, func(i, j int) bool {
+		a, b := summaries[i], summaries[j]
+		if a.Month != b.Month {
+			return a.Month < b.Month
+		}
+		if a.Repo != b.Repo {
+			return a.Repo < b.Repo
+		}
+		return a.Model < b.Model
+	})
+	return summaries, nil
+}
+
+// MonthlySpend returns the spend of a repo in the month containing t
+func MonthlySpend(entries []LedgerEntry, repo string, t time.Time) SpendSummary {
+	month := t.UTC().Format(ledgerMonthFormat)
+	summary := SpendSummary{Repo: repo, Month: month}
+	for _, entry := range entries {
+		if entry.Repo == repo && entry.Month() == month {
+			summary.add(entry)
+		}
+	}
+	return summary
+}
+
+// CheckMonthlyBudget refuses a run when the repo already spent its monthly budget
+func CheckMonthlyBudget(path, repo string, maxCostUSD float64) (SpendSummary, error) {
+	entries, _, err := ReadLedger(path)
+	if err != nil {
+		return SpendSummary{}, err
+	}
+	spend := MonthlySpend(entries, repo, time.Now())
+	if spend.CostUSD >= maxCostUSD {
+		return spend, fmt.Errorf("%w: %s spent $%.4f in %s across %d runs, monthly_max_cost_usd is $%.4f",
+			ErrBudgetExceeded, repoName(repo), spend.CostUSD, spend.Month, spend.Runs, maxCostUSD)
+	}
+	return spend, nil
+}
+
+// repoName returns a printable repo name
+func repoName(repo string) string {
+	if repo == "" {
+		return "(no repo)"
+	}
+	return repo
+}
+
+// RunLedgerReport implements the report subcommand: it aggregates the ledger
+// and, with -check, fails when a repo is over its monthly budget.
+//
+//	drone-gemini-cli-plugin report -ledger /cache/ledger.jsonl -by repo,month -month 2025-06
+func RunLedgerReport(args []string, out io.Writer) error {
+	flags := flag.NewFlagSet("report", flag.ContinueOnError)
+	flags.SetOutput(out)
+	ledger := flags.String("ledger", os.Getenv("PLUGIN_LEDGER_FILE"), "ledger file (default $PLUGIN_LEDGER_FILE)")
+	by := flags.String("by", "repo,model,month", "comma-separated group-by dimensions: repo, model, month")
+	month := flags.String("month", "", "only include this month (YYYY-MM)")
+	repo := flags.String("repo", "", "only include this repo")
+	format := flags.String("format", "text", "output format: text or json")
+	budget := flags.Float64("budget", envFloat("PLUGIN_MONTHLY_MAX_COST_USD"), "monthly budget in USD per repo (default $PLUGIN_MONTHLY_MAX_COST_USD)")
+	check := flags.Bool("check", false, "fail when the repo ($DRONE_REPO or -repo) is over its monthly budget")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *ledger == "" {
+		return fmt.Errorf("no ledger: set -ledger or PLUGIN_LEDGER_FILE")
+	}
+
+	entries, skipped, err := ReadLedger(*ledger)
+	if err != nil {
+		return err
+	}
+	if skipped > 0 {
+		fmt.Fprintf(out, "Warning: skipped %d malformed ledger lines\n", skipped)
+	}
+
+	if *check {
+		checkRepo := *repo
+		if checkRepo == "" {
+			checkRepo = os.Getenv("DRONE_REPO")
+		}
+		if *budget <= 0 {
+			return fmt.Errorf("-check needs a monthly budget: set -budget or PLUGIN_MONTHLY_MAX_COST_USD")
+		}
+		spend, err := CheckMonthlyBudget(*ledger, checkRepo, *budget)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Monthly budget: %s spent $%.4f of $%.4f in %s\n", repoName(checkRepo), spend.CostUSD, *budget, spend.Month)
+		return nil
+	}
+
+	var filtered []LedgerEntry
+	for _, entry := range entries {
+		if (*month == "" || entry.Month() == *month) && (*repo == "" || entry.Repo == *repo) {
+			filtered = append(filtered, entry)
+		}
+	}
+
+	var dims []string
+	for _, dim := range strings.Split(*by, ",") {
+		if dim = strings.TrimSpace(dim); dim != "" {
+			dims = append(dims, dim)
+		}
+	}
+	summaries, err := AggregateLedger(filtered, dims)
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case "json":
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(summaries)
+	case "text":
+		return writeSpendTable(out, summaries, dims, *budget)
+	default:
+		return fmt.Errorf("unknown format %q (available: text, json)", *format)
+	}
+}
+
+// writeSpendTable writes the summaries as an aligned table with a total row.
+// With a budget, rows grouped by repo and month show the share used.
+func writeSpendTable(out io.Writer, summaries []SpendSummary, dims []string, budget float64) error {
+	showBudget := budget > 0 && containsString(dims, LedgerByRepo) && containsString(dims, LedgerByMonth) &&
+		!containsString(dims, LedgerByModel)
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	header := make([]string, 0, len(dims)+4)
+	for _, dim := range dims {
+		header = append(header, strings.ToUpper(dim))
+	}
+	header = append(header, "RUNS", "TOKENS", "COST", "UNPRICED")
+	if showBudget {
+		header = append(header, "BUDGET")
+	}
+	fmt.Fprintln(w, strings.Join(header, "\t"))
+
+	var total SpendSummary
+	for _, s := range summaries {
+		row := make([]string, 0, len(header))
+		for _, dim := range dims {
+			switch dim {
+			case LedgerByRepo:
+				row = append(row, repoName(s.Repo))
+			case LedgerByModel:
+				row = append(row, s.Model)
+			case LedgerByMonth:
+				row = append(row, s.Month)
+			}
+		}
+		row = append(row, fmt.Sprint(s.Runs), fmt.Sprint(s.Tokens), fmt.Sprintf("$%.4f", s.CostUSD), fmt.Sprint(s.Unpriced))
+		if showBudget {
+			row = append(row, fmt.Sprintf("%.0f%%", s.CostUSD/budget*100))
+		}
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+
+		total.Runs += s.Runs
+		total.Tokens += s.Tokens
+		total.CostUSD += s.CostUSD
+		total.Unpriced += s.Unpriced
+	}
+
+	// Without dimensions the single row already is the total
+	if len(dims) > 0 {
+		row := []string{"TOTAL"}
+		for i := 1; i < len(dims); i++ {
+			row = append(row, "")
+		}
+		row = append(row, fmt.Sprint(total.Runs), fmt.Sprint(total.Tokens), fmt.Sprintf("$%.4f", total.CostUSD), fmt.Sprint(total.Unpriced))
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+
+	return w.Flush()
+}
+
+// containsString reports whether values contains s
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// envFloat reads a float from the environment, returning 0 when unset or invalid
+func envFloat(key string) float64 {
+	value, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return 0
+	}
+	return value
+}
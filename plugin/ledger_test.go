@@ -0,0 +1,172 @@
+package plugin
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLedgerAppendAndRead(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "shared", "ledger.jsonl")
+
+	t.Setenv("DRONE_REPO", "octo/app")
+	t.Setenv("DRONE_BUILD_NUMBER", "7")
+	result := &ExecutionResult{Response: &CLIResponse{Stats: &CLIStats{Models: map[string]ModelStats{
+		"gemini-2.5-pro": {Tokens: TokenStats{Prompt: 100000, Candidates: 10000, Total: 110000}},
+	}}}}
+	entry := NewLedgerEntry(&Config{Model: "gemini-2.5-pro", Task: "review"}, result, nil, 2*time.Second)
+	if entry.Repo != "octo/app" || entry.Build != "7" || entry.TotalTokens != 110000 || entry.Outcome != OutcomeSuccess {
+		t.Errorf("NewLedgerEntry() = %+v", entry)
+	}
+	if entry.CostUSD < 0.2249 || entry.CostUSD > 0.2251 || !entry.CostKnown {
+		t.Errorf("NewLedgerEntry() cost = %v (known %v), want $0.225", entry.CostUSD, entry.CostKnown)
+	}
+
+	// Cached runs are recorded but cost nothing
+	cached := NewLedgerEntry(&Config{Model: "gemini-2.5-pro"}, &ExecutionResult{Response: result.Response, Cached: true}, nil, 0)
+	if cached.CostUSD != 0 || cached.Outcome != OutcomeCached {
+		t.Errorf("cached entry = %+v, want no cost", cached)
+	}
+
+	for _, e := range []LedgerEntry{entry, cached} {
+		if err := AppendLedger(path, e); err != nil {
+			t.Fatalf("AppendLedger() error: %v", err)
+		}
+	}
+	f, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	f.WriteString("{not json\n")
+	f.Close()
+
+	entries, skipped, err := ReadLedger(path)
+	if err != nil {
+		t.Fatalf("ReadLedger() error: %v", err)
+	}
+	if len(entries) != 2 || skipped != 1 {
+		t.Errorf("ReadLedger() = %d entries, %d skipped, want 2 and 1", len(entries), skipped)
+	}
+
+	if entries, _, err := ReadLedger(filepath.Join(t.TempDir(), "missing.jsonl")); err != nil || entries != nil {
+		t.Errorf("ReadLedger() on missing file = %v, %v", entries, err)
+	}
+}
+
+func testLedgerEntries() []LedgerEntry {
+	june := time.Date(2025, 6, 10, 0, 0, 0, 0, time.UTC)
+	july := time.Date(2025, 7, 1, 0, 0, 0, 0, time.UTC)
+	return []LedgerEntry{
+		{Time: june, Repo: "octo/app", Model: "gemini-2.5-pro", TotalTokens: 100, CostUSD: 1.0, CostKnown: true},
+		{Time: june, Repo: "octo/app", Model: "gemini-2.5-flash", TotalTokens: 50, CostUSD: 0.25, CostKnown: true},
+		{Time: june, Repo: "octo/lib", Model: "gemini-2.5-pro", TotalTokens: 10, CostUSD: 0.5, CostKnown: true},
+		{Time: july, Repo: "octo/app", Model: "my-tuned-model", TotalTokens: 20},
+	}
+}
+
+func TestAggregateLedger(t *testing.T) {
+	entries := testLedgerEntries()
+
+	tests := []struct {
+		name string
+		by   []string
+		want []SpendSummary
+	}{
+		{
+			name: "by repo and month",
+			by:   []string{LedgerByRepo, LedgerByMonth},
+			want: []SpendSummary{
+				{Repo: "octo/app", Month: "2025-06", Runs: 2, Tokens: 150, CostUSD: 1.25},
+				{Repo: "octo/lib", Month: "2025-06", Runs: 1, Tokens: 10, CostUSD: 0.5},
+				{Repo: "octo/app", Month: "2025-07", Runs: 1, Tokens: 20, Unpriced: 1},
+			},
+		},
+		{
+			name: "by model",
+			by:   []string{LedgerByModel},
+			want: []SpendSummary{
+				{Model: "gemini-2.5-flash", Runs: 1, Tokens: 50, CostUSD: 0.25},
+				{Model: "gemini-2.5-pro", Runs: 2, Tokens: 110, CostUSD: 1.5},
+				{Model: "my-tuned-model", Runs: 1, Tokens: 20, Unpriced: 1},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := AggregateLedger(entries, tt.by)
+			if err != nil {
+				t.Fatalf("AggregateLedger() error: %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("AggregateLedger() = %+v, want %+v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("row %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+
+	if _, err := AggregateLedger(entries, []string{"team"}); err == nil {
+		t.Error("AggregateLedger() with an unknown dimension should fail")
+	}
+}
+
+func TestCheckMonthlyBudget(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ledger.jsonl")
+	now := time.Now().UTC()
+	for _, e := range []LedgerEntry{
+		{Time: now, Repo: "octo/app", CostUSD: 4, CostKnown: true},
+		{Time: now, Repo: "octo/lib", CostUSD: 9, CostKnown: true},
+		{Time: now.AddDate(0, -1, 0), Repo: "octo/app", CostUSD: 50, CostKnown: true},
+	} {
+		if err := AppendLedger(path, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	spend, err := CheckMonthlyBudget(path, "octo/app", 5)
+	if err != nil || spend.CostUSD != 4 {
+		t.Errorf("CheckMonthlyBudget() = %+v, %v, want $4 within budget", spend, err)
+	}
+	if _, err := CheckMonthlyBudget(path, "octo/app", 4); !errors.Is(err, ErrBudgetExceeded) {
+		t.Errorf("CheckMonthlyBudget() error = %v, want ErrBudgetExceeded", err)
+	}
+}
+
+func TestRunLedgerReport(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ledger.jsonl")
+	for _, e := range testLedgerEntries() {
+		if err := AppendLedger(path, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out strings.Builder
+	if err := RunLedgerReport([]string{"-ledger", path, "-by", "repo,month", "-month", "2025-06", "-budget", "5"}, &out); err != nil {
+		t.Fatalf("RunLedgerReport() error: %v", err)
+	}
+	got := out.String()
+	for _, want := range []string{"REPO", "BUDGET", "octo/app", "$1.2500", "25%", "TOTAL", "$1.7500"} {
+		if !strings.Contains(got, want) {
+			t.Errorf("report missing %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "2025-07") {
+		t.Errorf("report should only include 2025-06:\n%s", got)
+	}
+
+	out.Reset()
+	if err := RunLedgerReport([]string{"-ledger", path, "-by", "model", "-format", "json"}, &out); err != nil {
+		t.Fatalf("RunLedgerReport() json error: %v", err)
+	}
+	if !strings.Contains(out.String(), `"model": "my-tuned-model"`) {
+		t.Errorf("json report missing model:\n%s", out.String())
+	}
+
+	if err := RunLedgerReport([]string{}, &out); err == nil {
+		t.Error("RunLedgerReport() without a ledger should fail")
+	}
+}
@@ -0,0 +1,319 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// metricsPrefix is prepended to every exported metric name
+const metricsPrefix = "drone_gemini_"
+
+// Run outcomes reported by the run_outcome metric
+const (
+	OutcomeSuccess        = "success"
+	OutcomeCached         = "cached"
+	OutcomeFailure        = "failure" // CLI exited non-zero
+	OutcomeTimeout        = "timeout"
+	OutcomeCancelled      = "cancelled" // the build was cancelled
+	OutcomeBudgetExceeded = "budget_exceeded"
+	OutcomeGateFailed     = "gate_failed"    // findings at or above fail_on
+	OutcomePathViolation  = "path_violation" // files changed outside the allowed paths
+	OutcomeVerifyFailed   = "verify_failed"  // verify_command failed after all repairs
+	OutcomeError          = "error"
+)
+
+// findingSeverities are the severity levels the review and security-audit tasks ask for
+var findingSeverities = []string{"CRITICAL", "WARNING", "INFO"}
+
+// findingPattern matches a severity marker at the start of a line, after any list,
+// heading or quote prefixes: "CRITICAL:", "1. **WARNING**:", "### INFO:",
+// "> CRITICAL:" or a bracketed tag such as "- [WARNING] main.go". Prose such as
+// "No CRITICAL issues were found" is not counted.
+var findingPattern = regexp.MustCompile(
+	`^\s*(?:(?:[-*+]|\d+[.)]|#{1,6}|>)\s*)*\**(?:\[(CRITICAL|WARNING|INFO)\]|(CRITICAL|WARNING|INFO)\**\s*:)`)
+
+// pushTimeout bounds a Pushgateway request
+const pushTimeout = 10 * time.Second
+
+// MetricLabels identifies the pipeline a run belongs to
+type MetricLabels struct {
+	Repo   string
+	Branch string
+	Event  string
+}
+
+// MetricLabelsFromEnv reads the labels from Drone's environment
+func MetricLabelsFromEnv() MetricLabels {
+	return MetricLabels{
+		Repo:   os.Getenv("DRONE_REPO"),
+		Branch: os.Getenv("DRONE_BRANCH"),
+		Event:  os.Getenv("DRONE_BUILD_EVENT"),
+	}
+}
+
+// pairs returns the labels as sorted name/value pairs
+func (l MetricLabels) pairs() [][2]string {
+	return [][2]string{{"branch", l.Branch}, {"event", l.Event}, {"repo", l.Repo}}
+}
+
+// RunMetrics is the outcome of one run in a form that can be exported to Prometheus
+type RunMetrics struct {
+	Labels   MetricLabels
+	Model    string
+	Outcome  string
+	Duration time.Duration
+	Finished time.Time
+	Stats    *CLIStats
+	Findings map[string]int
+}
+
+// NewRunMetrics collects the metrics of a run from its result and error
+func NewRunMetrics(labels MetricLabels, model string, result *ExecutionResult, runErr error, duration time.Duration) *RunMetrics {
+	m := &RunMetrics{
+		Labels:   labels,
+		Model:    model,
+		Outcome:  RunOutcome(result, runErr),
+		Duration: duration,
+		Finished: time.Now(),
+		Findings: map[string]int{},
+	}
+	if result != nil && result.Response != nil {
+		m.Stats = result.Response.Stats
+		m.Findings = CountFindings(result.Response.Response)
+	}
+	return m
+}
+
+// RunOutcome classifies how a run ended
+func RunOutcome(result *ExecutionResult, runErr error) string {
+	switch {
+	case errors.Is(runErr, ErrCancelled):
+		return OutcomeCancelled
+	case errors.Is(runErr, ErrPathViolation):
+		return OutcomePathViolation
+	case errors.Is(runErr, ErrVerifyFailed):
+		return OutcomeVerifyFailed
+	case errors.Is(runErr, ErrBudgetExceeded):
+		return OutcomeBudgetExceeded
+	case errors.Is(runErr, ErrFindingsGate):
+		return OutcomeGateFailed
+	case errors.Is(runErr, ErrTimeout):
+		return OutcomeTimeout
+	case runErr != nil || result == nil:
+		return OutcomeError
+	case result.ExitCode != 0 || result.Response == nil || result.Response.Error != nil:
+		return OutcomeFailure
+	case result.Cached:
+		return OutcomeCached
+	}
+	return OutcomeSuccess
+}
+
+// CountFindings counts the findings in a response by severity. Each line that
+// starts with a severity marker counts once.
+func CountFindings(response string) map[string]int {
+	counts := make(map[string]int, len(findingSeverities))
+	for _, severity := range findingSeverities {
+		counts[severity] = 0
+	}
+	for _, line := range strings.Split(response, "\n") {
+		// The severity is in the bracketed or the plain group
+		if match := findingPattern.FindStringSubmatch(line); match != nil {
+			counts[match[1]+match[2]]++
+		}
+	}
+	return counts
+}
+
+// metricFamily is one metric name with its samples
+type metricFamily struct {
+	name    string
+	help    string
+	samples []metricSample
+}
+
+// metricSample is one labelled value
+type metricSample struct {
+	labels [][2]string
+	value  float64
+}
+
+// Format renders the metrics in the Prometheus text exposition format
+func (m *RunMetrics) Format() string {
+	common := m.Labels.pairs()
+	families := map[string]*metricFamily{}
+	add := func(name, help string, value float64, labels ...[2]string) {
+		family, ok := families[name]
+		if !ok {
+			family = &metricFamily{name: metricsPrefix + name, help: help}
+			families[name] = family
+		}
+		all := append(append([][2]string{}, common...), labels...)
+		family.samples = append(family.samples, metricSample{labels: all, value: value})
+	}
+
+	add("run_outcome", "Outcome of the run (1 for the outcome that occurred).", 1,
+		[2]string{"model", m.Model}, [2]string{"outcome", m.Outcome})
+	add("run_duration_seconds", "Wall-clock duration of the run.", m.Duration.Seconds(),
+		[2]string{"model", m.Model})
+	add("run_timestamp_seconds", "Unix time the run finished.", float64(m.Finished.Unix()),
+		[2]string{"model", m.Model})
+
+	for _, severity := range sortedKeys(m.Findings) {
+		add("findings", "Findings in the response by severity.", float64(m.Findings[severity]),
+			[2]string{"severity", strings.ToLower(severity)})
+	}
+
+	if m.Stats != nil {
+		for _, name := range sortedKeys(m.Stats.Models) {
+			stats := m.Stats.Models[name]
+			model := [2]string{"model", name}
+			for _, t := range []struct {
+				kind  string
+				count int
+			}{
+				{"input", stats.Tokens.Prompt},
+				{"output", stats.Tokens.Candidates},
+				{"cached", stats.Tokens.Cached},
+				{"thoughts", stats.Tokens.Thoughts},
+				{"tool", stats.Tokens.Tool},
+			} {
+				add("tokens", "Tokens used by model and type.", float64(t.count), model, [2]string{"type", t.kind})
+			}
+			add("api_requests", "API requests by model.", float64(stats.API.TotalRequests), model)
+			add("api_errors", "API errors by model.", float64(stats.API.TotalErrors), model)
+			add("api_latency_seconds", "Total API latency by model.", float64(stats.API.TotalLatencyMs)/1000, model)
+
+			// Unpriced models are left out rather than reported as free
+			if cost, known := calculateModelCost(name, stats); known {
+				add("cost_usd", "Estimated cost in USD by model.", cost, model)
+			}
+		}
+
+		for _, name := range sortedKeys(m.Stats.Tools.ByName) {
+			detail := m.Stats.Tools.ByName[name]
+			tool := [2]string{"tool", name}
+			add("tool_calls", "Tool calls by tool and status.", float64(detail.Success), tool, [2]string{"status", "success"})
+			add("tool_calls", "Tool calls by tool and status.", float64(detail.Fail), tool, [2]string{"status", "fail"})
+			add("tool_duration_seconds", "Total tool call duration by tool.", float64(detail.DurationMs)/1000, tool)
+		}
+	}
+
+	var sb strings.Builder
+	for _, key := range sortedKeys(families) {
+		family := families[key]
+		sb.WriteString(fmt.Sprintf("# HELP %s %s\n", family.name, family.help))
+		sb.WriteString(fmt.Sprintf("# TYPE %s gauge\n", family.name))
+		for _, sample := range family.samples {
+			sb.WriteString(family.name)
+			sb.WriteString(formatLabels(sample.labels))
+			sb.WriteString(" ")
+			sb.WriteString(strconv.FormatFloat(sample.value, 'g', -1, 64))
+			sb.WriteString("\n")
+		}
+	}
+	return sb.String()
+}
+
+// formatLabels renders a label set, sorted by name
+func formatLabels(labels [][2]string) string {
+	sorted := append([][2]string{}, labels...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i][0] < sorted[j][0] })
+
+	parts := make([]string, 0, len(sorted))
+	for _, label := range sorted {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, label[0], escapeLabelValue(label[1])))
+	}
+	return "{" + strings.Join(parts, ",") + "}"
+}
+
+// escapeLabelValue escapes a label value per the exposition format
+func escapeLabelValue(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
+
+// WriteTextfile writes the metrics for node_exporter's textfile collector. The
+// file is replaced atomically so the collector never reads a partial file.
+func (m *RunMetrics) WriteTextfile(path string) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, ".metrics-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.WriteString(m.Format()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	tmp.Close()
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+// Push replaces the metrics of this job and pipeline on a Pushgateway. The repo,
+// branch and event labels form the grouping key, so each pipeline keeps its own group.
+func (m *RunMetrics) Push(gatewayURL, job string) error {
+	endpoint := strings.TrimRight(gatewayURL, "/") + "/metrics/job@base64/" + groupingValue(job)
+	for _, label := range m.Labels.pairs() {
+		endpoint += "/" + label[0] + "@base64/" + groupingValue(label[1])
+	}
+
+	req, err := http.NewRequest(http.MethodPut, endpoint, bytes.NewBufferString(m.Format()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; version=0.0.4")
+
+	client := &http.Client{Timeout: pushTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("pushgateway returned %s", resp.Status)
+	}
+	return nil
+}
+
+// groupingValue encodes a grouping key value; "=" is the Pushgateway's encoding
+// of an empty value
+func groupingValue(value string) string {
+	if value == "" {
+		return "="
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(value))
+}
+
+// redactURL hides credentials embedded in a URL before it is logged
+func redactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.User == nil {
+		return rawURL
+	}
+	u.User = url.User("***")
+	return u.String()
+}
@@ -139,12 +139,19 @@ func (p *OutputParser) ParseJSON(output string) (*CLIResponse, error) {
 	return &response, nil
 }
 
-// ParseStreamJSON parses stream-json format output (JSONL)
+// ParseStreamJSON parses stream-json format output (JSONL). The response is the
+// last assistant message, assembled from its deltas when it was streamed. Lines
+// that are not valid JSON, such as the last line of a stream cut off by a
+// timeout, are skipped.
 func (p *OutputParser) ParseStreamJSON(output string) ([]StreamEvent, *CLIResponse, error) {
 	lines := strings.Split(strings.TrimSpace(output), "\n")
 	var events []StreamEvent
 	var finalResponse *CLIResponse
 
+	// message collects the deltas of the assistant message being streamed
+	var message strings.Builder
+	streaming := false
+
 	for _, line := range lines {
 		line = strings.TrimSpace(line)
 		if line == "" {
@@ -161,19 +168,29 @@ func (p *OutputParser) ParseStreamJSON(output string) ([]StreamEvent, *CLIRespon
 
 		events = append(events, event)
 
-		// Extract final result
+		// Extract final result, keeping any message content seen before it
 		if event.Type == "result" {
-			finalResponse = &CLIResponse{
-				Stats: event.Stats,
+			if finalResponse == nil {
+				finalResponse = &CLIResponse{}
 			}
+			finalResponse.Stats = event.Stats
 		}
 
-		// Extract final message content
-		if event.Type == "message" && event.Role == "assistant" && !event.Delta {
+		// Extract final message content; a complete message replaces the deltas
+		// before it, and deltas after a tool call start a new message
+		switch {
+		case event.Type == "message" && event.Role == "assistant":
+			if !event.Delta || !streaming {
+				message.Reset()
+			}
+			message.WriteString(event.Content)
+			streaming = event.Delta
 			if finalResponse == nil {
 				finalResponse = &CLIResponse{}
 			}
-			finalResponse.Response = event.Content
+			finalResponse.Response = message.String()
+		case event.Type == "tool_use" || event.Type == "tool_result" || event.Type == "result":
+			streaming = false
 		}
 	}
 
@@ -121,6 +121,47 @@ func TestParseStreamJSON(t *testing.T) {
 	}
 }
 
+func TestParseStreamJSONDeltas(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{
+			name: "deltas assembled",
+			input: `{"type":"message","role":"assistant","content":"Found ","delta":true}
+{"type":"message","role":"assistant","content":"two issues","delta":true}`,
+			want: "Found two issues",
+		},
+		{
+			name: "message after tool call",
+			input: `{"type":"message","role":"assistant","content":"Reading main.go","delta":true}
+{"type":"tool_use","tool_name":"read_file"}
+{"type":"tool_result","status":"success"}
+{"type":"message","role":"assistant","content":"LGTM","delta":true}`,
+			want: "LGTM",
+		},
+		{
+			name: "cut-off last line",
+			input: `{"type":"message","role":"assistant","content":"Partial","delta":true}
+{"type":"message","role":"assis`,
+			want: "Partial",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, resp, err := NewOutputParser(false).ParseStreamJSON(tt.input)
+			if err != nil {
+				t.Fatalf("ParseStreamJSON() unexpected error: %v", err)
+			}
+			if resp == nil || resp.Response != tt.want {
+				t.Errorf("ParseStreamJSON() response = %+v, want %q", resp, tt.want)
+			}
+		})
+	}
+}
+
 func TestParseText(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -228,3 +269,63 @@ func TestFormatStatsNil(t *testing.T) {
 		t.Errorf("FormatStatsSimple(nil) should return 'No stats available', got: %q", result)
 	}
 }
+
+func TestCalculateCostBreakdown(t *testing.T) {
+	tests := []struct {
+		name      string
+		model     string
+		stats     ModelStats
+		wantTotal float64
+		wantLong  bool
+	}{
+		{
+			name:      "short context",
+			model:     "gemini-2.5-pro",
+			stats:     ModelStats{Tokens: TokenStats{Prompt: 100000, Candidates: 10000}},
+			wantTotal: 0.125 + 0.10,
+		},
+		{
+			name:      "long context switches tier",
+			model:     "gemini-2.5-pro",
+			stats:     ModelStats{API: APIStats{TotalRequests: 1}, Tokens: TokenStats{Prompt: 300000, Candidates: 10000}},
+			wantTotal: 0.75 + 0.15,
+			wantLong:  true,
+		},
+		{
+			name:      "tier is decided per request",
+			model:     "gemini-2.5-pro",
+			stats:     ModelStats{API: APIStats{TotalRequests: 2}, Tokens: TokenStats{Prompt: 300000}},
+			wantTotal: 0.375,
+		},
+		{
+			name:      "cached tokens are discounted",
+			model:     "gemini-2.5-pro",
+			stats:     ModelStats{Tokens: TokenStats{Prompt: 100000, Cached: 80000}},
+			wantTotal: 0.025 + 0.01,
+		},
+		{
+			name:      "thoughts billed as output and tool tokens as input",
+			model:     "gemini-2.5-flash",
+			stats:     ModelStats{Tokens: TokenStats{Thoughts: 1000000, Tool: 1000000}},
+			wantTotal: 2.50 + 0.30,
+		},
+		{
+			name:      "longest partial match wins",
+			model:     "models/gemini-2.5-flash-lite-001",
+			stats:     ModelStats{Tokens: TokenStats{Prompt: 1000000}},
+			wantTotal: 0.10,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := calculateCostBreakdown(tt.model, tt.stats)
+			if b.Total < tt.wantTotal-1e-9 || b.Total > tt.wantTotal+1e-9 {
+				t.Errorf("Total = %.6f, want %.6f (%+v)", b.Total, tt.wantTotal, b)
+			}
+			if b.LongContext != tt.wantLong {
+				t.Errorf("LongContext = %v, want %v", b.LongContext, tt.wantLong)
+			}
+		})
+	}
+}
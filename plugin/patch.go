@@ -0,0 +1,162 @@
+package plugin
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// maxReportPatchSize bounds the patch embedded in a markdown report
+const maxReportPatchSize = 64 * 1024
+
+// Patch is the diff of the working tree against a snapshot, as applied by `git apply`
+type Patch struct {
+	Diff    string
+	Summary PatchSummary
+}
+
+// PatchSummary lists the files a run changed and its line counts
+type PatchSummary struct {
+	Files     []PatchFileStat `json:"files"`
+	Added     int             `json:"lines_added"`
+	Removed   int             `json:"lines_removed"`
+	PatchFile string          `json:"patch_file,omitempty"`
+}
+
+// PatchFileStat is the change to one file
+type PatchFileStat struct {
+	Path    string `json:"path"`
+	Status  string `json:"status"` // A, M, D or T
+	Added   int    `json:"lines_added"`
+	Removed int    `json:"lines_removed"`
+	Binary  bool   `json:"binary,omitempty"`
+}
+
+// Patch diffs the working tree, including untracked files, against the snapshot.
+// Files in exclude (relative to the repository root) are left out.
+func (s *WorktreeSnapshot) Patch(exclude []string) (*Patch, error) {
+	git := NewGitAnalyzer(s.Root, false)
+	tree, err := git.writeWorktreeTree()
+	if err != nil {
+		return nil, err
+	}
+	patch := &Patch{Summary: PatchSummary{Files: []PatchFileStat{}}}
+	if tree == s.Tree {
+		return patch, nil
+	}
+
+	changes, err := git.changedPaths(s.Tree, tree)
+	if err != nil {
+		return nil, err
+	}
+	changes = withoutPaths(changes, exclude)
+	if len(changes) == 0 {
+		return patch, nil
+	}
+	paths := make([]string, 0, len(changes))
+	for _, change := range changes {
+		paths = append(paths, change.Path)
+	}
+
+	env := []string{"GIT_LITERAL_PATHSPECS=1"}
+	numstat, err := git.runGitCommandEnv(env, append([]string{"diff", "--numstat", "-z", "--no-renames", s.Tree, tree, "--"}, paths...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute patch: %w", err)
+	}
+	patch.Diff, err = git.runGitCommandEnv(env, append([]string{"diff", "--binary", "--no-color", "--no-ext-diff", "--no-renames",
+		"--src-prefix=a/", "--dst-prefix=b/", s.Tree, tree, "--"}, paths...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compute patch: %w", err)
+	}
+
+	patch.Summary = summarizePatch(changes, numstat)
+	return patch, nil
+}
+
+// summarizePatch combines name-status changes with `git diff --numstat -z` output
+func summarizePatch(changes []PathChange, numstat string) PatchSummary {
+	// Each -z numstat record is "added\tremoved\tpath", binary files have "-" counts
+	counts := map[string][2]int{}
+	binary := map[string]bool{}
+	for _, record := range strings.Split(strings.TrimRight(numstat, "\x00"), "\x00") {
+		parts := strings.SplitN(record, "\t", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if parts[0] == "-" {
+			binary[parts[2]] = true
+			continue
+		}
+		added, _ := strconv.Atoi(parts[0])
+		removed, _ := strconv.Atoi(parts[1])
+		counts[parts[2]] = [2]int{added, removed}
+	}
+
+	summary := PatchSummary{Files: make([]PatchFileStat, 0, len(changes))}
+	for _, change := range changes {
+		stat := PatchFileStat{
+			Path:    change.Path,
+			Status:  change.Status,
+			Added:   counts[change.Path][0],
+			Removed: counts[change.Path][1],
+			Binary:  binary[change.Path],
+		}
+		summary.Files = append(summary.Files, stat)
+		summary.Added += stat.Added
+		summary.Removed += stat.Removed
+	}
+	return summary
+}
+
+// Paths returns the changed files
+func (s *PatchSummary) Paths() []string {
+	paths := make([]string, 0, len(s.Files))
+	for _, file := range s.Files {
+		paths = append(paths, file.Path)
+	}
+	return paths
+}
+
+// String summarizes the change counts in one line
+func (s *PatchSummary) String() string {
+	return fmt.Sprintf("%d files changed, +%d -%d", len(s.Files), s.Added, s.Removed)
+}
+
+// String describes one changed file, e.g. "M src/main.go (+8 -2)"
+func (f PatchFileStat) String() string {
+	if f.Binary {
+		return fmt.Sprintf("%s %s (binary)", f.Status, f.Path)
+	}
+	return fmt.Sprintf("%s %s (+%d -%d)", f.Status, f.Path, f.Added, f.Removed)
+}
+
+// CrossCheck compares the line counts with the ones the gemini CLI reported and
+// describes any difference, or returns "". Differences mean files were changed
+// outside the CLI's edit tools, e.g. by shell commands, or changes were reverted.
+func (s *PatchSummary) CrossCheck(stats *CLIStats) string {
+	if stats == nil {
+		return ""
+	}
+	if stats.Files.TotalLinesAdded == s.Added && stats.Files.TotalLinesRemoved == s.Removed {
+		return ""
+	}
+	return fmt.Sprintf("gemini CLI reported +%d -%d lines but the working tree changed +%d -%d",
+		stats.Files.TotalLinesAdded, stats.Files.TotalLinesRemoved, s.Added, s.Removed)
+}
+
+// truncatePatch shortens a patch for embedding in a report
+func truncatePatch(diff string) (string, bool) {
+	return truncateLines(diff, maxReportPatchSize)
+}
+
+// truncateLines shortens text to at most limit bytes, cutting after a full line when possible
+func truncateLines(text string, limit int) (string, bool) {
+	if len(text) <= limit {
+		return text, false
+	}
+	cut := strings.LastIndex(text[:limit], "\n")
+	if cut < 0 {
+		cut = limit - 1
+	}
+	return text[:cut+1], true
+}
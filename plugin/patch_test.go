@@ -0,0 +1,136 @@
+package plugin
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestWorktreePatch(t *testing.T) {
+	dir := newTestRepo(t)
+	commitFile(t, dir, "src/main.go", "package main\n\nfunc main() {}\n", "main")
+	commitFile(t, dir, "old.txt", "one\ntwo\n", "old")
+
+	p := New(Config{Target: dir, Yolo: true, PatchFile: "out/gemini.patch"})
+	snapshot, err := p.snapshotWorktree()
+	if err != nil || snapshot == nil {
+		t.Fatalf("snapshotWorktree() = %v, %v", snapshot, err)
+	}
+
+	writeTestFile(t, dir, "src/main.go", "package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(1)\n}\n")
+	writeTestFile(t, dir, "src/util.go", "package main\n")
+	writeTestFile(t, dir, "logo.png", "\x89PNG\x00\x01\x02")
+	if err := os.Remove(filepath.Join(dir, "old.txt")); err != nil {
+		t.Fatal(err)
+	}
+
+	p.capturePatch(snapshot)
+	if p.patch == nil {
+		t.Fatal("capturePatch() captured nothing")
+	}
+	summary := p.patch.Summary
+	want := map[string]string{
+		"logo.png":    "A logo.png (binary)",
+		"old.txt":     "D old.txt (+0 -2)",
+		"src/main.go": "M src/main.go (+5 -1)",
+		"src/util.go": "A src/util.go (+1 -0)",
+	}
+	if len(summary.Files) != len(want) {
+		t.Fatalf("Files = %v, want %d files", summary.Files, len(want))
+	}
+	for _, file := range summary.Files {
+		if file.String() != want[file.Path] {
+			t.Errorf("file = %q, want %q", file, want[file.Path])
+		}
+	}
+	if summary.Added != 6 || summary.Removed != 3 || summary.PatchFile != "out/gemini.patch" {
+		t.Errorf("summary = %+v", summary)
+	}
+
+	// The patch file reproduces the changes on a clean checkout
+	patchPath := filepath.Join(dir, "out", "gemini.patch")
+	data, err := os.ReadFile(patchPath)
+	if err != nil || !bytes.Equal(data, []byte(p.patch.Diff)) {
+		t.Fatalf("patch_file = %d bytes, %v", len(data), err)
+	}
+	runGit(t, dir, "checkout", "--", ".")
+	runGit(t, dir, "clean", "-fdq", "-e", "out")
+	runGit(t, dir, "apply", "--index", patchPath)
+	if got, _ := os.ReadFile(filepath.Join(dir, "src", "util.go")); string(got) != "package main\n" {
+		t.Errorf("src/util.go after git apply = %q", got)
+	}
+}
+
+func TestPatchCrossCheck(t *testing.T) {
+	summary := PatchSummary{Added: 5, Removed: 1}
+	if got := summary.CrossCheck(&CLIStats{Files: FileStats{TotalLinesAdded: 5, TotalLinesRemoved: 1}}); got != "" {
+		t.Errorf("CrossCheck() with matching counts = %q", got)
+	}
+	if got := summary.CrossCheck(nil); got != "" {
+		t.Errorf("CrossCheck(nil) = %q", got)
+	}
+	got := summary.CrossCheck(&CLIStats{Files: FileStats{TotalLinesAdded: 2}})
+	if !strings.Contains(got, "reported +2 -0 lines but the working tree changed +5 -1") {
+		t.Errorf("CrossCheck() = %q", got)
+	}
+}
+
+func TestReportChanges(t *testing.T) {
+	patch := &Patch{
+		Diff: "diff --git a/main.go b/main.go\n+fixed\n",
+		Summary: PatchSummary{
+			Files: []PatchFileStat{{Path: "main.go", Status: "M", Added: 1}},
+			Added: 1,
+		},
+	}
+
+	report := testReport()
+	report.AddChanges(patch)
+	if len(report.Warnings) != 2 || !strings.Contains(report.Warnings[1], "working tree changed +1 -0") {
+		t.Errorf("Warnings = %v, want a line count mismatch", report.Warnings)
+	}
+
+	for format, want := range map[string][]string{
+		ReportFormatPlain:    {"--- Changes: 1 files changed, +1 -0 ---", "  M main.go (+1 -0)"},
+		ReportFormatMarkdown: {"### Changes", "- `M` `main.go` (+1 -0)", "````diff\ndiff --git a/main.go b/main.go\n+fixed\n````"},
+		ReportFormatJSON:     {`"changes": {`, `"lines_added": 1`},
+	} {
+		renderer, _ := NewReportRenderer(format)
+		var sb strings.Builder
+		if err := renderer.Render(&sb, report); err != nil {
+			t.Fatalf("%s Render() error: %v", format, err)
+		}
+		for _, s := range want {
+			if !strings.Contains(sb.String(), s) {
+				t.Errorf("%s report missing %q:\n%s", format, s, sb.String())
+			}
+		}
+	}
+
+	// Reports without changes leave the key out
+	var sb strings.Builder
+	if err := (jsonRenderer{}).Render(&sb, testReport()); err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal([]byte(sb.String()), &doc); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := doc["changes"]; ok {
+		t.Error("json report without changes has a changes key")
+	}
+}
+
+func TestTruncatePatch(t *testing.T) {
+	diff := strings.Repeat("+line\n", maxReportPatchSize/6+10)
+	got, truncated := truncatePatch(diff)
+	if !truncated || len(got) > maxReportPatchSize || !strings.HasSuffix(got, "\n") {
+		t.Errorf("truncatePatch() = %d bytes, truncated %v", len(got), truncated)
+	}
+	if got, truncated := truncatePatch("+a\n"); truncated || got != "+a\n" {
+		t.Errorf("truncatePatch() of a small patch = %q, %v", got, truncated)
+	}
+}
@@ -1,15 +1,37 @@
 package plugin
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 // Plugin represents the drone-gemini-cli-plugin
 type Plugin struct {
 	config Config
+
+	// tracerProvider receives the spans of a run; set from configuration by Exec when nil
+	tracerProvider trace.TracerProvider
+
+	// override is the protected_override reason when the branch policy needed it
+	override string
+
+	// snapshot and patch hold the changes of a yolo or auto_edit run for the report
+	snapshot *WorktreeSnapshot
+	patch    *Patch
+
+	// verification holds the attempts of the verify_command loop
+	verification *Verification
+
+	// pushed is the commit pushed by push_changes
+	pushed *PushResult
 }
 
 // New creates a new plugin instance
@@ -19,43 +41,365 @@ func New(cfg Config) *Plugin {
 	}
 }
 
-// Exec runs the plugin and returns any error encountered
-func (p *Plugin) Exec() error {
+// Exec runs the plugin and returns any error encountered. Cancelling ctx stops the
+// gemini CLI; the changes of the run are still checked and the reports written,
+// and the error wraps ErrCancelled.
+func (p *Plugin) Exec(ctx context.Context) (err error) {
+	if p.tracerProvider == nil {
+		provider, shutdown, tracingErr := NewTracerProvider(&p.config)
+		if tracingErr != nil {
+			return tracingErr
+		}
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), traceShutdownTimeout)
+			defer cancel()
+			if shutdownErr := shutdown(ctx); shutdownErr != nil {
+				fmt.Printf("Warning: failed to export traces: %v\n", shutdownErr)
+			}
+		}()
+		p.tracerProvider = provider
+	}
+
+	ctx, span := p.tracerProvider.Tracer(tracerName).Start(ctx, "plugin.exec",
+		trace.WithAttributes(
+			attribute.String("gemini.model", p.config.Model),
+			attribute.String("gemini.task", p.config.Task),
+		))
+	defer func() { endSpan(span, err) }()
+
+	task, err := p.loadConfig(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Display configuration summary
+	p.displayConfig()
+
+	// Build prompt with optional git context
+	prompt := p.config.Prompt
+	stdinInput, err := p.buildStdin(ctx, task)
+	if err != nil {
+		return err
+	}
+
+	// Snapshot the working tree so changes outside the allowed paths can be reverted
+	snapshot, err := p.snapshotWorktree()
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	result, err := p.execute(ctx, prompt, stdinInput)
+	checkErr := p.enforcePaths(ctx, snapshot)
+	if err == nil && checkErr == nil && p.config.VerifyCommand != "" {
+		result, checkErr = p.verifyChanges(ctx, snapshot, result, prompt)
+	}
+	p.capturePatch(snapshot)
+	if err != nil {
+		err = errors.Join(err, checkErr)
+		if errors.Is(err, ErrTimeout) || errors.Is(err, ErrCancelled) {
+			p.reportPartial(result, err, time.Since(start))
+		}
+		p.recordRun(result, err, time.Since(start))
+		return err
+	}
+
+	return p.report(ctx, result, start, checkErr)
+}
+
+// verifyChanges runs verify_command after the agent changed files and feeds its
+// failures back to the agent for up to verify_max_repairs repair runs. Repairs
+// stop early when the budget cannot afford another run. It returns the result
+// of all runs combined.
+func (p *Plugin) verifyChanges(ctx context.Context, snapshot *WorktreeSnapshot, result *ExecutionResult, prompt string) (combined *ExecutionResult, err error) {
+	ctx, span := startSpan(ctx, "verify", attribute.String("verify.command", p.config.VerifyCommand))
+	defer func() { endSpan(span, err) }()
+
+	combined = result
+	if p.config.ReplayFile != "" {
+		fmt.Println("Verify: skipped when replaying a recorded invocation")
+		return combined, nil
+	}
+
+	verification := &Verification{Command: p.config.VerifyCommand}
+	p.verification = verification
+	budget := p.budget()
+	timeout := time.Duration(p.config.VerifyTimeout) * time.Second
+	env := VerifyEnv(&p.config)
+
+	var spent BudgetUsage
+	from := snapshot // the working tree before the agent run of this attempt
+	for attempt := 1; ; attempt++ {
+		entry := VerifyAttempt{Attempt: attempt, Usage: budget.Usage(resultStats(result))}
+		if attempt > 1 && result.Response != nil {
+			entry.Response = result.Response.Response
+		}
+		spent = addUsage(spent, entry.Usage)
+
+		// Files the verify_command writes, such as coverage reports, are not the agent's changes
+		var before *WorktreeSnapshot
+		if from != nil {
+			if patch, err := from.Patch(p.pluginFiles(from.Root)); err == nil {
+				entry.Changes, entry.Patch = &patch.Summary, patch.Diff
+			}
+			var snapshotErr error
+			if before, snapshotErr = NewGitAnalyzer(from.Root, p.config.Debug).SnapshotWorktree(); snapshotErr != nil {
+				fmt.Printf("Warning: files written by verify_command are not reverted: %v\n", snapshotErr)
+			}
+		}
+
+		fmt.Printf("\nVerify attempt %d: %s\n", attempt, p.config.VerifyCommand)
+		verify, err := RunVerifyCommand(ctx, p.config.Target, p.config.VerifyCommand, env, timeout)
+		if err != nil {
+			return combined, err
+		}
+		entry.Verify = verify
+		verification.Attempts = append(verification.Attempts, entry)
+		if before != nil {
+			p.revertVerifyChanges(before)
+		}
+		if ctx.Err() != nil {
+			verification.Stopped = "cancelled"
+			return combined, fmt.Errorf("%w while running verify_command", ErrCancelled)
+		}
+
+		status := verify.Status(GetCatalog(p.config.Locale))
+		fmt.Printf("Verify attempt %d %s in %s\n", attempt, status, time.Duration(verify.DurationMs)*time.Millisecond)
+		if verify.Passed() {
+			verification.Passed = true
+			span.SetAttributes(attribute.Int("verify.attempts", attempt))
+			return combined, nil
+		}
+		fmt.Println(strings.TrimRight(verify.Output, "\n"))
+
+		// Decide whether another repair run is worthwhile
+		switch {
+		case attempt > p.config.VerifyMaxRepairs:
+			verification.Stopped = fmt.Sprintf("no repairs left (verify_max_repairs %d)", p.config.VerifyMaxRepairs)
+		case result.ExitCode != 0:
+			verification.Stopped = fmt.Sprintf("gemini CLI exited with code %d", result.ExitCode)
+		default:
+			if err := budget.Allows(spent, entry.Usage); err != nil {
+				verification.Stopped = err.Error()
+			}
+		}
+		if verification.Stopped != "" {
+			span.SetAttributes(attribute.Int("verify.attempts", attempt))
+			return combined, fmt.Errorf("%w: %s %s after %d attempts; %s",
+				ErrVerifyFailed, p.config.VerifyCommand, status, attempt, verification.Stopped)
+		}
+
+		fmt.Printf("Repair %d of %d: feeding the failure back to the agent\n", attempt, p.config.VerifyMaxRepairs)
+		result, err = p.execute(ctx, RepairPrompt(prompt, p.config.VerifyCommand, verify), verify.Output)
+		if err != nil {
+			return combined, err
+		}
+		combined = mergeResults(combined, result)
+		if err := p.enforcePaths(ctx, snapshot); err != nil {
+			return combined, err
+		}
+		from = before
+	}
+}
+
+// reportPartial displays and writes the report of a run stopped by the timeout or
+// a cancellation: the partial response, if any arrived, and the changes made until
+// then. Gates, budgets and pushes do not apply to an incomplete run.
+func (p *Plugin) reportPartial(result *ExecutionResult, runErr error, elapsed time.Duration) {
+	report := p.newReport(result)
+	if errors.Is(runErr, ErrCancelled) {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("the build was cancelled after %s, before the gemini CLI finished", elapsed.Round(time.Second)))
+	} else {
+		report.Warnings = append(report.Warnings, fmt.Sprintf("the gemini CLI timed out after %s, the response is incomplete", elapsed.Round(time.Second)))
+	}
+
+	if result != nil {
+		p.displayReport(report)
+	}
+	if p.config.ReportFile != "" {
+		if err := p.writeReport(report); err != nil {
+			fmt.Printf("Warning: failed to write report_file: %v\n", err)
+		}
+	}
+}
+
+// revertVerifyChanges reverts the files verify_command changed in the working tree
+func (p *Plugin) revertVerifyChanges(before *WorktreeSnapshot) {
+	changes, err := before.Changes()
+	if err == nil && len(changes) > 0 {
+		err = before.Restore(changes)
+		if err == nil {
+			fmt.Printf("Verify: reverted %d files written by verify_command\n", len(changes))
+		}
+	}
+	if err != nil {
+		fmt.Printf("Warning: failed to revert files written by verify_command: %v\n", err)
+	}
+}
+
+// snapshotWorktree captures the working tree before a run that may modify files,
+// so its changes can be checked and captured. It returns nil for other runs.
+func (p *Plugin) snapshotWorktree() (*WorktreeSnapshot, error) {
+	if !p.config.ModifiesFiles() || p.config.ReplayFile != "" {
+		return nil, nil
+	}
+
+	snapshot, err := NewGitAnalyzer(p.config.Target, p.config.Debug).SnapshotWorktree()
+	if err != nil {
+		// An explicit allowlist cannot be enforced without git, so refuse to run
+		if p.config.AllowedPaths != "" || p.config.PushChanges {
+			return nil, fmt.Errorf("allowed_paths and push_changes require a git repository: %w", err)
+		}
+		fmt.Printf("Warning: changes are not tracked, protected_paths and patch_file do not apply: %v\n", err)
+		return nil, nil
+	}
+	return snapshot, nil
+}
+
+// enforcePaths reverts changes the path guard does not allow and fails with the
+// list of violating files
+func (p *Plugin) enforcePaths(ctx context.Context, snapshot *WorktreeSnapshot) (err error) {
+	guard := NewPathGuard(&p.config)
+	if snapshot == nil || !guard.Enabled() {
+		return nil
+	}
+	_, span := startSpan(ctx, "guard.paths")
+	defer func() { endSpan(span, err) }()
+
+	changes, err := snapshot.Changes()
+	if err != nil {
+		return fmt.Errorf("%w: cannot inspect changes: %v", ErrPathViolation, err)
+	}
+	// Files written by the plugin itself are not the agent's changes
+	changes = withoutPaths(changes, p.pluginFiles(snapshot.Root))
+	violations := guard.Violations(changes)
+	span.SetAttributes(
+		attribute.Int("guard.changes", len(changes)),
+		attribute.Int("guard.violations", len(violations)),
+	)
+	if len(violations) == 0 {
+		if len(changes) > 0 {
+			fmt.Printf("Path guard: %d changed files allowed\n", len(changes))
+		}
+		return nil
+	}
+
+	fmt.Printf("\n⛔ Path guard: %d of %d changed files are not allowed:\n", len(violations), len(changes))
+	files := make([]string, 0, len(violations))
+	reverted := make([]PathChange, 0, len(violations))
+	for _, v := range violations {
+		fmt.Printf("  %s %s (%s)\n", v.Status, v.Path, v.Reason)
+		files = append(files, v.Path)
+		reverted = append(reverted, v.PathChange)
+	}
+	if err := snapshot.Restore(reverted); err != nil {
+		return fmt.Errorf("%w: %s (revert failed: %v)", ErrPathViolation, strings.Join(files, ", "), err)
+	}
+	fmt.Println("Reverted the files above")
+	return fmt.Errorf("%w: %s (reverted)", ErrPathViolation, strings.Join(files, ", "))
+}
+
+// loadConfig validates the configuration, loads pricing and resolves the prompt
+// from the task preset or prompt file
+func (p *Plugin) loadConfig(ctx context.Context) (task *TaskPreset, err error) {
+	_, span := startSpan(ctx, "config.load")
+	defer func() { endSpan(span, err) }()
+
+	// Apply the profile selected for this build before anything reads the settings
+	if p.config.Profiles != "" {
+		build := BuildContextFromEnv()
+		match, err := ApplyProfiles(&p.config, nil, build)
+		if err != nil {
+			return nil, err
+		}
+		if match == nil {
+			fmt.Printf("No profile matched branch %q, event %q, target branch %q\n", build.Branch, build.Event, build.TargetBranch)
+		} else {
+			fmt.Printf("Applied profile %s\n", match)
+			span.SetAttributes(attribute.String("gemini.profile", match.Name))
+		}
+	}
+
+	// Merge external pricing over the built-in table, so models priced there validate
+	if p.config.PricingFile != "" {
+		models, err := LoadPricingFile(p.resolvePath(p.config.PricingFile))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load pricing_file %q: %w", p.config.PricingFile, err)
+		}
+		fmt.Printf("Loaded pricing for %d models from %s: %s\n", len(models), p.config.PricingFile, strings.Join(models, ", "))
+	}
+
 	// Validate configuration
 	if err := p.config.Validate(); err != nil {
-		return err
+		return nil, err
+	}
+	if err := p.checkBranchPolicy(span); err != nil {
+		return nil, err
+	}
+	if p.config.Model != "" && !HasPricing(p.config.Model) {
+		warnUnknownPricing(p.config.Model)
+	}
+
+	// Apply task preset prompt unless overridden
+	if p.config.Task != "" {
+		preset, err := LookupTask(p.config.Task)
+		if err != nil {
+			return nil, err
+		}
+		task = &preset
+		if p.config.Prompt == "" && p.config.PromptFile == "" {
+			p.config.Prompt = preset.Prompt
+		} else {
+			fmt.Printf("Task %q prompt overridden by configuration\n", p.config.Task)
+		}
 	}
 
 	// Load prompt from file if specified
 	if p.config.PromptFile != "" {
 		content, err := p.readFileContent(p.config.PromptFile)
 		if err != nil {
-			return fmt.Errorf("failed to load prompt_file %q: %w", p.config.PromptFile, err)
+			return nil, fmt.Errorf("failed to load prompt_file %q: %w", p.config.PromptFile, err)
 		}
 		fmt.Printf("Loaded prompt from file: %s (%d bytes)\n", p.config.PromptFile, len(content))
 		p.config.Prompt = content
 	}
 
-	// Display configuration summary
-	p.displayConfig()
-
-	// Create CLI executor
-	executor := NewCLIExecutor(&p.config)
+	return task, nil
+}
 
-	// Check if gemini CLI is available
-	if err := executor.CheckGeminiCLI(); err != nil {
-		return err
+// checkBranchPolicy refuses yolo and auto_edit on protected branches, tags and
+// promotions unless protected_override gives a reason, which is audited
+func (p *Plugin) checkBranchPolicy(span trace.Span) error {
+	if !p.config.ModifiesFiles() {
+		return nil
+	}
+	reason := ProtectedBuildReason(&p.config, BuildContextFromEnv())
+	if reason == "" {
+		return nil
+	}
+	mode := modifyingMode(&p.config)
+	if p.config.ProtectedOverride == "" {
+		return fmt.Errorf("%w: %s is refused %s; set protected_override to the reason for allowing it",
+			ErrProtectedBranch, mode, reason)
 	}
 
-	// Build prompt with optional git context
-	prompt := p.config.Prompt
+	p.override = p.config.ProtectedOverride
+	fmt.Printf("⚠️  AUDIT: %s allowed %s by protected_override %q (repo %s, build %s, author %s)\n",
+		mode, reason, p.override, repoName(os.Getenv("DRONE_REPO")),
+		os.Getenv("DRONE_BUILD_NUMBER"), os.Getenv("DRONE_COMMIT_AUTHOR"))
+	span.SetAttributes(attribute.String("gemini.protected_override", p.override))
+	return nil
+}
+
+// buildStdin assembles the stdin input from StdinInput, the context file and git context
+func (p *Plugin) buildStdin(ctx context.Context, task *TaskPreset) (string, error) {
 	stdinInput := p.config.StdinInput
 
 	// Load context from file if specified
 	if p.config.ContextFile != "" {
 		content, err := p.readFileContent(p.config.ContextFile)
 		if err != nil {
-			return fmt.Errorf("failed to load context_file %q: %w", p.config.ContextFile, err)
+			return "", fmt.Errorf("failed to load context_file %q: %w", p.config.ContextFile, err)
 		}
 		fmt.Printf("Loaded context from file: %s (%d bytes)\n", p.config.ContextFile, len(content))
 		if stdinInput != "" {
@@ -65,9 +409,9 @@ func (p *Plugin) Exec() error {
 		}
 	}
 
-	// If git diff mode is enabled, add git context
-	if p.config.GitDiff {
-		gitContext, err := p.buildGitContext()
+	// If a task or git diff mode is enabled, add git context
+	if task != nil || p.config.GitDiff {
+		gitContext, err := p.buildGitContext(ctx, task)
 		if err != nil {
 			fmt.Printf("Warning: failed to build git context: %v\n", err)
 		} else {
@@ -80,27 +424,466 @@ func (p *Plugin) Exec() error {
 		}
 	}
 
+	return stdinInput, nil
+}
+
+// capturePatch records the changes of the run for the report and writes them to
+// PatchFile. Failures are reported but never fail the step.
+func (p *Plugin) capturePatch(snapshot *WorktreeSnapshot) {
+	if snapshot == nil {
+		return
+	}
+	patch, err := snapshot.Patch(p.pluginFiles(snapshot.Root))
+	if err != nil {
+		fmt.Printf("Warning: failed to capture changes: %v\n", err)
+		return
+	}
+	p.snapshot, p.patch = snapshot, patch
+
+	fmt.Printf("Changes: %s\n", &patch.Summary)
+	for _, file := range patch.Summary.Files {
+		fmt.Printf("  %s\n", file)
+	}
+
+	if p.config.PatchFile == "" {
+		return
+	}
+	filePath := p.resolvePath(p.config.PatchFile)
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		fmt.Printf("Warning: failed to write patch_file: %v\n", err)
+		return
+	}
+	if err := os.WriteFile(filePath, []byte(patch.Diff), 0o644); err != nil {
+		fmt.Printf("Warning: failed to write patch_file: %v\n", err)
+		return
+	}
+	patch.Summary.PatchFile = p.config.PatchFile
+	fmt.Printf("Wrote patch to %s (%d bytes)\n", filePath, len(patch.Diff))
+}
+
+// newReport creates the report of a result, including the changes of the run
+func (p *Plugin) newReport(result *ExecutionResult) *Report {
+	report := NewReport(&p.config, result)
+	if p.patch != nil {
+		report.AddChanges(p.patch)
+	}
+	report.Verification = p.verification
+	return report
+}
+
+// pluginFiles returns the files inside the repository the plugin itself writes
+// during a run, such as the record_file, relative to the repository root
+func (p *Plugin) pluginFiles(root string) []string {
+	var files []string
+	for _, name := range []string{p.config.RecordFile} {
+		if name == "" {
+			continue
+		}
+		abs, err := filepath.Abs(p.resolvePath(name))
+		if err != nil {
+			continue
+		}
+		if resolved, err := filepath.EvalSymlinks(abs); err == nil {
+			abs = resolved
+		}
+		if rel, err := filepath.Rel(root, abs); err == nil && !strings.HasPrefix(rel, "..") {
+			files = append(files, filepath.ToSlash(rel))
+		}
+	}
+	return files
+}
+
+// report displays the result, writes the report and output files, enforces the
+// budget and exports metrics. checkErr is a path guard violation or a failed
+// verification of the run.
+func (p *Plugin) report(ctx context.Context, result *ExecutionResult, start time.Time, checkErr error) (err error) {
+	_, span := startSpan(ctx, "report", attribute.String("report.format", p.config.ReportFormat))
+	defer func() { endSpan(span, err) }()
+
+	// Display results
+	p.displayResult(result)
+
+	// Write rendered report to file if specified
+	if p.config.ReportFile != "" {
+		if err := p.writeReportFile(result); err != nil {
+			return fmt.Errorf("failed to write report_file %q: %w", p.config.ReportFile, err)
+		}
+	}
+
+	// Enforce budget on actual usage (cached responses cost nothing), then the findings gate
+	runErr := errors.Join(checkErr, p.checkBudget(result))
+	if runErr == nil {
+		runErr = p.checkFindings(result)
+	}
+	p.recordRun(result, runErr, time.Since(start))
+	if runErr != nil && !errors.Is(runErr, ErrFindingsGate) {
+		return runErr
+	}
+
+	// Write response to file if specified, also when the gate failed so findings can be published
+	if p.config.OutputFile != "" {
+		if err := p.writeOutputFile(result); err != nil {
+			return fmt.Errorf("failed to write output_file %q: %w", p.config.OutputFile, err)
+		}
+	}
+	if runErr != nil {
+		return runErr
+	}
+
+	// Only changes of a successful run are pushed
+	if !p.config.PushChanges {
+		return nil
+	}
+	if err := p.pushChanges(ctx); err != nil {
+		return err
+	}
+	if p.config.PullRequest {
+		return p.openPullRequest(ctx, result)
+	}
+	return nil
+}
+
+// pushChanges commits the agent's changes and pushes them to a new branch
+func (p *Plugin) pushChanges(ctx context.Context) (err error) {
+	_, span := startSpan(ctx, "git.push")
+	defer func() { endSpan(span, err) }()
+
+	if p.snapshot == nil || p.patch == nil || len(p.patch.Summary.Files) == 0 {
+		fmt.Println("Push: no changes to commit")
+		return nil
+	}
+
+	build := os.Getenv("DRONE_BUILD_NUMBER")
+	branch := PushBranchName(p.config.PushBranch, build)
+	if pattern, ok := matchPatterns(splitList(p.config.ProtectedBranches), branch); ok {
+		return fmt.Errorf("%w: push_branch %q matches protected branch %q", ErrProtectedBranch, branch, pattern)
+	}
+
+	git := NewGitAnalyzer(p.snapshot.Root, p.config.Debug)
+	// The commit is built on the HEAD from before the run: commits the agent made
+	// itself bypass the path guard, which only checks the working tree
+	if head := git.headSHA(); head != p.snapshot.Head {
+		fmt.Printf("Warning: HEAD moved from %s to %s during the run, commits made by the agent are not pushed\n",
+			shortSHA(p.snapshot.Head), shortSHA(head))
+	}
+	files := p.patch.Summary.Paths()
+	message := CommitMessage(&p.config, &p.patch.Summary, build)
+	sha, err := git.CommitChanges(p.snapshot.Head, files, message, p.config.CommitAuthorName, p.config.CommitAuthorEmail)
+	if err != nil {
+		return err
+	}
+	if p.config.Debug {
+		fmt.Printf("[DEBUG] Commit %s:\n%s\n", shortSHA(sha), message)
+	}
+
+	if err := git.PushCommit(p.config.PushRemote, sha, branch, NetrcFromEnv(), p.config.PushForce); err != nil {
+		return err
+	}
+	subject, _, _ := strings.Cut(message, "\n")
+	p.pushed = &PushResult{Remote: p.config.PushRemote, Branch: branch, SHA: sha, Subject: subject, Files: files}
+	span.SetAttributes(attribute.String("git.branch", branch), attribute.String("git.sha", sha))
+
+	fmt.Printf("Pushed %d files to %s on %s (%s)\n", len(files), branch, redactURL(p.config.PushRemote), shortSHA(sha))
+	return nil
+}
+
+// openPullRequest opens a pull request for the pushed branch, or updates the open one
+func (p *Plugin) openPullRequest(ctx context.Context, result *ExecutionResult) (err error) {
+	ctx, span := startSpan(ctx, "scm.pull_request")
+	defer func() { endSpan(span, err) }()
+
+	if p.pushed == nil {
+		return nil
+	}
+
+	repo := os.Getenv("DRONE_REPO")
+	base := p.config.PullRequestBase
+	if base == "" {
+		base = os.Getenv("DRONE_SOURCE_BRANCH")
+	}
+	if base == "" {
+		base = os.Getenv("DRONE_BRANCH")
+	}
+	if repo == "" || base == "" {
+		return fmt.Errorf("%w: DRONE_REPO and DRONE_BRANCH are required, or set pull_request_base", ErrPullRequest)
+	}
+
+	provider, apiURL, err := DetectSCM(p.config.SCMProvider, p.config.SCMURL, os.Getenv("DRONE_REPO_LINK"))
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrPullRequest, err)
+	}
+	token := p.config.SCMToken
+	if netrc := NetrcFromEnv(); token == "" && netrc != nil {
+		// The clone credentials are only sent to the host they were issued for
+		if !netrcServesAPI(netrc, apiURL) {
+			return fmt.Errorf("%w: set scm_token, the Drone netrc credentials for %s are not sent to %s",
+				ErrPullRequest, netrc.Machine, redactURL(apiURL))
+		}
+		token = netrc.Password
+	}
+	if token == "" {
+		return fmt.Errorf("%w: set scm_token, no Drone netrc credentials are available", ErrPullRequest)
+	}
+	client, err := NewPullRequestProvider(provider, apiURL, token)
+	if err != nil {
+		return err
+	}
+
+	body, err := PullRequestBody(p.newReport(result))
+	if err != nil {
+		return err
+	}
+	pr, err := client.CreateOrUpdate(ctx, PullRequest{
+		Repo:  repo,
+		Head:  p.pushed.Branch,
+		Base:  base,
+		Title: p.pushed.Subject,
+		Body:  body,
+	})
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrPullRequest, err)
+	}
+	span.SetAttributes(attribute.String("scm.provider", provider), attribute.Int("scm.pull_request", pr.Number))
+
+	action := "Opened"
+	if pr.Updated {
+		action = "Updated"
+	}
+	fmt.Printf("%s pull request #%d into %s: %s\n", action, pr.Number, base, pr.URL)
+	return nil
+}
+
+// checkFindings fails the run when the response reports findings at or above FailOn
+func (p *Plugin) checkFindings(result *ExecutionResult) error {
+	if p.config.FailOn == "" || result == nil || result.Response == nil {
+		return nil
+	}
+
+	counts := CountFindings(result.Response.Response)
+	var found []string
+	for _, severity := range FailOnSeverities {
+		if n := counts[strings.ToUpper(severity)]; n > 0 {
+			found = append(found, fmt.Sprintf("%d %s", n, strings.ToUpper(severity)))
+		}
+		if severity == p.config.FailOn {
+			break
+		}
+	}
+	if len(found) == 0 {
+		fmt.Printf("Gate: no findings at or above %s\n", p.config.FailOn)
+		return nil
+	}
+	return fmt.Errorf("%w: %s (fail_on: %s)", ErrFindingsGate, strings.Join(found, ", "), p.config.FailOn)
+}
+
+// writeOutputFile writes the AI response to OutputFile, resolving path relative to Target directory
+func (p *Plugin) writeOutputFile(result *ExecutionResult) error {
+	if result == nil || result.Response == nil {
+		return fmt.Errorf("no response to write")
+	}
+
+	filePath := p.resolvePath(p.config.OutputFile)
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		return err
+	}
+
+	content := strings.TrimSpace(result.Response.Response) + "\n"
+	if err := os.WriteFile(filePath, []byte(content), 0o644); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote response to %s (%d bytes)\n", filePath, len(content))
+	return nil
+}
+
+// resolvePath resolves a relative path against the Target directory
+func (p *Plugin) resolvePath(filePath string) string {
+	return resolveTargetPath(p.config.Target, filePath)
+}
+
+// resolveTargetPath resolves a relative path against a target directory
+func resolveTargetPath(target, filePath string) string {
+	if !filepath.IsAbs(filePath) {
+		filePath = filepath.Join(target, filePath)
+	}
+	return filePath
+}
+
+// execute runs the gemini CLI, serving identical requests from the response cache when enabled
+func (p *Plugin) execute(ctx context.Context, prompt, stdinInput string) (*ExecutionResult, error) {
+	// Replay a recorded invocation instead of calling the API
+	if p.config.ReplayFile != "" {
+		rec, err := LoadRecording(p.resolvePath(p.config.ReplayFile))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load replay_file %q: %w", p.config.ReplayFile, err)
+		}
+		fmt.Printf("Replaying recorded invocation from %s (recorded %s)\n", p.config.ReplayFile, rec.RecordedAt.Format(time.RFC3339))
+		fmt.Println()
+		return NewCLIExecutor(&p.config).WithContext(ctx).Replay(rec)
+	}
+
+	var cache *ResponseCache
+	var cacheKey string
+	if p.config.CacheDir != "" {
+		if Cacheable(&p.config) {
+			cache = NewResponseCache(
+				p.resolvePath(p.config.CacheDir),
+				time.Duration(p.config.CacheTTL)*time.Second,
+				int64(p.config.CacheMaxSize)*1024*1024,
+				p.config.Debug,
+			)
+			commitSHA := NewGitAnalyzer(p.config.Target, p.config.Debug).WithContext(ctx).DetectCommitSHA(p.config.GitCommitSHA)
+			cacheKey = CacheKey(&p.config, commitSHA, prompt, stdinInput)
+			if result, ok := cache.Get(cacheKey); ok {
+				fmt.Printf("Cache hit: %s (skipping gemini CLI execution)\n", cacheKey[:12])
+				fmt.Println()
+				return result, nil
+			}
+			fmt.Printf("Cache miss: %s\n", cacheKey[:12])
+		} else {
+			fmt.Println("Cache: disabled for runs that modify files (yolo/auto_edit)")
+		}
+	}
+
+	// Refuse runs once the repo spent its monthly budget
+	if p.config.MonthlyMaxCostUSD > 0 && p.config.LedgerFile != "" {
+		repo := os.Getenv("DRONE_REPO")
+		spend, err := CheckMonthlyBudget(p.resolvePath(p.config.LedgerFile), repo, p.config.MonthlyMaxCostUSD)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("Monthly budget: %s spent $%.4f of $%.4f in %s\n", repoName(repo), spend.CostUSD, p.config.MonthlyMaxCostUSD, spend.Month)
+	}
+
+	// Refuse runs whose input alone would exceed the budget
+	if budget := p.budget(); budget.Enabled() {
+		est, err := budget.CheckEstimate(p.config.Model, prompt, stdinInput)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Printf("Budget check: ~%d input tokens, ~%s estimated input cost\n", est.InputTokens, formatCost(est.CostUSD, est.CostKnown, 4))
+	}
+
+	// Create CLI executor
+	executor := NewCLIExecutor(&p.config).WithContext(ctx)
+
+	// Check if gemini CLI is available
+	if err := executor.CheckGeminiCLI(); err != nil {
+		return nil, err
+	}
+
 	// Execute CLI
 	fmt.Println("Executing gemini CLI...")
 	fmt.Println()
 
 	result, err := executor.Execute(prompt, stdinInput)
 	if err != nil {
-		return err
+		// A run stopped by the timeout or a cancellation keeps its partial result
+		if result != nil && result.Truncated {
+			return result, err
+		}
+		return nil, err
 	}
 
-	// Display results
-	p.displayResult(result)
+	if cache != nil {
+		if err := cache.Put(cacheKey, p.config.Model, result); err != nil {
+			fmt.Printf("Warning: failed to store response in cache: %v\n", err)
+		}
+	}
 
-	return nil
+	return result, nil
+}
+
+// checkBudget compares actual usage with the budget, failing or warning per BudgetAction
+func (p *Plugin) checkBudget(result *ExecutionResult) error {
+	budget := p.budget()
+	if !budget.Enabled() || result == nil || result.Cached || result.Response == nil {
+		return nil
+	}
+
+	usage, err := budget.CheckActual(result.Response.Stats)
+
+	// Record this step's usage for later steps of the pipeline
+	if budget.PipelineEnabled() {
+		path := p.resolvePath(p.config.PipelineUsageFile)
+		pipeline := LoadPipelineUsage(path, os.Getenv("DRONE_BUILD_NUMBER"))
+		if saveErr := SavePipelineUsage(path, pipeline, usage); saveErr != nil {
+			fmt.Printf("Warning: failed to save pipeline usage: %v\n", saveErr)
+		}
+		fmt.Printf("Pipeline budget: %d tokens, %s used across %d runs\n",
+			pipeline.Tokens+usage.Tokens,
+			formatCost(pipeline.CostUSD+usage.CostUSD, !pipeline.UnknownCost && !usage.UnknownCost, 4),
+			pipeline.Runs+1)
+	}
+
+	if err == nil {
+		fmt.Printf("Budget: %d tokens, %s used\n", usage.Tokens, formatCost(usage.CostUSD, !usage.UnknownCost, 4))
+		return nil
+	}
+
+	if p.config.BudgetAction == BudgetActionWarn {
+		fmt.Printf("\n⚠️  Warning: %v\n", err)
+		return nil
+	}
+	return err
+}
+
+// recordRun appends the run to the ledger and exports its metrics
+func (p *Plugin) recordRun(result *ExecutionResult, runErr error, duration time.Duration) {
+	if p.config.LedgerFile != "" {
+		entry := NewLedgerEntry(&p.config, result, runErr, duration)
+		entry.Override = p.override
+		if err := AppendLedger(p.resolvePath(p.config.LedgerFile), entry); err != nil {
+			fmt.Printf("Warning: failed to append to ledger_file: %v\n", err)
+		} else if p.config.Debug {
+			fmt.Printf("[DEBUG] Ledger: %s %s %d tokens %s (%s)\n", repoName(entry.Repo), entry.Model,
+				entry.TotalTokens, formatCost(entry.CostUSD, entry.CostKnown, 4), entry.Outcome)
+		}
+	}
+
+	p.exportMetrics(result, runErr, duration)
+}
+
+// exportMetrics writes and pushes the Prometheus metrics of a run. Export
+// failures are reported but never fail the step.
+func (p *Plugin) exportMetrics(result *ExecutionResult, runErr error, duration time.Duration) {
+	if p.config.MetricsFile == "" && p.config.MetricsPushgateway == "" {
+		return
+	}
+
+	metrics := NewRunMetrics(MetricLabelsFromEnv(), p.config.Model, result, runErr, duration)
+
+	if p.config.MetricsFile != "" {
+		path := p.resolvePath(p.config.MetricsFile)
+		if err := metrics.WriteTextfile(path); err != nil {
+			fmt.Printf("Warning: failed to write metrics_file: %v\n", err)
+		} else {
+			fmt.Printf("Wrote metrics to %s (outcome: %s)\n", path, metrics.Outcome)
+		}
+	}
+
+	if p.config.MetricsPushgateway != "" {
+		if err := metrics.Push(p.config.MetricsPushgateway, p.config.MetricsJob); err != nil {
+			fmt.Printf("Warning: failed to push metrics: %v\n", err)
+		} else {
+			fmt.Printf("Pushed metrics to %s (job: %s, outcome: %s)\n", redactURL(p.config.MetricsPushgateway), p.config.MetricsJob, metrics.Outcome)
+		}
+	}
+}
+
+// budget returns the configured budget including the usage of earlier pipeline steps
+func (p *Plugin) budget() Budget {
+	budget := NewBudget(&p.config)
+	if budget.PipelineEnabled() {
+		budget.Spent = LoadPipelineUsage(p.resolvePath(p.config.PipelineUsageFile), os.Getenv("DRONE_BUILD_NUMBER")).BudgetUsage
+	}
+	return budget
 }
 
 // readFileContent reads file content, resolving path relative to Target directory
 func (p *Plugin) readFileContent(filePath string) (string, error) {
 	// Resolve relative paths based on Target directory
-	if !filepath.IsAbs(filePath) {
-		filePath = filepath.Join(p.config.Target, filePath)
-	}
+	filePath = p.resolvePath(filePath)
 
 	// Check if file exists
 	info, err := os.Stat(filePath)
@@ -130,9 +913,16 @@ func (p *Plugin) readFileContent(filePath string) (string, error) {
 	return content, nil
 }
 
-// buildGitContext builds git context for the prompt
-func (p *Plugin) buildGitContext() (string, error) {
-	analyzer := NewGitAnalyzer(p.config.Target, p.config.Debug)
+// buildGitContext builds git context for the prompt, using the task's
+// context builder when a task is selected
+func (p *Plugin) buildGitContext(ctx context.Context, task *TaskPreset) (gitContext string, err error) {
+	_, span := startSpan(ctx, "git.context")
+	defer func() {
+		span.SetAttributes(attribute.Int("git.context_bytes", len(gitContext)))
+		endSpan(span, err)
+	}()
+
+	analyzer := NewGitAnalyzer(p.config.Target, p.config.Debug).WithContext(ctx)
 
 	if !analyzer.IsGitRepository() {
 		return "", fmt.Errorf("not a git repository: %s", p.config.Target)
@@ -143,6 +933,10 @@ func (p *Plugin) buildGitContext() (string, error) {
 		return "", fmt.Errorf("could not detect commit SHA")
 	}
 
+	if task != nil {
+		return task.BuildContext(analyzer, sha)
+	}
+
 	return analyzer.BuildGitContext(sha)
 }
 
@@ -152,6 +946,10 @@ func (p *Plugin) displayConfig() {
 	fmt.Println("--- Configuration ---")
 	fmt.Printf("Target: %s\n", p.config.Target)
 	fmt.Printf("Model: %s\n", p.config.Model)
+	fmt.Printf("Pricing: %s\n", describePricing(p.config.Model))
+	if p.config.Task != "" {
+		fmt.Printf("Task: %s\n", p.config.Task)
+	}
 	fmt.Printf("Prompt: %s\n", truncateString(p.config.Prompt, 100))
 	fmt.Printf("Output Format: %s\n", p.config.OutputFormat)
 	fmt.Printf("Timeout: %ds\n", p.config.Timeout)
@@ -164,6 +962,10 @@ func (p *Plugin) displayConfig() {
 		fmt.Printf("Context File: %s\n", p.config.ContextFile)
 	}
 
+	if p.config.OutputFile != "" {
+		fmt.Printf("Output File: %s\n", p.config.OutputFile)
+	}
+
 	// Display authentication mode
 	authMode := p.config.DetectAuthMode()
 	switch authMode {
@@ -191,6 +993,90 @@ func (p *Plugin) displayConfig() {
 		fmt.Println("Git Diff: enabled")
 	}
 
+	if p.config.FailOn != "" {
+		fmt.Printf("Fail On: %s\n", p.config.FailOn)
+	}
+
+	if p.config.Sandbox {
+		fmt.Println("Sandbox: enabled")
+	}
+	if p.config.VerifyCommand != "" {
+		fmt.Printf("Verify: %s (up to %d repairs)\n", p.config.VerifyCommand, p.config.VerifyMaxRepairs)
+	}
+	if p.config.PushChanges {
+		fmt.Printf("Push: %s to %s\n", PushBranchName(p.config.PushBranch, os.Getenv("DRONE_BUILD_NUMBER")), redactURL(p.config.PushRemote))
+	}
+	if p.config.PullRequest && p.config.SCMProvider != "" {
+		fmt.Printf("Pull Request: %s\n", p.config.SCMProvider)
+	} else if p.config.PullRequest {
+		fmt.Println("Pull Request: detected from DRONE_REPO_LINK")
+	}
+
+	if p.config.ModifiesFiles() {
+		if p.config.AllowedPaths != "" {
+			fmt.Printf("Allowed Paths: %s\n", p.config.AllowedPaths)
+		}
+		if p.config.ProtectedPaths != "" {
+			fmt.Printf("Protected Paths: %s\n", p.config.ProtectedPaths)
+		}
+	}
+
+	if p.config.ReportFormat != "" && p.config.ReportFormat != ReportFormatPlain {
+		fmt.Printf("Report Format: %s\n", p.config.ReportFormat)
+	}
+
+	if p.config.ReportFile != "" {
+		fmt.Printf("Report File: %s\n", p.config.ReportFile)
+	}
+
+	if p.config.PatchFile != "" {
+		fmt.Printf("Patch File: %s\n", p.config.PatchFile)
+	}
+
+	if p.config.RecordFile != "" {
+		fmt.Printf("Record File: %s\n", p.config.RecordFile)
+	}
+
+	if p.config.ReplayFile != "" {
+		fmt.Printf("Replay File: %s\n", p.config.ReplayFile)
+	}
+
+	if p.config.MaxCostUSD > 0 || p.config.MaxTokens > 0 {
+		fmt.Printf("Budget: max $%.4f, max %d tokens (on overrun: %s)\n", p.config.MaxCostUSD, p.config.MaxTokens, p.config.BudgetAction)
+	}
+
+	if p.config.PipelineMaxCostUSD > 0 || p.config.PipelineMaxTokens > 0 {
+		fmt.Printf("Pipeline Budget: max $%.4f, max %d tokens\n", p.config.PipelineMaxCostUSD, p.config.PipelineMaxTokens)
+	}
+
+	if p.config.LedgerFile != "" {
+		if p.config.MonthlyMaxCostUSD > 0 {
+			fmt.Printf("Ledger: %s (monthly budget: $%.2f)\n", p.config.LedgerFile, p.config.MonthlyMaxCostUSD)
+		} else {
+			fmt.Printf("Ledger: %s\n", p.config.LedgerFile)
+		}
+	}
+
+	if p.config.CacheDir != "" {
+		fmt.Printf("Cache: %s (TTL: %ds, Max: %dMB)\n", p.config.CacheDir, p.config.CacheTTL, p.config.CacheMaxSize)
+	}
+
+	if p.config.MetricsFile != "" {
+		fmt.Printf("Metrics File: %s\n", p.config.MetricsFile)
+	}
+
+	if p.config.MetricsPushgateway != "" {
+		fmt.Printf("Metrics Pushgateway: %s (job: %s)\n", redactURL(p.config.MetricsPushgateway), p.config.MetricsJob)
+	}
+
+	if p.config.TraceEndpoint != "" {
+		fmt.Printf("Trace Endpoint: %s (service: %s)\n", redactURL(p.config.TraceEndpoint), p.config.TraceServiceName)
+	}
+
+	if locale, _ := NormalizeLocale(p.config.Locale); locale != LocaleEnglish {
+		fmt.Printf("Locale: %s\n", locale)
+	}
+
 	if p.config.Debug {
 		fmt.Println("Debug: enabled")
 	}
@@ -198,26 +1084,50 @@ func (p *Plugin) displayConfig() {
 	fmt.Println()
 }
 
-// displayResult shows the execution result
+// displayResult renders the execution result in the configured report format
 func (p *Plugin) displayResult(result *ExecutionResult) {
-	if result == nil || result.Response == nil {
-		fmt.Println("No response received")
-		return
+	p.displayReport(p.newReport(result))
+}
+
+// displayReport renders a report to stdout
+func (p *Plugin) displayReport(report *Report) {
+	renderer, err := NewReportRenderer(p.config.ReportFormat)
+	if err != nil {
+		fmt.Printf("Warning: %v, using %s\n", err, ReportFormatPlain)
+		renderer = plainRenderer{}
 	}
+	if err := renderer.Render(os.Stdout, report); err != nil {
+		fmt.Printf("Warning: failed to render report: %v\n", err)
+	}
+}
 
-	fmt.Println("=== AI Response ===")
-	fmt.Println()
-	fmt.Println(result.Response.Response)
+// writeReportFile writes the rendered report to ReportFile, resolving path relative to Target directory
+func (p *Plugin) writeReportFile(result *ExecutionResult) error {
+	return p.writeReport(p.newReport(result))
+}
 
-	// Display statistics
-	if result.Response.Stats != nil {
-		fmt.Print(FormatStats(result.Response.Stats))
+// writeReport renders a report to ReportFile
+func (p *Plugin) writeReport(report *Report) error {
+	renderer, err := NewReportRenderer(p.config.ReportFormat)
+	if err != nil {
+		return err
 	}
 
-	// Display exit code if non-zero
-	if result.ExitCode != 0 {
-		fmt.Printf("\n⚠️  Exit Code: %d\n", result.ExitCode)
+	var sb strings.Builder
+	if err := renderer.Render(&sb, report); err != nil {
+		return err
 	}
+
+	filePath := p.resolvePath(p.config.ReportFile)
+	if err := os.MkdirAll(filepath.Dir(filePath), 0o755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(filePath, []byte(sb.String()), 0o644); err != nil {
+		return err
+	}
+
+	fmt.Printf("Wrote %s report to %s (%d bytes)\n", p.config.ReportFormat, filePath, sb.Len())
+	return nil
 }
 
 // truncateString truncates a string to max length with ellipsis
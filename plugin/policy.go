@@ -0,0 +1,50 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+)
+
+// protectedEvents are build events on which the agent may never modify files
+var protectedEvents = []string{"tag", "promote"}
+
+// BuildContext describes the build that profiles and the branch policy are checked against
+type BuildContext struct {
+	Branch       string
+	Event        string
+	TargetBranch string
+}
+
+// BuildContextFromEnv reads the build from Drone's environment
+func BuildContextFromEnv() BuildContext {
+	return BuildContext{
+		Branch:       os.Getenv("DRONE_BRANCH"),
+		Event:        os.Getenv("DRONE_BUILD_EVENT"),
+		TargetBranch: os.Getenv("DRONE_TARGET_BRANCH"),
+	}
+}
+
+// ProtectedBuildReason returns why the build is protected from file-modifying runs,
+// or "" when it is not: a tag or promote event, or a branch or target branch
+// matching ProtectedBranches
+func ProtectedBuildReason(cfg *Config, build BuildContext) string {
+	if containsString(protectedEvents, build.Event) {
+		return fmt.Sprintf("on %s events", build.Event)
+	}
+	patterns := splitList(cfg.ProtectedBranches)
+	if pattern, ok := matchPatterns(patterns, build.Branch); ok {
+		return fmt.Sprintf("on protected branch %q (matches %q)", build.Branch, pattern)
+	}
+	if pattern, ok := matchPatterns(patterns, build.TargetBranch); ok {
+		return fmt.Sprintf("targeting protected branch %q (matches %q)", build.TargetBranch, pattern)
+	}
+	return ""
+}
+
+// modifyingMode names the setting that lets the agent modify files
+func modifyingMode(cfg *Config) string {
+	if cfg.Yolo {
+		return "yolo"
+	}
+	return "approval_mode " + cfg.ApprovalMode
+}
@@ -0,0 +1,110 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestProtectedBuildReason(t *testing.T) {
+	cfg := &Config{ProtectedBranches: "main, master, release/*"}
+	tests := []struct {
+		name  string
+		build BuildContext
+		want  string
+	}{
+		{name: "feature push", build: BuildContext{Branch: "fix/login", Event: "push"}, want: ""},
+		{name: "main push", build: BuildContext{Branch: "main", Event: "push"}, want: `on protected branch "main"`},
+		{name: "release glob", build: BuildContext{Branch: "release/1.2", Event: "push"}, want: `matches "release/*"`},
+		{name: "pr to main", build: BuildContext{Branch: "fix/login", Event: "pull_request", TargetBranch: "main"}, want: `targeting protected branch "main"`},
+		{name: "pr to dev", build: BuildContext{Branch: "fix/login", Event: "pull_request", TargetBranch: "dev"}, want: ""},
+		{name: "tag", build: BuildContext{Event: "tag"}, want: "on tag events"},
+		{name: "promote", build: BuildContext{Branch: "dev", Event: "promote"}, want: "on promote events"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := ProtectedBuildReason(cfg, tt.build)
+			if (tt.want == "") != (got == "") || !strings.Contains(got, tt.want) {
+				t.Errorf("ProtectedBuildReason() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if got := ProtectedBuildReason(&Config{}, BuildContext{Branch: "main", Event: "push"}); got != "" {
+		t.Errorf("ProtectedBuildReason() without protected branches = %q", got)
+	}
+}
+
+func TestDefaultProtectedBranchesRefusePullRequests(t *testing.T) {
+	// Pinned on purpose: with the default protected_branches, yolo is refused on a
+	// pull request from a fix branch into main, since the changes target main
+	field, _ := reflect.TypeOf(Config{}).FieldByName("ProtectedBranches")
+	cfg := &Config{ProtectedBranches: field.Tag.Get("default")}
+	build := BuildContext{Branch: "fix/x", Event: "pull_request", TargetBranch: "main"}
+	if got := ProtectedBuildReason(cfg, build); !strings.Contains(got, `targeting protected branch "main"`) {
+		t.Errorf("ProtectedBuildReason() = %q, want the pull request into main refused", got)
+	}
+	if got := ProtectedBuildReason(cfg, BuildContext{Branch: "fix/x", Event: "push"}); got != "" {
+		t.Errorf("ProtectedBuildReason() for a fix branch push = %q, want allowed", got)
+	}
+}
+
+func TestCheckBranchPolicy(t *testing.T) {
+	span := trace.SpanFromContext(context.Background())
+	t.Setenv("DRONE_BRANCH", "main")
+	t.Setenv("DRONE_BUILD_EVENT", "push")
+	t.Setenv("DRONE_REPO", "octo/app")
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr string
+	}{
+		{name: "read-only run", cfg: Config{}},
+		{name: "yolo refused", cfg: Config{Yolo: true}, wantErr: `yolo is refused on protected branch "main"`},
+		{name: "auto_edit refused", cfg: Config{ApprovalMode: "auto_edit"}, wantErr: "approval_mode auto_edit is refused"},
+		{name: "override", cfg: Config{Yolo: true, ProtectedOverride: "hotfix INC-42"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.ProtectedBranches = "main,release/*"
+			p := New(tt.cfg)
+			err := p.checkBranchPolicy(span)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("checkBranchPolicy() error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrProtectedBranch) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("checkBranchPolicy() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProtectedOverrideAudited(t *testing.T) {
+	t.Setenv("DRONE_BRANCH", "main")
+	ledger := filepath.Join(t.TempDir(), "ledger.jsonl")
+
+	p := New(Config{Model: "gemini-2.5-pro", Yolo: true, ProtectedBranches: "main", ProtectedOverride: "hotfix INC-42", LedgerFile: ledger})
+	if err := p.checkBranchPolicy(trace.SpanFromContext(context.Background())); err != nil {
+		t.Fatalf("checkBranchPolicy() error: %v", err)
+	}
+	p.recordRun(&ExecutionResult{Response: &CLIResponse{}}, nil, 0)
+
+	entries, _, err := ReadLedger(ledger)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("ReadLedger() = %v, %v", entries, err)
+	}
+	if entries[0].Override != "hotfix INC-42" {
+		t.Errorf("ledger override = %q, want the reason", entries[0].Override)
+	}
+}
@@ -0,0 +1,110 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// warnedModels remembers models already reported as unpriced
+var warnedModels sync.Map
+
+// LoadPricingFile merges a YAML or JSON pricing file over the built-in PricingTable.
+// Fields omitted for a known model keep their built-in value. It returns the
+// names of the models that were added or changed.
+//
+//	gemini-2.5-pro:
+//	  output_price: 10.00
+//	my-tuned-model:
+//	  name: My Tuned Model
+//	  input_price: 0.50
+//	  output_price: 2.00
+func LoadPricingFile(path string) ([]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s", ErrFileNotFound, path)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrFileRead, err)
+	}
+
+	// JSON is valid YAML, so one decoder handles both formats
+	var entries map[string]yaml.Node
+	if err := yaml.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("%w: invalid pricing file %s: %v", ErrFileRead, path, err)
+	}
+
+	var models []string
+	for model, node := range entries {
+		pricing := PricingTable[model]
+		if err := node.Decode(&pricing); err != nil {
+			return nil, fmt.Errorf("%w: invalid pricing for %q in %s: %v", ErrFileRead, model, path, err)
+		}
+		if pricing.Name == "" {
+			pricing.Name = model
+		}
+		// Models without tiers only need the short prices
+		if pricing.InputPriceLong == 0 {
+			pricing.InputPriceLong = pricing.InputPriceShort
+		}
+		if pricing.OutputPriceLong == 0 {
+			pricing.OutputPriceLong = pricing.OutputPriceShort
+		}
+		if pricing.CachedPriceLong == 0 {
+			pricing.CachedPriceLong = pricing.CachedPriceShort
+		}
+		PricingTable[model] = pricing
+		models = append(models, model)
+	}
+	sort.Strings(models)
+
+	return models, nil
+}
+
+// HasPricing reports whether a model has a known price
+func HasPricing(modelName string) bool {
+	_, ok := lookupPricing(modelName)
+	return ok
+}
+
+// warnUnknownPricing prints a warning the first time an unpriced model is seen
+func warnUnknownPricing(modelName string) {
+	if _, seen := warnedModels.LoadOrStore(modelName, true); seen {
+		return
+	}
+	fmt.Printf("\n⚠️  WARNING: no pricing for model %q, its cost is reported as unknown.\n", modelName)
+	if match, ok := suggestModel(modelName); ok {
+		fmt.Printf("   Did you mean %q? Check the model setting if this is a typo.\n", match)
+	}
+	fmt.Println("   Add it to a pricing_file to track spend for this model.")
+}
+
+// formatCost renders a cost, or "unknown" when any part is unpriced
+func formatCost(cost float64, known bool, precision int) string {
+	if !known {
+		return "unknown"
+	}
+	return fmt.Sprintf("$%.*f", precision, cost)
+}
+
+// describePricing returns a short summary of a model's prices for logs
+func describePricing(model string) string {
+	pricing, ok := lookupPricing(model)
+	if !ok {
+		return "unknown"
+	}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("input $%.4g/M, output $%.4g/M", pricing.InputPriceShort, pricing.OutputPriceShort))
+	if pricing.CachedPriceShort > 0 {
+		sb.WriteString(fmt.Sprintf(", cached $%.4g/M", pricing.CachedPriceShort))
+	}
+	if pricing.LongContextThreshold > 0 {
+		sb.WriteString(fmt.Sprintf(" (long context above %d tokens: input $%.4g/M, output $%.4g/M)",
+			pricing.LongContextThreshold, pricing.InputPriceLong, pricing.OutputPriceLong))
+	}
+	return sb.String()
+}
@@ -0,0 +1,113 @@
+package plugin
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// restorePricingTable restores the built-in pricing after a test modifies it
+func restorePricingTable(t *testing.T) {
+	t.Helper()
+	saved := make(map[string]ModelPricing, len(PricingTable))
+	for k, v := range PricingTable {
+		saved[k] = v
+	}
+	t.Cleanup(func() { PricingTable = saved })
+}
+
+func TestLoadPricingFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{
+			name: "yaml",
+			file: "pricing.yml",
+			content: `gemini-2.5-pro:
+  output_price: 12.00
+my-tuned-model:
+  name: My Tuned Model
+  input_price: 0.50
+  output_price: 2.00
+`,
+		},
+		{
+			name:    "json",
+			file:    "pricing.json",
+			content: `{"gemini-2.5-pro": {"output_price": 12.0}, "my-tuned-model": {"name": "My Tuned Model", "input_price": 0.5, "output_price": 2.0}}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			restorePricingTable(t)
+			path := filepath.Join(t.TempDir(), tt.file)
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			models, err := LoadPricingFile(path)
+			if err != nil {
+				t.Fatalf("LoadPricingFile() error: %v", err)
+			}
+			if strings.Join(models, ",") != "gemini-2.5-pro,my-tuned-model" {
+				t.Errorf("LoadPricingFile() models = %v", models)
+			}
+
+			// Overridden field changes, the rest of the built-in entry is kept
+			pro := PricingTable["gemini-2.5-pro"]
+			if pro.OutputPriceShort != 12.00 || pro.InputPriceShort != 1.25 || pro.LongContextThreshold != 200000 {
+				t.Errorf("merged gemini-2.5-pro pricing = %+v", pro)
+			}
+
+			tuned := PricingTable["my-tuned-model"]
+			if tuned.InputPriceLong != 0.50 || tuned.OutputPriceLong != 2.00 {
+				t.Errorf("new model should default long prices to short prices, got %+v", tuned)
+			}
+		})
+	}
+
+	if _, err := LoadPricingFile(filepath.Join(t.TempDir(), "missing.yml")); err == nil {
+		t.Error("LoadPricingFile() should fail for a missing file")
+	}
+}
+
+func TestSuggestModel(t *testing.T) {
+	tests := []struct {
+		model string
+		want  string
+		ok    bool
+	}{
+		{model: "gemini-2.5-pr", want: "gemini-2.5-pro", ok: true},
+		{model: "gemini-2.5-pro2", want: "gemini-2.5-pro", ok: true},
+		{model: "my-tuned-model", ok: false},
+	}
+	for _, tt := range tests {
+		got, ok := suggestModel(tt.model)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("suggestModel(%q) = %q, %v, want %q, %v", tt.model, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestUnknownModelCost(t *testing.T) {
+	stats := &CLIStats{Models: map[string]ModelStats{
+		"gemini-2.5-flash":  {Tokens: TokenStats{Prompt: 100, Total: 100}},
+		"totally-new-model": {Tokens: TokenStats{Prompt: 100, Total: 100}},
+	}}
+
+	b := calculateCostBreakdown("totally-new-model", stats.Models["totally-new-model"])
+	if b.Known || b.Total != 0 {
+		t.Errorf("unknown model breakdown = %+v, want unknown with zero cost", b)
+	}
+
+	if simple := FormatStatsSimple(stats); !strings.Contains(simple, "Cost: unknown") {
+		t.Errorf("FormatStatsSimple() = %q, want unknown cost", simple)
+	}
+	if formatted := FormatStats(stats); !strings.Contains(formatted, "unknown") {
+		t.Errorf("FormatStats() should report unknown cost:\n%s", formatted)
+	}
+}
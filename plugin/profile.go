@@ -0,0 +1,243 @@
+package plugin
+
+import (
+	"fmt"
+	"path"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// profileSettings are the settings a profile may override
+var profileSettings = []string{
+	"model", "prompt", "prompt_file", "task",
+	"fail_on",
+	"max_cost_usd", "max_tokens", "budget_action",
+	"yolo", "approval_mode",
+}
+
+// Profile is a named set of setting overrides, selected when its conditions match the build
+type Profile struct {
+	Name string
+	When ProfileConditions
+
+	// settings holds the overrides as key/value node pairs, in file order
+	settings []*yaml.Node
+}
+
+// ProfileConditions are glob patterns the build must match. Each condition matches
+// when any of its patterns does; all conditions that are set must match.
+type ProfileConditions struct {
+	Branch       []string
+	Event        []string
+	TargetBranch []string
+}
+
+// ProfileMatch records which profile was applied and why
+type ProfileMatch struct {
+	Name     string
+	Reasons  []string
+	Settings []string
+}
+
+// String describes the match for the log
+func (m *ProfileMatch) String() string {
+	return fmt.Sprintf("%q (%s): %s", m.Name, strings.Join(m.Reasons, ", "), strings.Join(m.Settings, ", "))
+}
+
+// ParseProfiles parses a YAML or JSON list of profiles, as set in the config file:
+//
+//	profiles:
+//	  - name: pr-main
+//	    when:
+//	      event: pull_request
+//	      target_branch: main
+//	    model: gemini-2.5-pro
+//	    fail_on: critical
+func ParseProfiles(data string) ([]Profile, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(data), &doc); err != nil {
+		return nil, fmt.Errorf("%w: profiles: %v", ErrInvalidConfig, err)
+	}
+	if len(doc.Content) == 0 {
+		return nil, nil
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.SequenceNode {
+		return nil, fmt.Errorf("%w: profiles must be a list", ErrInvalidConfig)
+	}
+
+	var v validator
+	var profiles []Profile
+	seen := map[string]bool{}
+	for i, node := range root.Content {
+		if node.Kind != yaml.MappingNode {
+			v.addf("profile %d must be a mapping", i+1)
+			continue
+		}
+		profile := parseProfile(&v, node)
+		switch {
+		case profile.Name == "":
+			v.addf("profile %d has no name", i+1)
+		case seen[profile.Name]:
+			v.addf("profile %q is defined twice", profile.Name)
+		}
+		seen[profile.Name] = true
+		profiles = append(profiles, profile)
+	}
+
+	if err := v.err(); err != nil {
+		return nil, err
+	}
+	return profiles, nil
+}
+
+// parseProfile reads the name, conditions and overrides of one profile
+func parseProfile(v *validator, node *yaml.Node) Profile {
+	var profile Profile
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		switch key.Value {
+		case "name":
+			profile.Name = value.Value
+		case "when":
+			profile.When = parseProfileConditions(v, value)
+		default:
+			if !containsString(profileSettings, key.Value) {
+				v.addf("profile setting %q is not supported%s (profiles can set: %s)",
+					key.Value, suggestion(key.Value, profileSettings), strings.Join(profileSettings, ", "))
+				continue
+			}
+			profile.settings = append(profile.settings, key, value)
+		}
+	}
+	return profile
+}
+
+// parseProfileConditions reads the when block; each condition is a pattern or a list of patterns
+func parseProfileConditions(v *validator, node *yaml.Node) ProfileConditions {
+	var when ProfileConditions
+	if node.Kind != yaml.MappingNode {
+		v.addf("profile when must be a mapping of branch, event and target_branch")
+		return when
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i].Value, node.Content[i+1]
+
+		var patterns []string
+		if value.Kind == yaml.ScalarNode {
+			patterns = []string{value.Value}
+		} else if err := value.Decode(&patterns); err != nil {
+			v.addf("profile when.%s must be a pattern or a list of patterns", key)
+			continue
+		}
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				v.addf("profile when.%s pattern %q is invalid: %v", key, pattern, err)
+			}
+		}
+
+		switch key {
+		case "branch":
+			when.Branch = patterns
+		case "event":
+			when.Event = patterns
+		case "target_branch":
+			when.TargetBranch = patterns
+		default:
+			v.addf("profile condition %q is not supported%s", key, suggestion(key, []string{"branch", "event", "target_branch"}))
+		}
+	}
+	return when
+}
+
+// Match reports whether the build matches every condition, with the reasons it does
+func (p *Profile) Match(ctx BuildContext) (bool, []string) {
+	var reasons []string
+	for _, condition := range []struct {
+		name     string
+		value    string
+		patterns []string
+	}{
+		{"branch", ctx.Branch, p.When.Branch},
+		{"event", ctx.Event, p.When.Event},
+		{"target_branch", ctx.TargetBranch, p.When.TargetBranch},
+	} {
+		if len(condition.patterns) == 0 {
+			continue
+		}
+		pattern, ok := matchPatterns(condition.patterns, condition.value)
+		if !ok {
+			return false, nil
+		}
+		reasons = append(reasons, fmt.Sprintf("%s %q matches %q", condition.name, condition.value, pattern))
+	}
+	if len(reasons) == 0 {
+		reasons = append(reasons, "no conditions")
+	}
+	return true, reasons
+}
+
+// matchPatterns returns the first pattern matching a non-empty value
+func matchPatterns(patterns []string, value string) (string, bool) {
+	if value == "" {
+		return "", false
+	}
+	for _, pattern := range patterns {
+		if matched, _ := path.Match(pattern, value); matched {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+// SelectProfile returns the first profile matching the build, in definition order
+func SelectProfile(profiles []Profile, ctx BuildContext) (*Profile, []string) {
+	for i := range profiles {
+		if ok, reasons := profiles[i].Match(ctx); ok {
+			return &profiles[i], reasons
+		}
+	}
+	return nil, nil
+}
+
+// ApplyProfiles selects the profile for the build from cfg.Profiles and applies its
+// overrides to cfg. A profile is chosen for this build specifically, so its overrides
+// win over every other source. It returns nil when no profile matches.
+func ApplyProfiles(cfg *Config, sources ConfigSources, ctx BuildContext) (*ProfileMatch, error) {
+	if cfg.Profiles == "" {
+		return nil, nil
+	}
+	profiles, err := ParseProfiles(cfg.Profiles)
+	if err != nil {
+		return nil, err
+	}
+	profile, reasons := SelectProfile(profiles, ctx)
+	if profile == nil {
+		return nil, nil
+	}
+
+	fields := map[string]configField{}
+	for _, f := range configFields() {
+		fields[f.name] = f
+	}
+
+	var v validator
+	match := &ProfileMatch{Name: profile.Name, Reasons: reasons}
+	for i := 0; i+1 < len(profile.settings); i += 2 {
+		key := profile.settings[i].Value
+		field := reflect.ValueOf(cfg).Elem().Field(fields[key].index)
+		value, err := decodeConfigValue(field.Type(), profile.settings[i+1])
+		if err != nil {
+			v.addf("profile %q: %s: %v", profile.Name, key, err)
+			continue
+		}
+		field.Set(value)
+		match.Settings = append(match.Settings, key)
+		if sources != nil {
+			sources[key] = "profile " + profile.Name
+		}
+	}
+	return match, v.err()
+}
@@ -0,0 +1,166 @@
+package plugin
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const testProfiles = `
+- name: push-flash
+  when:
+    event: push
+  model: gemini-2.5-flash
+  max_cost_usd: 0.05
+- name: pr-main
+  when:
+    event: pull_request
+    target_branch: [main, "release/*"]
+  model: gemini-2.5-pro
+  task: review
+  fail_on: critical
+- name: fix-yolo
+  when:
+    branch: "fix/*"
+  yolo: true
+`
+
+func TestApplyProfiles(t *testing.T) {
+	tests := []struct {
+		name        string
+		build       BuildContext
+		wantProfile string
+		wantModel   string
+		wantYolo    bool
+		wantFailOn  string
+		wantReason  string
+	}{
+		{name: "push", build: BuildContext{Branch: "dev", Event: "push", TargetBranch: "dev"}, wantProfile: "push-flash", wantModel: "gemini-2.5-flash", wantReason: `event "push" matches "push"`},
+		{name: "pr to main", build: BuildContext{Branch: "feature", Event: "pull_request", TargetBranch: "main"}, wantProfile: "pr-main", wantModel: "gemini-2.5-pro", wantFailOn: "critical", wantReason: `target_branch "main" matches "main"`},
+		{name: "pr to release glob", build: BuildContext{Branch: "feature", Event: "pull_request", TargetBranch: "release/1.2"}, wantProfile: "pr-main", wantModel: "gemini-2.5-pro", wantFailOn: "critical", wantReason: `matches "release/*"`},
+		{name: "first match wins", build: BuildContext{Branch: "fix/login", Event: "push"}, wantProfile: "push-flash", wantModel: "gemini-2.5-flash"},
+		{name: "fix branch pr", build: BuildContext{Branch: "fix/login", Event: "pull_request", TargetBranch: "dev"}, wantProfile: "fix-yolo", wantModel: "gemini-2.0-flash", wantYolo: true, wantReason: `branch "fix/login" matches "fix/*"`},
+		{name: "no match", build: BuildContext{Branch: "dev", Event: "tag"}, wantModel: "gemini-2.0-flash"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{Model: "gemini-2.0-flash", Profiles: testProfiles}
+			sources := ConfigSources{"model": SourceSettings}
+			match, err := ApplyProfiles(&cfg, sources, tt.build)
+			if err != nil {
+				t.Fatalf("ApplyProfiles() error: %v", err)
+			}
+
+			if tt.wantProfile == "" {
+				if match != nil {
+					t.Fatalf("ApplyProfiles() = %v, want no match", match)
+				}
+			} else if match == nil || match.Name != tt.wantProfile {
+				t.Fatalf("ApplyProfiles() = %v, want %s", match, tt.wantProfile)
+			}
+			if tt.wantReason != "" && !strings.Contains(match.String(), tt.wantReason) {
+				t.Errorf("match = %s, want reason %s", match, tt.wantReason)
+			}
+			if cfg.Model != tt.wantModel || cfg.Yolo != tt.wantYolo || cfg.FailOn != tt.wantFailOn {
+				t.Errorf("model=%q yolo=%v fail_on=%q, want %q %v %q", cfg.Model, cfg.Yolo, cfg.FailOn, tt.wantModel, tt.wantYolo, tt.wantFailOn)
+			}
+			if match != nil && match.Name != "fix-yolo" && sources["model"] != "profile "+match.Name {
+				t.Errorf("model source = %q, want the profile", sources["model"])
+			}
+		})
+	}
+}
+
+func TestParseProfilesErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		data    string
+		wantErr string
+	}{
+		{name: "not a list", data: "name: x", wantErr: "must be a list"},
+		{name: "no name", data: "- model: gemini-2.5-pro", wantErr: "has no name"},
+		{name: "duplicate", data: "- name: a\n- name: a", wantErr: "defined twice"},
+		{name: "setting not allowed", data: "- name: a\n  output_file: x.md", wantErr: `"output_file" is not supported`},
+		{name: "misspelled setting", data: "- name: a\n  modle: x", wantErr: `did you mean "model"?`},
+		{name: "unknown condition", data: "- name: a\n  when:\n    brnch: main", wantErr: `did you mean "branch"?`},
+		{name: "bad pattern", data: "- name: a\n  when:\n    branch: \"[\"", wantErr: "is invalid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParseProfiles(tt.data)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("ParseProfiles() error = %v, want containing %q", err, tt.wantErr)
+			}
+			if !errors.Is(err, ErrInvalidConfig) {
+				t.Errorf("error %v does not wrap ErrInvalidConfig", err)
+			}
+		})
+	}
+}
+
+func TestProfilesFromConfigFile(t *testing.T) {
+	cfg := Config{Model: "gemini-2.5-pro"}
+	sources := ConfigSources{}
+	// Profiles that enable yolo are settings-only, see TestApplyConfigFileProfiles
+	fileProfiles, _, _ := strings.Cut(testProfiles, "- name: fix-yolo")
+	data := "profiles:\n" + strings.ReplaceAll(fileProfiles, "\n", "\n  ")
+	if err := ApplyConfigFile(&cfg, []byte(data), sources, "main", "push"); err != nil {
+		t.Fatalf("ApplyConfigFile() error: %v", err)
+	}
+	match, err := ApplyProfiles(&cfg, sources, BuildContext{Branch: "main", Event: "push"})
+	if err != nil || match == nil || match.Name != "push-flash" {
+		t.Fatalf("ApplyProfiles() = %v, %v, want push-flash", match, err)
+	}
+	if cfg.MaxCostUSD != 0.05 {
+		t.Errorf("max_cost_usd = %v, want 0.05", cfg.MaxCostUSD)
+	}
+}
+
+func TestCheckFindings(t *testing.T) {
+	response := "CRITICAL: SQL injection in query.go\nINFO: consider renaming\n"
+	tests := []struct {
+		failOn  string
+		wantErr string
+	}{
+		{failOn: "", wantErr: ""},
+		{failOn: "critical", wantErr: "1 CRITICAL (fail_on: critical)"},
+		{failOn: "warning", wantErr: "1 CRITICAL (fail_on: warning)"},
+		{failOn: "info", wantErr: "1 CRITICAL, 1 INFO (fail_on: info)"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.failOn, func(t *testing.T) {
+			p := New(Config{FailOn: tt.failOn})
+			err := p.checkFindings(&ExecutionResult{Response: &CLIResponse{Response: response}})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("checkFindings() error: %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, ErrFindingsGate) || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("checkFindings() error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+
+	p := New(Config{FailOn: "critical"})
+	if err := p.checkFindings(&ExecutionResult{Response: &CLIResponse{Response: "WARNING: slow loop"}}); err != nil {
+		t.Errorf("checkFindings() below threshold error: %v", err)
+	}
+
+	// Prose that mentions a severity level is not a finding
+	p = New(Config{FailOn: "info"})
+	for _, clean := range []string{
+		"No CRITICAL issues were found.",
+		"There are no warnings or WARNING-level problems in this commit.",
+		"The logger writes at INFO level: nothing to report.",
+		"Summary: no CRITICAL, WARNING or INFO findings.",
+	} {
+		if err := p.checkFindings(&ExecutionResult{Response: &CLIResponse{Response: clean}}); err != nil {
+			t.Errorf("checkFindings(%q) error: %v", clean, err)
+		}
+	}
+}
@@ -0,0 +1,224 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// buildPlaceholder in push_branch is replaced by the Drone build number
+const buildPlaceholder = "{build}"
+
+// maxCommitSubject is the conventional limit for a commit subject line
+const maxCommitSubject = 72
+
+// Netrc holds the git credentials Drone provides to the pipeline
+type Netrc struct {
+	Machine  string
+	Login    string
+	Password string
+}
+
+// NetrcFromEnv reads the DRONE_NETRC_* variables, or returns nil when they are not set
+func NetrcFromEnv() *Netrc {
+	netrc := &Netrc{
+		Machine:  os.Getenv("DRONE_NETRC_MACHINE"),
+		Login:    os.Getenv("DRONE_NETRC_USERNAME"),
+		Password: os.Getenv("DRONE_NETRC_PASSWORD"),
+	}
+	if netrc.Machine == "" || netrc.Login == "" {
+		return nil
+	}
+	return netrc
+}
+
+// PushResult describes the commit pushed by a run
+type PushResult struct {
+	Remote  string
+	Branch  string
+	SHA     string
+	Subject string
+	Files   []string
+}
+
+// PushBranchName expands the build placeholder in a push_branch pattern
+func PushBranchName(pattern, build string) string {
+	if build == "" {
+		build = "local"
+	}
+	return strings.ReplaceAll(pattern, buildPlaceholder, build)
+}
+
+// CommitChanges commits files as they are in the working tree on top of the base
+// commit, without touching the repository's index, HEAD or branches, and returns
+// the commit SHA. Files are relative to the repository root; deleted files are removed.
+func (g *GitAnalyzer) CommitChanges(base string, files []string, message, authorName, authorEmail string) (string, error) {
+	if base == "" {
+		return "", fmt.Errorf("failed to commit changes: the repository has no commit to build on")
+	}
+
+	dir, err := os.MkdirTemp("", "gemini-commit-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(dir)
+
+	env := []string{
+		"GIT_INDEX_FILE=" + filepath.Join(dir, "index"),
+		"GIT_LITERAL_PATHSPECS=1",
+		"GIT_AUTHOR_NAME=" + authorName,
+		"GIT_AUTHOR_EMAIL=" + authorEmail,
+		"GIT_COMMITTER_NAME=" + authorName,
+		"GIT_COMMITTER_EMAIL=" + authorEmail,
+	}
+
+	if _, err := g.runGitCommandEnv(env, "read-tree", base); err != nil {
+		return "", fmt.Errorf("failed to commit changes: %w", err)
+	}
+	if _, err := g.runGitCommandEnv(env, append([]string{"add", "-A", "--"}, files...)...); err != nil {
+		return "", fmt.Errorf("failed to commit changes: %w", err)
+	}
+	tree, err := g.runGitCommandEnv(env, "write-tree")
+	if err != nil {
+		return "", fmt.Errorf("failed to commit changes: %w", err)
+	}
+	sha, err := g.runGitCommandEnv(env, "commit-tree", strings.TrimSpace(tree), "-p", base, "-m", message)
+	if err != nil {
+		return "", fmt.Errorf("failed to commit changes: %w", err)
+	}
+	return strings.TrimSpace(sha), nil
+}
+
+// PushCommit pushes a commit to a new branch on the remote; force replaces an
+// existing branch. With netrc, the credentials are written to a temporary HOME
+// that is removed after the push.
+func (g *GitAnalyzer) PushCommit(remote, sha, branch string, netrc *Netrc, force bool) error {
+	home, err := os.MkdirTemp("", "gemini-home-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(home)
+
+	if netrc != nil {
+		content := fmt.Sprintf("machine %s\nlogin %s\npassword %s\n", netrc.Machine, netrc.Login, netrc.Password)
+		if err := os.WriteFile(filepath.Join(home, ".netrc"), []byte(content), 0o600); err != nil {
+			return err
+		}
+	}
+
+	env := []string{
+		"HOME=" + home,
+		"GIT_TERMINAL_PROMPT=0",
+	}
+	args := []string{"push", "--no-verify"}
+	// Without --force an existing branch is never overwritten
+	if force {
+		args = append(args, "--force")
+	}
+	args = append(args, remote, sha+":refs/heads/"+branch)
+	if _, err := g.runGitCommandEnv(env, args...); err != nil {
+		return fmt.Errorf("failed to push %s to %s: %w", branch, remote, err)
+	}
+	return nil
+}
+
+// CommitMessage generates a conventional-commit message for the changes of a run
+//
+//	fix(db): fix the SQL injection vulnerabilities
+//
+//	Changes made by gemini-cli (gemini-2.5-pro) in Drone build #42.
+//
+//	- M src/db/query.go (+10 -3)
+func CommitMessage(cfg *Config, summary *PatchSummary, build string) string {
+	commitType := "fix"
+	switch {
+	case cfg.Task == TaskTestGen:
+		commitType = "test"
+	case allFiles(summary.Files, func(name string) bool { return path.Ext(name) == ".md" }):
+		commitType = "docs"
+	}
+
+	header := commitType
+	if scope := commitScope(summary.Files); scope != "" {
+		header += "(" + scope + ")"
+	}
+	header += ": "
+	header += truncateSubject(commitSubject(cfg), maxCommitSubject-len(header))
+
+	var sb strings.Builder
+	sb.WriteString(header + "\n\n")
+	if build != "" {
+		sb.WriteString(fmt.Sprintf("Changes made by gemini-cli (%s) in Drone build #%s.\n\n", cfg.Model, build))
+	} else {
+		sb.WriteString(fmt.Sprintf("Changes made by gemini-cli (%s).\n\n", cfg.Model))
+	}
+	for _, file := range summary.Files {
+		sb.WriteString("- " + file.String() + "\n")
+	}
+	if link := os.Getenv("DRONE_BUILD_LINK"); link != "" {
+		sb.WriteString("\nDrone-Build: " + link + "\n")
+	}
+	return sb.String()
+}
+
+// commitSubject derives the subject from the first sentence of the prompt, or the task
+func commitSubject(cfg *Config) string {
+	prompt := strings.TrimSpace(cfg.Prompt)
+	if cfg.PromptFile != "" || prompt == "" {
+		if cfg.Task != "" {
+			return "apply gemini " + cfg.Task + " changes"
+		}
+		return "apply gemini changes"
+	}
+
+	subject := strings.TrimSpace(strings.SplitN(prompt, "\n", 2)[0])
+	if i := strings.Index(subject, ". "); i > 0 {
+		subject = subject[:i]
+	}
+	subject = strings.TrimRight(subject, ".:;! ")
+	// Conventional commits start the description in lower case
+	if subject != "" {
+		subject = strings.ToLower(subject[:1]) + subject[1:]
+	}
+	return subject
+}
+
+// commitScope returns the top-level directory shared by all files, or ""
+func commitScope(files []PatchFileStat) string {
+	scope := ""
+	for i, file := range files {
+		dir, _, found := strings.Cut(file.Path, "/")
+		if !found {
+			return ""
+		}
+		if i > 0 && dir != scope {
+			return ""
+		}
+		scope = dir
+	}
+	return scope
+}
+
+// truncateSubject shortens a subject to at most maxLen bytes at a word boundary
+func truncateSubject(subject string, maxLen int) string {
+	if len(subject) <= maxLen {
+		return subject
+	}
+	cut := strings.LastIndex(subject[:maxLen], " ")
+	if cut <= 0 {
+		cut = maxLen
+	}
+	return strings.TrimRight(subject[:cut], ",;: ")
+}
+
+// allFiles reports whether every file satisfies match
+func allFiles(files []PatchFileStat, match func(string) bool) bool {
+	for _, file := range files {
+		if !match(file.Path) {
+			return false
+		}
+	}
+	return len(files) > 0
+}
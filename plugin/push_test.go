@@ -0,0 +1,209 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCommitMessage(t *testing.T) {
+	files := func(paths ...string) *PatchSummary {
+		summary := &PatchSummary{}
+		for _, p := range paths {
+			summary.Files = append(summary.Files, PatchFileStat{Path: p, Status: "M", Added: 1})
+		}
+		return summary
+	}
+
+	tests := []struct {
+		name    string
+		cfg     Config
+		summary *PatchSummary
+		want    string
+	}{
+		{
+			name:    "prompt with scope",
+			cfg:     Config{Prompt: "Fix the SQL injection vulnerabilities. Use parameterized queries.\nShow the diff."},
+			summary: files("src/db/query.go", "src/api/handler.go"),
+			want:    "fix(src): fix the SQL injection vulnerabilities",
+		},
+		{
+			name:    "no common scope",
+			cfg:     Config{Prompt: "Update the README:"},
+			summary: files("README.md", "docs/guide.md"),
+			want:    "docs: update the README",
+		},
+		{
+			name:    "test-gen task",
+			cfg:     Config{Task: TaskTestGen, PromptFile: "prompt.md"},
+			summary: files("pkg/util_test.go"),
+			want:    "test(pkg): apply gemini test-gen changes",
+		},
+		{
+			name:    "long subject",
+			cfg:     Config{Prompt: "Refactor the configuration loader so that every setting is validated before any file is read from disk"},
+			summary: files("main.go"),
+			want:    "fix: refactor the configuration loader so that every setting is",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Model = "gemini-2.5-pro"
+			message := CommitMessage(&tt.cfg, tt.summary, "42")
+			subject, body, _ := strings.Cut(message, "\n\n")
+			if subject != tt.want {
+				t.Errorf("subject = %q, want %q", subject, tt.want)
+			}
+			if len(subject) > maxCommitSubject {
+				t.Errorf("subject is %d characters long", len(subject))
+			}
+			if !strings.Contains(body, "gemini-cli (gemini-2.5-pro) in Drone build #42") || !strings.Contains(body, "- M "+tt.summary.Files[0].Path) {
+				t.Errorf("body = %q", body)
+			}
+		})
+	}
+}
+
+func TestPushChanges(t *testing.T) {
+	dir := newTestRepo(t)
+	commitFile(t, dir, "src/main.go", "package main\n", "main")
+	remote := t.TempDir()
+	runGit(t, remote, "init", "-q", "--bare")
+	runGit(t, dir, "remote", "add", "origin", remote)
+	t.Setenv("DRONE_BUILD_NUMBER", "42")
+
+	p := New(Config{
+		Target:            dir,
+		Model:             "gemini-2.5-pro",
+		Prompt:            "Add a helper",
+		Yolo:              true,
+		PushChanges:       true,
+		PushBranch:        "gemini/fix-{build}",
+		PushRemote:        "origin",
+		ProtectedBranches: "main",
+		CommitAuthorName:  "Gemini Bot",
+		CommitAuthorEmail: "bot@example.com",
+	})
+	snapshot, err := p.snapshotWorktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, dir, "src/util.go", "package main\n\nfunc helper() {}\n")
+	p.capturePatch(snapshot)
+
+	if err := p.pushChanges(context.Background()); err != nil {
+		t.Fatalf("pushChanges() error: %v", err)
+	}
+	if p.pushed == nil || p.pushed.Branch != "gemini/fix-42" {
+		t.Fatalf("pushed = %+v", p.pushed)
+	}
+
+	log := runGit(t, remote, "log", "-1", "--format=%an <%ae>|%s|%P", "gemini/fix-42")
+	head := runGit(t, dir, "rev-parse", "HEAD")
+	if log != "Gemini Bot <bot@example.com>|fix(src): add a helper|"+head {
+		t.Errorf("pushed commit = %q", log)
+	}
+	if files := runGit(t, remote, "show", "--format=", "--name-status", "gemini/fix-42"); files != "A\tsrc/util.go" {
+		t.Errorf("pushed files = %q", files)
+	}
+
+	// The workspace keeps its HEAD and index
+	if got := runGit(t, dir, "rev-parse", "HEAD"); got != head {
+		t.Errorf("HEAD moved to %s", got)
+	}
+	if status := runGit(t, dir, "status", "--porcelain"); status != "?? src/util.go" {
+		t.Errorf("git status = %q", status)
+	}
+
+	// An existing branch is never overwritten
+	writeTestFile(t, dir, "src/util.go", "package main\n\nfunc helper() int { return 1 }\n")
+	p.capturePatch(snapshot)
+	if err := p.pushChanges(context.Background()); err == nil {
+		t.Error("pushChanges() to an existing branch should fail")
+	}
+	p.config.PushForce = true
+	if err := p.pushChanges(context.Background()); err != nil {
+		t.Errorf("pushChanges() with push_force error: %v", err)
+	}
+	if got := runGit(t, remote, "rev-parse", "gemini/fix-42"); got != p.pushed.SHA {
+		t.Errorf("forced push left gemini/fix-42 at %s, want %s", got, p.pushed.SHA)
+	}
+
+	p.config.PushBranch = "main"
+	if err := p.pushChanges(context.Background()); !errors.Is(err, ErrProtectedBranch) {
+		t.Errorf("pushChanges() to a protected branch error = %v", err)
+	}
+}
+
+func TestPushChangesIgnoresAgentCommits(t *testing.T) {
+	dir := newTestRepo(t)
+	commitFile(t, dir, ".drone.yml", "kind: pipeline\n", "ci")
+	head := commitFile(t, dir, "src/main.go", "package main\n", "main")
+	remote := t.TempDir()
+	runGit(t, remote, "init", "-q", "--bare")
+	runGit(t, dir, "remote", "add", "origin", remote)
+	t.Setenv("DRONE_BUILD_NUMBER", "7")
+
+	p := New(Config{
+		Target:            dir,
+		Model:             "gemini-2.5-pro",
+		Prompt:            "Add a helper",
+		Yolo:              true,
+		ProtectedPaths:    ".drone.yml",
+		PushChanges:       true,
+		PushBranch:        "gemini/fix-{build}",
+		PushRemote:        "origin",
+		CommitAuthorName:  "Gemini Bot",
+		CommitAuthorEmail: "bot@example.com",
+	})
+	snapshot, err := p.snapshotWorktree()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The agent commits a protected file and restores the working tree, so the
+	// path guard sees no change to it
+	commitFile(t, dir, ".drone.yml", "kind: pipeline\nsteps: []\n", "agent")
+	runGit(t, dir, "checkout", "-q", head, "--", ".drone.yml")
+	writeTestFile(t, dir, "src/util.go", "package main\n\nfunc helper() {}\n")
+	if err := p.enforcePaths(context.Background(), snapshot); err != nil {
+		t.Fatalf("enforcePaths() error: %v", err)
+	}
+	p.capturePatch(snapshot)
+
+	if err := p.pushChanges(context.Background()); err != nil {
+		t.Fatalf("pushChanges() error: %v", err)
+	}
+	if parent := runGit(t, remote, "log", "-1", "--format=%P", "gemini/fix-7"); parent != head {
+		t.Errorf("pushed commit parent = %s, want the HEAD before the run %s", parent, head)
+	}
+	if content := runGit(t, remote, "show", "gemini/fix-7:.drone.yml"); content != "kind: pipeline" {
+		t.Errorf("pushed .drone.yml = %q", content)
+	}
+	if files := runGit(t, remote, "show", "--format=", "--name-status", "gemini/fix-7"); files != "A\tsrc/util.go" {
+		t.Errorf("pushed files = %q", files)
+	}
+}
+
+func TestPushChangesWithoutChanges(t *testing.T) {
+	p := New(Config{PushChanges: true})
+	if err := p.pushChanges(context.Background()); err != nil {
+		t.Errorf("pushChanges() without changes error: %v", err)
+	}
+}
+
+func TestNetrcFromEnv(t *testing.T) {
+	t.Setenv("DRONE_NETRC_MACHINE", "")
+	if NetrcFromEnv() != nil {
+		t.Error("NetrcFromEnv() without variables should be nil")
+	}
+
+	t.Setenv("DRONE_NETRC_MACHINE", "github.com")
+	t.Setenv("DRONE_NETRC_USERNAME", "bot")
+	t.Setenv("DRONE_NETRC_PASSWORD", "token")
+	if got := NetrcFromEnv(); got == nil || *got != (Netrc{Machine: "github.com", Login: "bot", Password: "token"}) {
+		t.Errorf("NetrcFromEnv() = %+v", got)
+	}
+}
@@ -0,0 +1,80 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// recordingVersion identifies the recording file format
+const recordingVersion = 1
+
+// Recording is a captured gemini CLI invocation that can be replayed offline
+type Recording struct {
+	Version      int       `json:"version"`
+	RecordedAt   time.Time `json:"recorded_at"`
+	Args         []string  `json:"args"`
+	EnvKeys      []string  `json:"env_keys"` // names only, values are never recorded
+	OutputFormat string    `json:"output_format"`
+	Stdin        string    `json:"stdin"`
+	Stdout       string    `json:"stdout"`
+	Stderr       string    `json:"stderr"`
+	ExitCode     int       `json:"exit_code"`
+	TimedOut     bool      `json:"timed_out,omitempty"`
+	Cancelled    bool      `json:"cancelled,omitempty"`
+	DurationMs   int64     `json:"duration_ms"`
+}
+
+// SaveRecording writes a recording as indented JSON
+func SaveRecording(path string, rec *Recording) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(rec, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(path, append(data, '\n'), 0o644)
+}
+
+// LoadRecording reads a recording written by SaveRecording
+func LoadRecording(path string) (*Recording, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, fmt.Errorf("%w: %s", ErrFileNotFound, path)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrFileRead, err)
+	}
+
+	var rec Recording
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, fmt.Errorf("%w: invalid recording %s: %v", ErrFileRead, path, err)
+	}
+	if rec.Version != recordingVersion {
+		return nil, fmt.Errorf("%w: unsupported recording version %d in %s", ErrFileRead, rec.Version, path)
+	}
+
+	return &rec, nil
+}
+
+// envKeys returns the sorted variable names of an environment list
+func envKeys(env []string) []string {
+	seen := make(map[string]bool)
+	var keys []string
+	for _, kv := range env {
+		key, _, _ := strings.Cut(kv, "=")
+		if key != "" && !seen[key] {
+			seen[key] = true
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
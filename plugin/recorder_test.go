@@ -0,0 +1,113 @@
+package plugin
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files in testdata")
+
+// TestReplayGolden replays every recording in testdata/replay through the
+// executor's parsing path and compares the outcome with its .golden file.
+// Run `go test ./plugin -run TestReplayGolden -update` to regenerate.
+func TestReplayGolden(t *testing.T) {
+	recordings, err := filepath.Glob(filepath.Join("testdata", "replay", "*.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(recordings) == 0 {
+		t.Fatal("no recordings found in testdata/replay")
+	}
+
+	for _, path := range recordings {
+		name := strings.TrimSuffix(filepath.Base(path), ".json")
+		t.Run(name, func(t *testing.T) {
+			rec, err := LoadRecording(path)
+			if err != nil {
+				t.Fatalf("LoadRecording() error: %v", err)
+			}
+
+			executor := NewCLIExecutor(&Config{})
+			result, err := executor.Replay(rec)
+			got := summarizeReplay(result, err)
+
+			goldenPath := strings.TrimSuffix(path, ".json") + ".golden"
+			if *updateGolden {
+				if err := os.WriteFile(goldenPath, []byte(got), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			want, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("missing golden file (run with -update): %v", err)
+			}
+			if got != string(want) {
+				t.Errorf("replay output mismatch for %s\n--- got ---\n%s\n--- want ---\n%s", name, got, want)
+			}
+		})
+	}
+}
+
+// summarizeReplay renders a replayed result in a stable, diffable form
+func summarizeReplay(result *ExecutionResult, err error) string {
+	var sb strings.Builder
+	if err != nil {
+		sb.WriteString(fmt.Sprintf("error: %v\n", err))
+	} else {
+		sb.WriteString("error: <nil>\n")
+	}
+	if result == nil {
+		sb.WriteString("result: <nil>\n")
+		return sb.String()
+	}
+	sb.WriteString(fmt.Sprintf("exit_code: %d\n", result.ExitCode))
+	if result.Response == nil {
+		sb.WriteString("response: <nil>\n")
+		return sb.String()
+	}
+	sb.WriteString(fmt.Sprintf("stats: %s\n", FormatStatsSimple(result.Response.Stats)))
+	sb.WriteString("response:\n")
+	sb.WriteString(result.Response.Response)
+	sb.WriteString("\n")
+	return sb.String()
+}
+
+func TestRecordingRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "run.json")
+	rec := &Recording{
+		Version:  recordingVersion,
+		Args:     []string{"--prompt", "hi"},
+		EnvKeys:  envKeys([]string{"PATH=/bin", "GEMINI_API_KEY=secret", "PATH=/usr/bin"}),
+		Stdout:   `{"response":"hello"}`,
+		ExitCode: 0,
+	}
+
+	if err := SaveRecording(path, rec); err != nil {
+		t.Fatalf("SaveRecording() error: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(data), "secret") {
+		t.Error("recording must not contain environment values")
+	}
+
+	loaded, err := LoadRecording(path)
+	if err != nil {
+		t.Fatalf("LoadRecording() error: %v", err)
+	}
+	if strings.Join(loaded.EnvKeys, ",") != "GEMINI_API_KEY,PATH" {
+		t.Errorf("EnvKeys = %v, want [GEMINI_API_KEY PATH]", loaded.EnvKeys)
+	}
+
+	if _, err := LoadRecording(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("LoadRecording() should fail for a missing file")
+	}
+}
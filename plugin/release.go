@@ -0,0 +1,370 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SemVer is a parsed semantic version tag
+type SemVer struct {
+	Tag        string
+	Major      int
+	Minor      int
+	Patch      int
+	Prerelease string
+}
+
+// ReleaseCommit is a commit classified for release notes
+type ReleaseCommit struct {
+	CommitInfo
+	Type     string // conventional-commit type, empty if not conventional
+	Scope    string
+	Subject  string
+	Breaking bool
+	PR       int // pull/merge request number, 0 if unknown
+}
+
+// ReleaseInfo holds everything between two release tags
+type ReleaseInfo struct {
+	PreviousTag string
+	CurrentTag  string
+	SHA         string
+	Commits     []ReleaseCommit
+}
+
+var (
+	semverPattern       = regexp.MustCompile(`^v?(\d+)\.(\d+)\.(\d+)(?:-([0-9A-Za-z.-]+))?(?:\+[0-9A-Za-z.-]+)?$`)
+	conventionalPattern = regexp.MustCompile(`^(\w+)(?:\(([^)]*)\))?(!)?:\s*(.+)$`)
+	githubMergePattern  = regexp.MustCompile(`^Merge pull request #(\d+)`)
+	squashPRPattern     = regexp.MustCompile(`\(#(\d+)\)\s*$`)
+	gitlabMergePattern  = regexp.MustCompile(`See merge request \S*!(\d+)`)
+)
+
+// releaseSections maps conventional-commit types to changelog sections, in display order
+var releaseSections = []struct {
+	Type  string
+	Title string
+}{
+	{"feat", "Features"},
+	{"fix", "Bug Fixes"},
+	{"perf", "Performance"},
+	{"refactor", "Refactoring"},
+	{"docs", "Documentation"},
+	{"test", "Tests"},
+	{"build", "Build"},
+	{"ci", "CI"},
+	{"", "Other Changes"},
+}
+
+// ParseSemVer parses a tag such as v1.2.3 or 1.2.3-rc.1
+func ParseSemVer(tag string) (SemVer, bool) {
+	m := semverPattern.FindStringSubmatch(strings.TrimSpace(tag))
+	if m == nil {
+		return SemVer{}, false
+	}
+	major, _ := strconv.Atoi(m[1])
+	minor, _ := strconv.Atoi(m[2])
+	patch, _ := strconv.Atoi(m[3])
+	return SemVer{Tag: tag, Major: major, Minor: minor, Patch: patch, Prerelease: m[4]}, true
+}
+
+// Compare returns -1, 0 or 1 following semver precedence rules
+func (v SemVer) Compare(o SemVer) int {
+	for _, d := range []int{v.Major - o.Major, v.Minor - o.Minor, v.Patch - o.Patch} {
+		if d != 0 {
+			return sign(d)
+		}
+	}
+
+	// A release has higher precedence than its prereleases
+	switch {
+	case v.Prerelease == o.Prerelease:
+		return 0
+	case v.Prerelease == "":
+		return 1
+	case o.Prerelease == "":
+		return -1
+	}
+
+	a := strings.Split(v.Prerelease, ".")
+	b := strings.Split(o.Prerelease, ".")
+	for i := 0; i < len(a) && i < len(b); i++ {
+		an, aErr := strconv.Atoi(a[i])
+		bn, bErr := strconv.Atoi(b[i])
+		switch {
+		case aErr == nil && bErr == nil:
+			if an != bn {
+				return sign(an - bn)
+			}
+		case aErr == nil:
+			return -1 // numeric identifiers sort before alphanumeric
+		case bErr == nil:
+			return 1
+		default:
+			if c := strings.Compare(a[i], b[i]); c != 0 {
+				return c
+			}
+		}
+	}
+	return sign(len(a) - len(b))
+}
+
+func sign(n int) int {
+	switch {
+	case n < 0:
+		return -1
+	case n > 0:
+		return 1
+	}
+	return 0
+}
+
+// ParseReleaseCommit classifies a commit by its conventional-commit type and PR number.
+// Merge commits take the type from the merged PR title in the message body.
+func ParseReleaseCommit(c CommitInfo) ReleaseCommit {
+	rc := ReleaseCommit{CommitInfo: c, Subject: c.Message}
+
+	title := c.Message
+	if m := githubMergePattern.FindStringSubmatch(c.Message); m != nil {
+		rc.PR, _ = strconv.Atoi(m[1])
+		if c.Body != "" {
+			title = strings.SplitN(c.Body, "\n", 2)[0]
+			rc.Subject = title
+		}
+	} else if m := gitlabMergePattern.FindStringSubmatch(c.Body); m != nil {
+		rc.PR, _ = strconv.Atoi(m[1])
+		if first := strings.SplitN(c.Body, "\n", 2)[0]; c.IsMerge && first != "" && !gitlabMergePattern.MatchString(first) {
+			title = first
+			rc.Subject = title
+		}
+	} else if m := squashPRPattern.FindStringSubmatch(c.Message); m != nil {
+		rc.PR, _ = strconv.Atoi(m[1])
+	}
+
+	if m := conventionalPattern.FindStringSubmatch(title); m != nil {
+		rc.Type = strings.ToLower(m[1])
+		rc.Scope = m[2]
+		rc.Breaking = m[3] == "!"
+		rc.Subject = m[4]
+	}
+	if strings.Contains(c.Body, "BREAKING CHANGE:") || strings.Contains(c.Body, "BREAKING-CHANGE:") {
+		rc.Breaking = true
+	}
+
+	return rc
+}
+
+// GetCurrentTag returns the release tag for sha: DRONE_TAG when set, otherwise
+// the highest semver tag pointing at the commit. Empty if the commit is untagged.
+func (g *GitAnalyzer) GetCurrentTag(sha string) string {
+	if tag := os.Getenv("DRONE_TAG"); tag != "" {
+		return tag
+	}
+
+	output, err := g.runGitCommand("tag", "--points-at", sha)
+	if err != nil {
+		return ""
+	}
+
+	var best *SemVer
+	for _, tag := range strings.Fields(output) {
+		if v, ok := ParseSemVer(tag); ok && (best == nil || v.Compare(*best) > 0) {
+			best = &v
+		}
+	}
+	if best == nil {
+		return ""
+	}
+	return best.Tag
+}
+
+// GetPreviousTag returns the highest semver tag reachable from sha that sorts
+// below currentTag. Prereleases are skipped when currentTag is a final release,
+// so v1.2.0 is compared against v1.1.0 rather than v1.2.0-rc.1. Falls back to
+// git describe when the repository has no semver tags.
+func (g *GitAnalyzer) GetPreviousTag(sha, currentTag string) (string, error) {
+	if sha == "" {
+		sha = "HEAD"
+	}
+
+	output, err := g.runGitCommand("tag", "--merged", sha)
+	if err != nil {
+		return "", fmt.Errorf("failed to list tags: %w", err)
+	}
+
+	current, hasCurrent := ParseSemVer(currentTag)
+	var candidates []SemVer
+	for _, tag := range strings.Fields(output) {
+		v, ok := ParseSemVer(tag)
+		if !ok || tag == currentTag {
+			continue
+		}
+		if hasCurrent {
+			if v.Compare(current) >= 0 || (current.Prerelease == "" && v.Prerelease != "") {
+				continue
+			}
+		}
+		candidates = append(candidates, v)
+	}
+
+	if len(candidates) > 0 {
+		sort.Slice(candidates, func(i, j int) bool { return candidates[i].Compare(candidates[j]) > 0 })
+		return candidates[0].Tag, nil
+	}
+
+	// No semver tags: use the nearest tag of any shape
+	rev := sha
+	if currentTag != "" {
+		rev = sha + "^"
+	}
+	output, err = g.runGitCommand("describe", "--tags", "--abbrev=0", rev)
+	if err != nil {
+		return "", fmt.Errorf("failed to find previous tag: %w", err)
+	}
+	return strings.TrimSpace(output), nil
+}
+
+// GetReleaseInfo collects every commit and PR merge between the previous tag and sha
+func (g *GitAnalyzer) GetReleaseInfo(sha string) (*ReleaseInfo, error) {
+	if sha == "" {
+		sha = "HEAD"
+	}
+
+	info := &ReleaseInfo{SHA: sha, CurrentTag: g.GetCurrentTag(sha)}
+
+	prevTag, err := g.GetPreviousTag(sha, info.CurrentTag)
+	if err != nil && g.debug {
+		fmt.Printf("[DEBUG] No previous tag found, using full history: %v\n", err)
+	}
+	info.PreviousTag = prevTag
+
+	revRange := sha
+	if prevTag != "" {
+		revRange = prevTag + ".." + sha
+	}
+
+	commits, err := g.logCommits(revRange)
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range commits {
+		info.Commits = append(info.Commits, ParseReleaseCommit(c))
+	}
+
+	return info, nil
+}
+
+// BuildReleaseContext builds a context string with the classified commit log since the previous tag
+func (g *GitAnalyzer) BuildReleaseContext(sha string) (string, error) {
+	info, err := g.GetReleaseInfo(sha)
+	if err != nil {
+		return "", err
+	}
+	return info.Format(), nil
+}
+
+// Format renders the release information as model context
+func (r *ReleaseInfo) Format() string {
+	var context strings.Builder
+
+	prs := 0
+	for _, c := range r.Commits {
+		if c.PR > 0 {
+			prs++
+		}
+	}
+
+	context.WriteString("=== Release Range ===\n")
+	if r.PreviousTag != "" {
+		context.WriteString(fmt.Sprintf("From: %s\n", r.PreviousTag))
+	} else {
+		context.WriteString("From: (first release)\n")
+	}
+	if r.CurrentTag != "" {
+		context.WriteString(fmt.Sprintf("To: %s (%s)\n", r.CurrentTag, shortSHA(r.SHA)))
+	} else {
+		context.WriteString(fmt.Sprintf("To: %s\n", shortSHA(r.SHA)))
+	}
+	context.WriteString(fmt.Sprintf("Commits: %d (pull requests: %d)\n", len(r.Commits), prs))
+	context.WriteString("\n")
+
+	var breaking []ReleaseCommit
+	for _, c := range r.Commits {
+		if c.Breaking {
+			breaking = append(breaking, c)
+		}
+	}
+	if len(breaking) > 0 {
+		context.WriteString("=== Breaking Changes ===\n")
+		for _, c := range breaking {
+			context.WriteString(formatReleaseLine(c))
+			if c.Body != "" {
+				context.WriteString(fmt.Sprintf("  %s\n", strings.ReplaceAll(c.Body, "\n", "\n  ")))
+			}
+		}
+		context.WriteString("\n")
+	}
+
+	known := make(map[string]bool)
+	for _, section := range releaseSections {
+		known[section.Type] = true
+	}
+	for _, section := range releaseSections {
+		var lines []string
+		for _, c := range r.Commits {
+			// Plain merge commits without a PR title add nothing over their merged commits
+			if c.IsMerge && c.PR == 0 {
+				continue
+			}
+			if c.Type == section.Type || (section.Type == "" && !known[c.Type]) {
+				lines = append(lines, formatReleaseLine(c))
+			}
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		context.WriteString(fmt.Sprintf("=== %s ===\n", section.Title))
+		context.WriteString(strings.Join(lines, ""))
+		context.WriteString("\n")
+	}
+
+	authors := make(map[string]int)
+	for _, c := range r.Commits {
+		authors[c.Author]++
+	}
+	names := make([]string, 0, len(authors))
+	for name := range authors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	context.WriteString("=== Contributors ===\n")
+	for _, name := range names {
+		context.WriteString(fmt.Sprintf("- %s (%d commits)\n", name, authors[name]))
+	}
+	context.WriteString("\n")
+
+	return context.String()
+}
+
+// formatReleaseLine renders one commit of the release log
+func formatReleaseLine(c ReleaseCommit) string {
+	var line strings.Builder
+	line.WriteString(fmt.Sprintf("- %s ", shortSHA(c.SHA)))
+	if c.Type != "" {
+		line.WriteString(c.Type)
+		if c.Scope != "" {
+			line.WriteString(fmt.Sprintf("(%s)", c.Scope))
+		}
+		line.WriteString(": ")
+	}
+	line.WriteString(c.Subject)
+	if c.PR > 0 && !strings.Contains(c.Subject, fmt.Sprintf("#%d", c.PR)) {
+		line.WriteString(fmt.Sprintf(" (#%d)", c.PR))
+	}
+	line.WriteString(fmt.Sprintf(" by %s\n", c.Author))
+	return line.String()
+}
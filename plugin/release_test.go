@@ -0,0 +1,145 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSemVerCompare(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"v1.2.3", "v1.2.3", 0},
+		{"v1.2.3", "1.2.4", -1},
+		{"v1.10.0", "v1.9.9", 1},
+		{"v2.0.0", "v2.0.0-rc.1", 1},
+		{"v2.0.0-rc.2", "v2.0.0-rc.10", -1},
+		{"v2.0.0-alpha", "v2.0.0-alpha.1", -1},
+		{"v2.0.0-1", "v2.0.0-alpha", -1},
+	}
+
+	for _, tt := range tests {
+		a, okA := ParseSemVer(tt.a)
+		b, okB := ParseSemVer(tt.b)
+		if !okA || !okB {
+			t.Fatalf("ParseSemVer(%q, %q) failed", tt.a, tt.b)
+		}
+		if got := a.Compare(b); got != tt.want {
+			t.Errorf("%s.Compare(%s) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+
+	if _, ok := ParseSemVer("release-2024"); ok {
+		t.Error("ParseSemVer(release-2024) should fail")
+	}
+}
+
+func TestParseReleaseCommit(t *testing.T) {
+	tests := []struct {
+		name     string
+		commit   CommitInfo
+		wantType string
+		wantPR   int
+		breaking bool
+		subject  string
+	}{
+		{
+			name:     "conventional with scope",
+			commit:   CommitInfo{Message: "feat(api): add search endpoint"},
+			wantType: "feat",
+			subject:  "add search endpoint",
+		},
+		{
+			name:     "squash merge",
+			commit:   CommitInfo{Message: "fix: handle empty input (#42)"},
+			wantType: "fix",
+			wantPR:   42,
+			subject:  "handle empty input (#42)",
+		},
+		{
+			name:     "github merge takes type from PR title",
+			commit:   CommitInfo{Message: "Merge pull request #7 from org/perf", Body: "perf!: stream large diffs", IsMerge: true},
+			wantType: "perf",
+			wantPR:   7,
+			breaking: true,
+			subject:  "stream large diffs",
+		},
+		{
+			name:     "gitlab merge request",
+			commit:   CommitInfo{Message: "Merge branch 'docs' into 'main'", Body: "docs: explain tasks\n\nSee merge request group/proj!13", IsMerge: true},
+			wantType: "docs",
+			wantPR:   13,
+			subject:  "explain tasks",
+		},
+		{
+			name:     "breaking change footer",
+			commit:   CommitInfo{Message: "refactor: drop legacy flag", Body: "BREAKING CHANGE: --legacy removed"},
+			wantType: "refactor",
+			breaking: true,
+			subject:  "drop legacy flag",
+		},
+		{
+			name:    "not conventional",
+			commit:  CommitInfo{Message: "Update README"},
+			subject: "Update README",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := ParseReleaseCommit(tt.commit)
+			if rc.Type != tt.wantType || rc.PR != tt.wantPR || rc.Breaking != tt.breaking || rc.Subject != tt.subject {
+				t.Errorf("ParseReleaseCommit() = {type:%q pr:%d breaking:%v subject:%q}, want {type:%q pr:%d breaking:%v subject:%q}",
+					rc.Type, rc.PR, rc.Breaking, rc.Subject, tt.wantType, tt.wantPR, tt.breaking, tt.subject)
+			}
+		})
+	}
+}
+
+func TestGetReleaseInfo(t *testing.T) {
+	t.Setenv("DRONE_TAG", "")
+
+	dir := newTestRepo(t)
+	commitFile(t, dir, "a.txt", "1", "feat: first feature")
+	runGit(t, dir, "tag", "v1.1.0")
+	commitFile(t, dir, "a.txt", "2", "fix: early fix")
+	runGit(t, dir, "tag", "v1.2.0-rc.1")
+	commitFile(t, dir, "b.txt", "3", "feat(ui): second feature (#5)")
+	sha := commitFile(t, dir, "c.txt", "4", "chore: bump deps")
+	runGit(t, dir, "tag", "v1.2.0")
+
+	analyzer := NewGitAnalyzer(dir, false)
+	info, err := analyzer.GetReleaseInfo(sha)
+	if err != nil {
+		t.Fatalf("GetReleaseInfo() error: %v", err)
+	}
+
+	if info.CurrentTag != "v1.2.0" {
+		t.Errorf("CurrentTag = %q, want v1.2.0", info.CurrentTag)
+	}
+	// The final release skips its own release candidate
+	if info.PreviousTag != "v1.1.0" {
+		t.Errorf("PreviousTag = %q, want v1.1.0", info.PreviousTag)
+	}
+	if len(info.Commits) != 3 {
+		t.Errorf("got %d commits, want 3", len(info.Commits))
+	}
+
+	ctx := info.Format()
+	for _, want := range []string{"=== Features ===", "=== Bug Fixes ===", "=== Other Changes ===", "(#5)", "Test User (3 commits)"} {
+		if !strings.Contains(ctx, want) {
+			t.Errorf("release context missing %q:\n%s", want, ctx)
+		}
+	}
+
+	// A prerelease compares against the previous prerelease
+	rc := runGit(t, dir, "rev-list", "-n1", "v1.2.0-rc.1")
+	info, err = analyzer.GetReleaseInfo(rc)
+	if err != nil {
+		t.Fatalf("GetReleaseInfo(rc) error: %v", err)
+	}
+	if info.CurrentTag != "v1.2.0-rc.1" || info.PreviousTag != "v1.1.0" {
+		t.Errorf("rc range = %s..%s, want v1.1.0..v1.2.0-rc.1", info.PreviousTag, info.CurrentTag)
+	}
+}
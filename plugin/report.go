@@ -0,0 +1,555 @@
+package plugin
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Report formats
+const (
+	ReportFormatPlain    = "plain"
+	ReportFormatMarkdown = "markdown"
+	ReportFormatJSON     = "json"
+	ReportFormatANSI     = "ansi"
+)
+
+// ANSI escape sequences used by the ansi renderer
+const (
+	ansiReset  = "\033[0m"
+	ansiBold   = "\033[1m"
+	ansiRed    = "\033[31m"
+	ansiGreen  = "\033[32m"
+	ansiYellow = "\033[33m"
+	ansiCyan   = "\033[36m"
+)
+
+// Report is the outcome of a run in a form every renderer can consume
+type Report struct {
+	Model    string
+	Task     string
+	Locale   string
+	Result   *ExecutionResult
+	Warnings []string
+
+	// Changes and Patch describe the files a yolo or auto_edit run changed
+	Changes *PatchSummary
+	Patch   string
+
+	// Verification holds the attempts of the verify_command loop
+	Verification *Verification
+}
+
+// ReportRenderer writes a report in one output format
+type ReportRenderer interface {
+	Render(w io.Writer, report *Report) error
+}
+
+// reportRenderers maps report formats to their renderers
+var reportRenderers = map[string]ReportRenderer{
+	ReportFormatPlain:    plainRenderer{},
+	ReportFormatMarkdown: markdownRenderer{},
+	ReportFormatJSON:     jsonRenderer{},
+	ReportFormatANSI:     ansiRenderer{},
+}
+
+// NewReportRenderer returns the renderer for a report format. An empty format
+// selects plain text.
+func NewReportRenderer(format string) (ReportRenderer, error) {
+	if format == "" {
+		format = ReportFormatPlain
+	}
+	renderer, ok := reportRenderers[strings.ToLower(format)]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q%s (available: %s)", ErrUnknownReportFormat, format, suggestion(format, ReportFormats()), strings.Join(ReportFormats(), ", "))
+	}
+	return renderer, nil
+}
+
+// ReportFormats returns the sorted names of all report formats
+func ReportFormats() []string {
+	return sortedKeys(reportRenderers)
+}
+
+// NewReport creates a report for a result. Models without pricing are listed
+// as warnings so every format can surface them.
+func NewReport(cfg *Config, result *ExecutionResult) *Report {
+	report := &Report{
+		Model:  cfg.Model,
+		Task:   cfg.Task,
+		Locale: cfg.Locale,
+		Result: result,
+	}
+	if stats := report.Stats(); stats != nil {
+		for _, name := range sortedKeys(stats.Models) {
+			if !HasPricing(name) {
+				report.Warnings = append(report.Warnings, fmt.Sprintf("no pricing for model %s, its cost is unknown", name))
+			}
+		}
+	}
+	return report
+}
+
+// AddChanges adds the files a run changed, warning when the line counts differ
+// from the ones the gemini CLI reported
+func (r *Report) AddChanges(patch *Patch) {
+	r.Changes = &patch.Summary
+	r.Patch = patch.Diff
+	if mismatch := patch.Summary.CrossCheck(r.Stats()); mismatch != "" {
+		r.Warnings = append(r.Warnings, mismatch)
+	}
+}
+
+// Response returns the response text, or "" when there is none
+func (r *Report) Response() string {
+	if r.Result == nil || r.Result.Response == nil {
+		return ""
+	}
+	return r.Result.Response.Response
+}
+
+// Stats returns the CLI statistics, or nil when there are none
+func (r *Report) Stats() *CLIStats {
+	if r.Result == nil || r.Result.Response == nil {
+		return nil
+	}
+	return r.Result.Response.Stats
+}
+
+// HasResponse reports whether the CLI returned a response
+func (r *Report) HasResponse() bool {
+	return r.Result != nil && r.Result.Response != nil
+}
+
+// Cached reports whether the result was served from the response cache
+func (r *Report) Cached() bool {
+	return r.Result != nil && r.Result.Cached
+}
+
+// Truncated reports whether the response is partial because the CLI was stopped
+func (r *Report) Truncated() bool {
+	return r.Result != nil && r.Result.Truncated
+}
+
+// title returns the localized report title with its cached and partial marks
+func (r *Report) title(msg Catalog) string {
+	title := msg.T("report.title")
+	if r.Cached() {
+		title += " " + msg.T("report.cached")
+	}
+	if r.Truncated() {
+		title += " " + msg.T("report.partial")
+	}
+	return title
+}
+
+// ExitCode returns the CLI exit code
+func (r *Report) ExitCode() int {
+	if r.Result == nil {
+		return 0
+	}
+	return r.Result.ExitCode
+}
+
+// ReportModel is the usage and cost of one model in a report
+type ReportModel struct {
+	Name      string        `json:"name"`
+	API       APIStats      `json:"api"`
+	Tokens    TokenStats    `json:"tokens"`
+	Cost      CostBreakdown `json:"-"`
+	CostUSD   float64       `json:"cost_usd"`
+	CostKnown bool          `json:"cost_known"`
+}
+
+// ReportTotals is the usage and cost summed over all models
+type ReportTotals struct {
+	InputTokens   int     `json:"input_tokens"`
+	OutputTokens  int     `json:"output_tokens"`
+	CachedTokens  int     `json:"cached_tokens"`
+	ThoughtTokens int     `json:"thought_tokens"`
+	TotalTokens   int     `json:"total_tokens"`
+	CostUSD       float64 `json:"cost_usd"`
+	CostKnown     bool    `json:"cost_known"`
+}
+
+// Models returns the per-model usage sorted by model name, and the totals
+func (r *Report) Models() ([]ReportModel, ReportTotals) {
+	totals := ReportTotals{CostKnown: true}
+	stats := r.Stats()
+	if stats == nil {
+		return nil, totals
+	}
+
+	models := make([]ReportModel, 0, len(stats.Models))
+	for _, name := range sortedKeys(stats.Models) {
+		modelStats := stats.Models[name]
+		cost := calculateCostBreakdown(name, modelStats)
+		models = append(models, ReportModel{
+			Name:      name,
+			API:       modelStats.API,
+			Tokens:    modelStats.Tokens,
+			Cost:      cost,
+			CostUSD:   cost.Total,
+			CostKnown: cost.Known,
+		})
+
+		totals.InputTokens += modelStats.Tokens.Prompt
+		totals.OutputTokens += modelStats.Tokens.Candidates
+		totals.CachedTokens += modelStats.Tokens.Cached
+		totals.ThoughtTokens += modelStats.Tokens.Thoughts
+		totals.TotalTokens += modelStats.Tokens.Total
+		totals.CostUSD += cost.Total
+		totals.CostKnown = totals.CostKnown && cost.Known
+	}
+	return models, totals
+}
+
+// plainRenderer renders the classic log layout: the response followed by the statistics box
+type plainRenderer struct{}
+
+func (plainRenderer) Render(w io.Writer, r *Report) error {
+	msg := GetCatalog(r.Locale)
+	if !r.HasResponse() {
+		// Changes and warnings still explain a run without response, e.g. a cancelled one
+		var sb strings.Builder
+		sb.WriteString(msg.T("report.no_response") + "\n")
+		writeChanges(&sb, msg, r)
+		for _, warning := range r.Warnings {
+			sb.WriteString("\n⚠️  " + msg.T("report.warning", warning) + "\n")
+		}
+		_, err := io.WriteString(w, sb.String())
+		return err
+	}
+
+	var sb strings.Builder
+	sb.WriteString("=== " + r.title(msg) + " ===\n")
+	sb.WriteString("\n")
+	sb.WriteString(r.Response() + "\n")
+	writeChanges(&sb, msg, r)
+	writeVerification(&sb, msg, r)
+
+	if stats := r.Stats(); stats != nil {
+		sb.WriteString(FormatStatsLocalized(stats, r.Locale))
+	}
+
+	for _, warning := range r.Warnings {
+		sb.WriteString("\n⚠️  " + msg.T("report.warning", warning) + "\n")
+	}
+
+	if code := r.ExitCode(); code != 0 {
+		sb.WriteString("\n⚠️  " + msg.T("report.exit_code", code) + "\n")
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// ansiRenderer renders the plain layout with terminal colors
+type ansiRenderer struct{}
+
+func (ansiRenderer) Render(w io.Writer, r *Report) error {
+	msg := GetCatalog(r.Locale)
+	if !r.HasResponse() {
+		var sb strings.Builder
+		sb.WriteString(ansiYellow + msg.T("report.no_response") + ansiReset + "\n")
+		writeChanges(&sb, msg, r)
+		for _, warning := range r.Warnings {
+			sb.WriteString("\n" + ansiYellow + "⚠️  " + msg.T("report.warning", warning) + ansiReset + "\n")
+		}
+		_, err := io.WriteString(w, sb.String())
+		return err
+	}
+
+	var sb strings.Builder
+	sb.WriteString(ansiBold + ansiGreen + "=== " + r.title(msg) + " ===" + ansiReset + "\n")
+	sb.WriteString("\n")
+	sb.WriteString(r.Response() + "\n")
+	writeChanges(&sb, msg, r)
+	writeVerification(&sb, msg, r)
+
+	if stats := r.Stats(); stats != nil {
+		// Color each line separately so the box survives log viewers that reset colors per line
+		for _, line := range strings.Split(strings.TrimRight(FormatStatsLocalized(stats, r.Locale), "\n"), "\n") {
+			if line == "" {
+				sb.WriteString("\n")
+				continue
+			}
+			sb.WriteString(ansiCyan + line + ansiReset + "\n")
+		}
+	}
+
+	for _, warning := range r.Warnings {
+		sb.WriteString("\n" + ansiYellow + "⚠️  " + msg.T("report.warning", warning) + ansiReset + "\n")
+	}
+
+	if code := r.ExitCode(); code != 0 {
+		sb.WriteString("\n" + ansiBold + ansiRed + "⚠️  " + msg.T("report.exit_code", code) + ansiReset + "\n")
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// markdownRenderer renders GitHub-flavored markdown suitable for a PR comment
+type markdownRenderer struct{}
+
+func (markdownRenderer) Render(w io.Writer, r *Report) error {
+	msg := GetCatalog(r.Locale)
+
+	var sb strings.Builder
+	sb.WriteString("## 🤖 " + r.title(msg) + "\n\n")
+
+	if !r.HasResponse() {
+		sb.WriteString("_" + msg.T("report.no_response") + "_\n")
+		writeMarkdownChanges(&sb, msg, r)
+		for _, warning := range r.Warnings {
+			sb.WriteString("\n> ⚠️ " + msg.T("report.warning", warning) + "\n")
+		}
+		_, err := io.WriteString(w, sb.String())
+		return err
+	}
+
+	if meta := r.markdownMeta(msg); meta != "" {
+		sb.WriteString(meta + "\n\n")
+	}
+
+	sb.WriteString(strings.TrimSpace(r.Response()) + "\n")
+	writeMarkdownChanges(&sb, msg, r)
+	writeMarkdownVerification(&sb, msg, r)
+
+	for _, warning := range r.Warnings {
+		sb.WriteString("\n> ⚠️ " + msg.T("report.warning", warning) + "\n")
+	}
+
+	if code := r.ExitCode(); code != 0 {
+		sb.WriteString("\n> ⚠️ " + msg.T("report.exit_code", code) + "\n")
+	}
+
+	if stats := r.Stats(); stats != nil {
+		sb.WriteString("\n<details>\n<summary>" + msg.T("stats.title") + "</summary>\n\n")
+		writeMarkdownStats(&sb, msg, r)
+		sb.WriteString("\n</details>\n")
+	}
+
+	_, err := io.WriteString(w, sb.String())
+	return err
+}
+
+// writeChanges writes the files a run changed as a list
+func writeChanges(sb *strings.Builder, msg Catalog, r *Report) {
+	if r.Changes == nil || len(r.Changes.Files) == 0 {
+		return
+	}
+	sb.WriteString("\n--- " + msg.T("report.changes") + ": " +
+		msg.T("report.changes_count", len(r.Changes.Files), r.Changes.Added, r.Changes.Removed) + " ---\n")
+	for _, file := range r.Changes.Files {
+		sb.WriteString("  " + file.String() + "\n")
+	}
+}
+
+// writeVerification writes the outcome of each verify attempt
+func writeVerification(sb *strings.Builder, msg Catalog, r *Report) {
+	v := r.Verification
+	if v == nil || len(v.Attempts) == 0 {
+		return
+	}
+	sb.WriteString("\n--- " + msg.T("report.verify") + ": " + v.Command + " ---\n")
+	for _, attempt := range v.Attempts {
+		sb.WriteString("  " + attempt.summary(msg) + "\n")
+	}
+	if v.Stopped != "" {
+		sb.WriteString("  " + msg.T("report.verify_stopped", v.Stopped) + "\n")
+	}
+}
+
+// writeMarkdownVerification writes the verify attempts as a table, with the
+// command output and the diff of each attempt for review
+func writeMarkdownVerification(sb *strings.Builder, msg Catalog, r *Report) {
+	v := r.Verification
+	if v == nil || len(v.Attempts) == 0 {
+		return
+	}
+	sb.WriteString("\n### " + msg.T("report.verify") + ": `" + v.Command + "`\n\n")
+	sb.WriteString("| " + strings.Join([]string{
+		msg.T("report.col_attempt"),
+		msg.T("report.changes"),
+		msg.T("report.col_result"),
+		msg.T("report.col_cost"),
+	}, " | ") + " |\n")
+	sb.WriteString("|--:|---|---|--:|\n")
+	for _, attempt := range v.Attempts {
+		icon := "❌"
+		if attempt.Verify.Passed() {
+			icon = "✅"
+		}
+		sb.WriteString(fmt.Sprintf("| %d | %s | %s %s | %s |\n", attempt.Attempt, attempt.changesText(msg),
+			icon, attempt.Verify.Status(msg), formatCost(attempt.Usage.CostUSD, !attempt.Usage.UnknownCost, 4)))
+	}
+	if v.Stopped != "" {
+		sb.WriteString("\n> ⚠️ " + msg.T("report.verify_stopped", v.Stopped) + "\n")
+	}
+
+	for _, attempt := range v.Attempts {
+		sb.WriteString("\n<details>\n<summary>" + msg.T("report.verify_attempt", attempt.Attempt) + "</summary>\n\n")
+		if attempt.Response != "" {
+			sb.WriteString(strings.TrimSpace(attempt.Response) + "\n\n")
+		}
+		if attempt.Patch != "" {
+			patch, _ := truncatePatch(attempt.Patch)
+			sb.WriteString("````diff\n" + patch + "````\n\n")
+		}
+		sb.WriteString(msg.T("report.verify_output") + ":\n\n````text\n" + strings.TrimRight(attempt.Verify.Output, "\n") + "\n````\n")
+		sb.WriteString("\n</details>\n")
+	}
+}
+
+// summary describes an attempt in one line, e.g. "Attempt 1: 2 files changed, +3 -1 · failed (exit 1) · $0.0120"
+func (a *VerifyAttempt) summary(msg Catalog) string {
+	return fmt.Sprintf("%s: %s · %s · %s", msg.T("report.verify_attempt", a.Attempt), a.changesText(msg),
+		a.Verify.Status(msg), formatCost(a.Usage.CostUSD, !a.Usage.UnknownCost, 4))
+}
+
+// changesText describes the files an attempt changed
+func (a *VerifyAttempt) changesText(msg Catalog) string {
+	if a.Changes == nil {
+		return "-"
+	}
+	return msg.T("report.changes_count", len(a.Changes.Files), a.Changes.Added, a.Changes.Removed)
+}
+
+// writeMarkdownChanges writes the files a run changed and the patch for review
+func writeMarkdownChanges(sb *strings.Builder, msg Catalog, r *Report) {
+	if r.Changes == nil || len(r.Changes.Files) == 0 {
+		return
+	}
+	sb.WriteString("\n### " + msg.T("report.changes") + "\n\n")
+	sb.WriteString(msg.T("report.changes_count", len(r.Changes.Files), r.Changes.Added, r.Changes.Removed) + "\n\n")
+	for _, file := range r.Changes.Files {
+		if file.Binary {
+			sb.WriteString(fmt.Sprintf("- `%s` `%s` (binary)\n", file.Status, file.Path))
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("- `%s` `%s` (+%d -%d)\n", file.Status, file.Path, file.Added, file.Removed))
+	}
+
+	if r.Patch == "" {
+		return
+	}
+	patch, truncated := truncatePatch(r.Patch)
+	sb.WriteString("\n<details>\n<summary>" + msg.T("report.patch") + "</summary>\n\n")
+	// A four-backtick fence survives code fences inside the patch
+	sb.WriteString("````diff\n" + patch + "````\n")
+	if truncated {
+		sb.WriteString("\n_" + msg.T("report.patch_cut") + "_\n")
+	}
+	sb.WriteString("\n</details>\n")
+}
+
+// markdownMeta returns the model and task line shown under the markdown title
+func (r *Report) markdownMeta(msg Catalog) string {
+	var parts []string
+	if r.Model != "" {
+		parts = append(parts, msg.T("report.model", "`"+r.Model+"`"))
+	}
+	if r.Task != "" {
+		parts = append(parts, msg.T("report.task", "`"+r.Task+"`"))
+	}
+	return strings.Join(parts, " · ")
+}
+
+// writeMarkdownStats writes the statistics as markdown tables
+func writeMarkdownStats(sb *strings.Builder, msg Catalog, r *Report) {
+	stats := r.Stats()
+	models, totals := r.Models()
+
+	if len(models) > 0 {
+		sb.WriteString("| " + strings.Join([]string{
+			msg.T("report.col_model"),
+			msg.T("report.col_requests"),
+			msg.T("report.col_input"),
+			msg.T("report.col_output"),
+			msg.T("report.col_cached"),
+			msg.T("report.col_thoughts"),
+			msg.T("report.col_cost"),
+		}, " | ") + " |\n")
+		sb.WriteString("|---|--:|--:|--:|--:|--:|--:|\n")
+		for _, m := range models {
+			sb.WriteString(fmt.Sprintf("| `%s` | %d | %d | %d | %d | %d | %s |\n",
+				m.Name, m.API.TotalRequests, m.Tokens.Prompt, m.Tokens.Candidates,
+				m.Tokens.Cached, m.Tokens.Thoughts, formatCost(m.CostUSD, m.CostKnown, 4)))
+		}
+		if len(models) > 1 {
+			sb.WriteString(fmt.Sprintf("| **%s** | | %d | %d | %d | %d | **%s** |\n",
+				msg.T("report.total"), totals.InputTokens, totals.OutputTokens,
+				totals.CachedTokens, totals.ThoughtTokens, formatCost(totals.CostUSD, totals.CostKnown, 4)))
+		}
+	}
+
+	if stats.Tools.TotalCalls > 0 {
+		sb.WriteString("\n" + msg.T("stats.tools") + " " + msg.T("stats.tool_calls",
+			stats.Tools.TotalCalls, stats.Tools.TotalSuccess, stats.Tools.TotalFail) + "\n\n")
+		for _, name := range sortedKeys(stats.Tools.ByName) {
+			detail := stats.Tools.ByName[name]
+			sb.WriteString(fmt.Sprintf("- `%s`: %d (%dms)\n", name, detail.Count, detail.DurationMs))
+		}
+	}
+
+	if stats.Files.TotalLinesAdded > 0 || stats.Files.TotalLinesRemoved > 0 {
+		sb.WriteString("\n" + msg.T("stats.files") + " " +
+			msg.T("stats.lines", stats.Files.TotalLinesAdded, stats.Files.TotalLinesRemoved) + "\n")
+	}
+}
+
+// jsonReport is the document written by the json renderer
+type jsonReport struct {
+	Model    string        `json:"model"`
+	Task     string        `json:"task,omitempty"`
+	Cached   bool          `json:"cached"`
+	Partial  bool          `json:"partial"`
+	ExitCode int           `json:"exit_code"`
+	Response *string       `json:"response"`
+	Models   []ReportModel `json:"models"`
+	Totals   ReportTotals  `json:"totals"`
+	Stats    *CLIStats     `json:"stats"`
+	Warnings []string      `json:"warnings"`
+	Changes  *PatchSummary `json:"changes,omitempty"`
+
+	Verification *Verification `json:"verification,omitempty"`
+}
+
+// jsonRenderer renders a machine-readable document for artifacts and scripts
+type jsonRenderer struct{}
+
+func (jsonRenderer) Render(w io.Writer, r *Report) error {
+	models, totals := r.Models()
+	doc := jsonReport{
+		Model:    r.Model,
+		Task:     r.Task,
+		Cached:   r.Cached(),
+		Partial:  r.Truncated(),
+		ExitCode: r.ExitCode(),
+		Models:   models,
+		Totals:   totals,
+		Stats:    r.Stats(),
+		Warnings: r.Warnings,
+		Changes:  r.Changes,
+
+		Verification: r.Verification,
+	}
+	if doc.Models == nil {
+		doc.Models = []ReportModel{}
+	}
+	if doc.Warnings == nil {
+		doc.Warnings = []string{}
+	}
+	if r.HasResponse() {
+		response := r.Response()
+		doc.Response = &response
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.SetEscapeHTML(false)
+	return encoder.Encode(doc)
+}
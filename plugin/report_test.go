@@ -0,0 +1,147 @@
+package plugin
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func testReport() *Report {
+	return NewReport(&Config{Model: "gemini-2.5-pro", Task: "review"}, &ExecutionResult{
+		Response: &CLIResponse{
+			Response: "LGTM, one nit in main.go",
+			Stats: &CLIStats{
+				Models: map[string]ModelStats{
+					"gemini-2.5-pro": {
+						API:    APIStats{TotalRequests: 1, TotalLatencyMs: 1200},
+						Tokens: TokenStats{Prompt: 1000, Candidates: 200, Total: 1200},
+					},
+					"my-tuned-model": {
+						API:    APIStats{TotalRequests: 1},
+						Tokens: TokenStats{Prompt: 100, Candidates: 10, Total: 110},
+					},
+				},
+				Tools: ToolStats{
+					TotalCalls:   1,
+					TotalSuccess: 1,
+					ByName:       map[string]ToolDetail{"read_file": {Count: 1, DurationMs: 20}},
+				},
+			},
+		},
+		ExitCode: 1,
+	})
+}
+
+func TestReportRenderers(t *testing.T) {
+	tests := []struct {
+		format string
+		want   []string
+	}{
+		{
+			format: ReportFormatPlain,
+			want:   []string{"=== AI Response ===", "LGTM", "Execution Statistics", "no pricing for model my-tuned-model", "Exit Code: 1"},
+		},
+		{
+			format: ReportFormatANSI,
+			want:   []string{ansiGreen, "LGTM", ansiCyan + "╔", ansiYellow, ansiRed},
+		},
+		{
+			format: ReportFormatMarkdown,
+			want: []string{
+				"## 🤖 AI Response",
+				"Model: `gemini-2.5-pro` · Task: `review`",
+				"<details>",
+				"| `gemini-2.5-pro` | 1 | 1000 | 200 | 0 | 0 | $0.0033 |",
+				"| `my-tuned-model` | 1 | 100 | 10 | 0 | 0 | unknown |",
+				"| **Total** | | 1100 | 210 | 0 | 0 | **unknown** |",
+				"- `read_file`: 1 (20ms)",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			renderer, err := NewReportRenderer(tt.format)
+			if err != nil {
+				t.Fatalf("NewReportRenderer() error: %v", err)
+			}
+			var sb strings.Builder
+			if err := renderer.Render(&sb, testReport()); err != nil {
+				t.Fatalf("Render() error: %v", err)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(sb.String(), want) {
+					t.Errorf("%s report missing %q:\n%s", tt.format, want, sb.String())
+				}
+			}
+		})
+	}
+}
+
+func TestJSONReport(t *testing.T) {
+	renderer, _ := NewReportRenderer(ReportFormatJSON)
+	var sb strings.Builder
+	if err := renderer.Render(&sb, testReport()); err != nil {
+		t.Fatalf("Render() error: %v", err)
+	}
+
+	var doc jsonReport
+	if err := json.Unmarshal([]byte(sb.String()), &doc); err != nil {
+		t.Fatalf("report is not valid JSON: %v\n%s", err, sb.String())
+	}
+	if doc.Response == nil || *doc.Response != "LGTM, one nit in main.go" {
+		t.Errorf("response = %v, want the CLI response", doc.Response)
+	}
+	if len(doc.Models) != 2 || doc.Totals.TotalTokens != 1310 || doc.Totals.CostKnown {
+		t.Errorf("models = %+v, totals = %+v", doc.Models, doc.Totals)
+	}
+	if doc.ExitCode != 1 || len(doc.Warnings) != 1 {
+		t.Errorf("exit_code = %d, warnings = %v", doc.ExitCode, doc.Warnings)
+	}
+
+	// A missing response is null rather than an empty string
+	sb.Reset()
+	if err := renderer.Render(&sb, NewReport(&Config{}, nil)); err != nil {
+		t.Fatalf("Render() error: %v", err)
+	}
+	if !strings.Contains(sb.String(), `"response": null`) {
+		t.Errorf("missing response should render as null:\n%s", sb.String())
+	}
+}
+
+func TestReportPartial(t *testing.T) {
+	report := testReport()
+	report.Result.Truncated = true
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{format: ReportFormatPlain, want: "=== AI Response (partial) ==="},
+		{format: ReportFormatMarkdown, want: "## 🤖 AI Response (partial)"},
+		{format: ReportFormatJSON, want: `"partial": true`},
+	}
+	for _, tt := range tests {
+		renderer, err := NewReportRenderer(tt.format)
+		if err != nil {
+			t.Fatalf("NewReportRenderer() error: %v", err)
+		}
+		var sb strings.Builder
+		if err := renderer.Render(&sb, report); err != nil {
+			t.Fatalf("Render() error: %v", err)
+		}
+		if !strings.Contains(sb.String(), tt.want) {
+			t.Errorf("%s report missing %q:\n%s", tt.format, tt.want, sb.String())
+		}
+	}
+}
+
+func TestNewReportRendererUnknown(t *testing.T) {
+	if _, err := NewReportRenderer("html"); !errors.Is(err, ErrUnknownReportFormat) {
+		t.Errorf("NewReportRenderer(html) error = %v, want ErrUnknownReportFormat", err)
+	}
+	if _, err := NewReportRenderer("Markdown"); err != nil {
+		t.Errorf("NewReportRenderer(Markdown) error = %v, want case-insensitive match", err)
+	}
+}
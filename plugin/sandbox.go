@@ -0,0 +1,189 @@
+package plugin
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// SandboxCommand is the hidden subcommand the plugin re-executes itself with to
+// apply the sandbox before it replaces itself with the gemini CLI
+const SandboxCommand = "sandbox-exec"
+
+// SandboxLimits are the resource limits of the sandboxed CLI; 0 leaves a limit unchanged
+type SandboxLimits struct {
+	CPUSeconds int // CPU time per process
+	MemoryMB   int // data segment (heap) per process
+	OpenFiles  int // open file descriptors per process
+}
+
+// Sandbox runs the gemini CLI through the sandbox-exec helper: resource limits,
+// a private HOME and TMPDIR and, where the kernel
+// supports Landlock, write access limited to Target and the private HOME
+type Sandbox struct {
+	Executable string // the plugin binary
+	Limits     SandboxLimits
+	Writable   []string // empty when writes cannot be restricted
+	Home       string   // private HOME and TMPDIR, removed by Close
+}
+
+// NewSandbox prepares the sandbox for a run in cfg.Target
+func NewSandbox(cfg *Config) (*Sandbox, error) {
+	if !sandboxSupported {
+		return nil, fmt.Errorf("%w: sandbox requires Linux, not %s", ErrInvalidConfig, runtime.GOOS)
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return nil, fmt.Errorf("sandbox: %w", err)
+	}
+	target, err := filepath.Abs(cfg.Target)
+	if err != nil {
+		return nil, fmt.Errorf("sandbox: %w", err)
+	}
+	home, err := os.MkdirTemp("", "gemini-sandbox-")
+	if err != nil {
+		return nil, fmt.Errorf("sandbox: %w", err)
+	}
+	// The CLI keeps its settings and OAuth credentials in ~/.gemini
+	if err := copyGeminiSettings(filepath.Join(os.Getenv("HOME"), ".gemini"), filepath.Join(home, ".gemini")); err != nil {
+		os.RemoveAll(home)
+		return nil, fmt.Errorf("sandbox: %w", err)
+	}
+
+	s := &Sandbox{
+		Executable: exe,
+		Limits: SandboxLimits{
+			CPUSeconds: cfg.SandboxCPU,
+			MemoryMB:   cfg.SandboxMemory,
+			OpenFiles:  cfg.SandboxOpenFiles,
+		},
+		Home: home,
+	}
+	if s.Limits.CPUSeconds == 0 {
+		s.Limits.CPUSeconds = cfg.Timeout
+	}
+	if writesRestrictable() {
+		s.Writable = []string{target, home}
+	} else {
+		fmt.Println("Warning: sandbox: Landlock is not available on this kernel, writes outside target are not restricted")
+	}
+	return s, nil
+}
+
+// Command returns the helper invocation that runs name with args inside the sandbox
+func (s *Sandbox) Command(name string, args []string) (string, []string) {
+	helper := []string{
+		SandboxCommand,
+		fmt.Sprintf("--cpu=%d", s.Limits.CPUSeconds),
+		fmt.Sprintf("--memory=%d", s.Limits.MemoryMB),
+		fmt.Sprintf("--open-files=%d", s.Limits.OpenFiles),
+	}
+	for _, path := range s.Writable {
+		helper = append(helper, "--writable="+path)
+	}
+	helper = append(helper, "--", name)
+	return s.Executable, append(helper, args...)
+}
+
+// Env points HOME and TMPDIR of env at the private HOME
+func (s *Sandbox) Env(env []string) []string {
+	var kept []string
+	for _, kv := range env {
+		if key, _, _ := strings.Cut(kv, "="); key != "HOME" && key != "TMPDIR" {
+			kept = append(kept, kv)
+		}
+	}
+	return append(kept, "HOME="+s.Home, "TMPDIR="+s.Home)
+}
+
+// Describe summarizes the sandbox for the log
+func (s *Sandbox) Describe() string {
+	writable := "unrestricted"
+	if len(s.Writable) > 0 {
+		writable = strings.Join(s.Writable, ", ")
+	}
+	return fmt.Sprintf("cpu %ds, memory %s, %s open files, writable: %s",
+		s.Limits.CPUSeconds, formatLimit(s.Limits.MemoryMB, " MB"), formatLimit(s.Limits.OpenFiles, ""), writable)
+}
+
+// Close removes the private HOME
+func (s *Sandbox) Close() error {
+	return os.RemoveAll(s.Home)
+}
+
+// RunSandbox implements the sandbox-exec subcommand: it applies the limits and the
+// write restriction to its own process and then replaces itself with the command.
+// It only returns on errors.
+func RunSandbox(args []string) error {
+	// Landlock restricts the calling thread, which must be the one that execs
+	runtime.LockOSThread()
+
+	var limits SandboxLimits
+	var writable []string
+	fs := flag.NewFlagSet(SandboxCommand, flag.ContinueOnError)
+	fs.IntVar(&limits.CPUSeconds, "cpu", 0, "CPU time limit in seconds")
+	fs.IntVar(&limits.MemoryMB, "memory", 0, "data segment limit in MB")
+	fs.IntVar(&limits.OpenFiles, "open-files", 0, "open file limit")
+	fs.Func("writable", "directory the command may write to (repeatable)", func(path string) error {
+		writable = append(writable, path)
+		return nil
+	})
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	argv := fs.Args()
+	if len(argv) == 0 {
+		return errors.New("sandbox: no command")
+	}
+
+	if err := applyLimits(limits); err != nil {
+		return fmt.Errorf("sandbox: %w", err)
+	}
+	if len(writable) > 0 {
+		if err := restrictWrites(writable); err != nil {
+			return fmt.Errorf("sandbox: %w", err)
+		}
+	}
+
+	path, err := exec.LookPath(argv[0])
+	if err != nil {
+		return fmt.Errorf("sandbox: %w", err)
+	}
+	return execProgram(path, argv, os.Environ())
+}
+
+// copyGeminiSettings copies the files directly in the CLI's settings directory
+func copyGeminiSettings(src, dst string) error {
+	entries, err := os.ReadDir(src)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dst, 0o700); err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		if err := copyFile(filepath.Join(src, entry.Name()), filepath.Join(dst, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// formatLimit formats a resource limit, where 0 means unlimited
+func formatLimit(value int, unit string) string {
+	if value == 0 {
+		return "unlimited"
+	}
+	return fmt.Sprintf("%d%s", value, unit)
+}
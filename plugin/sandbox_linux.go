@@ -0,0 +1,177 @@
+//go:build linux
+
+package plugin
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"syscall"
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// sandboxSupported reports whether the sandbox can run on this platform
+const sandboxSupported = true
+
+// cpuGraceSeconds is the time between SIGXCPU at the soft CPU limit and SIGKILL at the hard one
+const cpuGraceSeconds = 5
+
+// landlockWriteAccess are the Landlock rights that modify the filesystem in ABI 1
+const landlockWriteAccess = unix.LANDLOCK_ACCESS_FS_WRITE_FILE |
+	unix.LANDLOCK_ACCESS_FS_REMOVE_DIR |
+	unix.LANDLOCK_ACCESS_FS_REMOVE_FILE |
+	unix.LANDLOCK_ACCESS_FS_MAKE_CHAR |
+	unix.LANDLOCK_ACCESS_FS_MAKE_DIR |
+	unix.LANDLOCK_ACCESS_FS_MAKE_REG |
+	unix.LANDLOCK_ACCESS_FS_MAKE_SOCK |
+	unix.LANDLOCK_ACCESS_FS_MAKE_FIFO |
+	unix.LANDLOCK_ACCESS_FS_MAKE_BLOCK |
+	unix.LANDLOCK_ACCESS_FS_MAKE_SYM
+
+// setProcessGroup starts cmd in its own process group and kills the whole group,
+// including shells the agent spawned, when the context is done
+func setProcessGroup(cmd *exec.Cmd) {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return killProcessGroup(cmd)
+	}
+}
+
+// killProcessGroup kills the process group of a started cmd
+func killProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	err := syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	if errors.Is(err, syscall.ESRCH) {
+		return nil
+	}
+	return err
+}
+
+// terminateProcessGroup sends SIGTERM to the process group of a started cmd
+func terminateProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	err := syscall.Kill(-cmd.Process.Pid, syscall.SIGTERM)
+	if errors.Is(err, syscall.ESRCH) {
+		return nil
+	}
+	return err
+}
+
+// applyLimits lowers the resource limits of the current process, which the
+// command inherits. Limits above the current hard limit are capped to it.
+func applyLimits(limits SandboxLimits) error {
+	set := func(name string, resource int, soft, hard uint64) error {
+		var current syscall.Rlimit
+		if err := syscall.Getrlimit(resource, &current); err != nil {
+			return fmt.Errorf("%s limit: %w", name, err)
+		}
+		limit := syscall.Rlimit{Cur: min(soft, current.Max), Max: min(hard, current.Max)}
+		if err := syscall.Setrlimit(resource, &limit); err != nil {
+			return fmt.Errorf("%s limit: %w", name, err)
+		}
+		return nil
+	}
+
+	if limits.CPUSeconds > 0 {
+		cpu := uint64(limits.CPUSeconds)
+		if err := set("cpu", syscall.RLIMIT_CPU, cpu, cpu+cpuGraceSeconds); err != nil {
+			return err
+		}
+	}
+	if limits.MemoryMB > 0 {
+		// RLIMIT_DATA rather than RLIMIT_AS: Node reserves far more address space than it uses
+		memory := uint64(limits.MemoryMB) << 20
+		if err := set("memory", syscall.RLIMIT_DATA, memory, memory); err != nil {
+			return err
+		}
+	}
+	if limits.OpenFiles > 0 {
+		files := uint64(limits.OpenFiles)
+		if err := set("open files", syscall.RLIMIT_NOFILE, files, files); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// landlockABI returns the Landlock ABI version of the kernel, or 0 when it is unavailable
+func landlockABI() int {
+	abi, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, 0, 0, unix.LANDLOCK_CREATE_RULESET_VERSION)
+	if errno != 0 {
+		return 0
+	}
+	return int(abi)
+}
+
+// writesRestrictable reports whether restrictWrites can work on this kernel
+func writesRestrictable() bool {
+	return landlockABI() > 0
+}
+
+// restrictWrites uses Landlock to deny the current thread, and the programs it
+// executes, any change to the filesystem outside the writable directories.
+// Writing to existing files in /dev, e.g. /dev/null, stays possible. Reading and
+// executing are not restricted.
+func restrictWrites(writable []string) error {
+	abi := landlockABI()
+	if abi == 0 {
+		return errors.New("landlock is not available")
+	}
+	access := uint64(landlockWriteAccess)
+	devAccess := uint64(unix.LANDLOCK_ACCESS_FS_WRITE_FILE)
+	if abi >= 2 {
+		access |= unix.LANDLOCK_ACCESS_FS_REFER
+	}
+	if abi >= 3 {
+		access |= unix.LANDLOCK_ACCESS_FS_TRUNCATE
+		devAccess |= unix.LANDLOCK_ACCESS_FS_TRUNCATE
+	}
+
+	attr := unix.LandlockRulesetAttr{Access_fs: access}
+	ruleset, _, errno := unix.Syscall(unix.SYS_LANDLOCK_CREATE_RULESET, uintptr(unsafe.Pointer(&attr)), unsafe.Sizeof(attr), 0)
+	if errno != 0 {
+		return fmt.Errorf("landlock ruleset: %w", errno)
+	}
+	defer unix.Close(int(ruleset))
+
+	allow := func(path string, access uint64) error {
+		fd, err := unix.Open(path, unix.O_PATH|unix.O_CLOEXEC, 0)
+		if err != nil {
+			return fmt.Errorf("landlock rule for %s: %w", path, err)
+		}
+		defer unix.Close(fd)
+		rule := unix.LandlockPathBeneathAttr{Allowed_access: access, Parent_fd: int32(fd)}
+		if _, _, errno := unix.Syscall6(unix.SYS_LANDLOCK_ADD_RULE, ruleset, unix.LANDLOCK_RULE_PATH_BENEATH, uintptr(unsafe.Pointer(&rule)), 0, 0, 0); errno != 0 {
+			return fmt.Errorf("landlock rule for %s: %w", path, errno)
+		}
+		return nil
+	}
+	for _, path := range writable {
+		if err := allow(path, access); err != nil {
+			return err
+		}
+	}
+	if err := allow("/dev", devAccess); err != nil {
+		return err
+	}
+
+	// Required to restrict an unprivileged process; also keeps setuid binaries from regaining rights
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("no_new_privs: %w", err)
+	}
+	if _, _, errno := unix.Syscall(unix.SYS_LANDLOCK_RESTRICT_SELF, ruleset, 0, 0); errno != 0 {
+		return fmt.Errorf("landlock restrict: %w", errno)
+	}
+	return nil
+}
+
+// execProgram replaces the current process with path
+func execProgram(path string, argv, env []string) error {
+	return syscall.Exec(path, argv, env)
+}
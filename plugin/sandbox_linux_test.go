@@ -0,0 +1,114 @@
+//go:build linux
+
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestSandboxExecute(t *testing.T) {
+	target := t.TempDir()
+	outside := t.TempDir()
+	installScriptGemini(t, `
+echo ok > inside.txt
+echo leak > `+outside+`/outside.txt 2>/dev/null
+echo "files=$(ulimit -n) home=$HOME key=${DRONE_NETRC_PASSWORD:-none}"
+`)
+	t.Setenv("DRONE_NETRC_PASSWORD", "token")
+
+	result, err := NewCLIExecutor(&Config{
+		Target:           target,
+		OutputFormat:     "text",
+		Timeout:          30,
+		Sandbox:          true,
+		SandboxOpenFiles: 64,
+	}).Execute("hi", "")
+	if err != nil {
+		t.Fatalf("Execute() error: %v", err)
+	}
+
+	output := strings.TrimSpace(result.RawOutput)
+	if !strings.HasPrefix(output, "files=64 home=") || !strings.HasSuffix(output, "key=none") || strings.Contains(output, "home="+os.Getenv("HOME")+" ") {
+		t.Errorf("output = %q", output)
+	}
+	if _, err := os.Stat(filepath.Join(target, "inside.txt")); err != nil {
+		t.Errorf("write inside target failed: %v", err)
+	}
+	_, err = os.Stat(filepath.Join(outside, "outside.txt"))
+	if writesRestrictable() && !os.IsNotExist(err) {
+		t.Error("write outside target should be denied")
+	}
+}
+
+func TestExecuteKillsProcessGroup(t *testing.T) {
+	tests := []struct {
+		name    string
+		timeout int
+		cancel  time.Duration
+		wantErr error
+	}{
+		{name: "timeout", timeout: 1, wantErr: ErrTimeout},
+		{name: "cancelled", timeout: 30, cancel: 500 * time.Millisecond, wantErr: ErrCancelled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			target := t.TempDir()
+			pidFile := filepath.Join(target, "child.pid")
+			installScriptGemini(t, `
+sleep 30 &
+echo $! > `+pidFile+`
+sleep 30
+`)
+			ctx := context.Background()
+			if tt.cancel > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithCancel(ctx)
+				time.AfterFunc(tt.cancel, cancel)
+				defer cancel()
+			}
+
+			start := time.Now()
+			_, err := NewCLIExecutor(&Config{Target: target, OutputFormat: "text", Timeout: tt.timeout}).WithContext(ctx).Execute("hi", "")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Execute() error = %v, want %v", err, tt.wantErr)
+			}
+			if elapsed := time.Since(start); elapsed > 10*time.Second {
+				t.Errorf("Execute() took %s", elapsed)
+			}
+
+			data, err := os.ReadFile(pidFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+			// The child may linger as a zombie of init for a moment
+			deadline := time.Now().Add(2 * time.Second)
+			for syscall.Kill(pid, 0) == nil && !isZombie(pid) {
+				if time.Now().After(deadline) {
+					t.Fatalf("background child %d is still running", pid)
+				}
+				time.Sleep(50 * time.Millisecond)
+			}
+		})
+	}
+}
+
+// isZombie reports whether pid has exited but not been reaped
+func isZombie(pid int) bool {
+	stat, err := os.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return true
+	}
+	_, rest, _ := strings.Cut(string(stat), ") ")
+	return strings.HasPrefix(rest, "Z")
+}
@@ -0,0 +1,40 @@
+//go:build !linux
+
+package plugin
+
+import (
+	"errors"
+	"os/exec"
+	"syscall"
+)
+
+// sandboxSupported reports whether the sandbox can run on this platform
+const sandboxSupported = false
+
+var errSandboxUnsupported = errors.New("sandbox requires Linux")
+
+// setProcessGroup keeps the default behaviour of killing only the CLI process
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// killProcessGroup is a no-op without process groups
+func killProcessGroup(cmd *exec.Cmd) error { return nil }
+
+// terminateProcessGroup sends SIGTERM to the CLI process, or kills it where
+// signals are not supported
+func terminateProcessGroup(cmd *exec.Cmd) error {
+	if cmd.Process == nil {
+		return nil
+	}
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		return cmd.Process.Kill()
+	}
+	return nil
+}
+
+func applyLimits(limits SandboxLimits) error { return errSandboxUnsupported }
+
+func writesRestrictable() bool { return false }
+
+func restrictWrites(writable []string) error { return errSandboxUnsupported }
+
+func execProgram(path string, argv, env []string) error { return errSandboxUnsupported }
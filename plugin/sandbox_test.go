@@ -0,0 +1,49 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestMain lets the test binary act as the sandbox-exec helper, since the sandbox
+// re-executes os.Executable()
+func TestMain(m *testing.M) {
+	if len(os.Args) > 1 && os.Args[1] == SandboxCommand {
+		err := RunSandbox(os.Args[2:])
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(126)
+	}
+	os.Exit(m.Run())
+}
+
+func TestSandboxEnv(t *testing.T) {
+	s := &Sandbox{Home: "/tmp/gemini-sandbox-1"}
+	env := s.Env([]string{"PATH=/usr/bin", "HOME=/root", "TMPDIR=/var/tmp", "GEMINI_API_KEY=key"})
+	want := []string{"PATH=/usr/bin", "GEMINI_API_KEY=key", "HOME=/tmp/gemini-sandbox-1", "TMPDIR=/tmp/gemini-sandbox-1"}
+	if strings.Join(env, " ") != strings.Join(want, " ") {
+		t.Errorf("Env() = %v, want %v", env, want)
+	}
+}
+
+func TestSandboxCommand(t *testing.T) {
+	s := &Sandbox{Executable: "/bin/plugin", Limits: SandboxLimits{CPUSeconds: 300, MemoryMB: 4096, OpenFiles: 1024}, Writable: []string{"/src"}}
+	name, args := s.Command("gemini", []string{"--prompt", "hi"})
+	want := "sandbox-exec --cpu=300 --memory=4096 --open-files=1024 --writable=/src -- gemini --prompt hi"
+	if name != "/bin/plugin" || strings.Join(args, " ") != want {
+		t.Errorf("Command() = %s %v", name, args)
+	}
+}
+
+// installScriptGemini puts a gemini script with the given body on PATH
+func installScriptGemini(t *testing.T, body string) {
+	t.Helper()
+	bin := t.TempDir()
+	script := "#!/bin/sh\nif [ \"$1\" = \"--version\" ]; then echo 0.0.0-test; exit 0; fi\n" + body
+	if err := os.WriteFile(filepath.Join(bin, "gemini"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
@@ -0,0 +1,327 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Source code hosting services that can open pull requests
+const (
+	SCMProviderGitea  = "gitea"
+	SCMProviderGitHub = "github"
+	SCMProviderGitLab = "gitlab"
+)
+
+// scmTimeout bounds an SCM API request
+const scmTimeout = 30 * time.Second
+
+// maxPullRequestBody stays below GitHub's limit of 65536 characters
+const maxPullRequestBody = 60000
+
+// PullRequest asks to merge Head into Base in Repo (owner/name)
+type PullRequest struct {
+	Repo  string
+	Head  string
+	Base  string
+	Title string
+	Body  string
+}
+
+// PullRequestResult is the pull request that was opened or updated
+type PullRequestResult struct {
+	Number  int
+	URL     string
+	Updated bool
+}
+
+// PullRequestProvider opens pull requests through an SCM API
+type PullRequestProvider interface {
+	// CreateOrUpdate opens a pull request, or updates the title and body of the
+	// open one from the same head into the same base
+	CreateOrUpdate(ctx context.Context, pr PullRequest) (*PullRequestResult, error)
+}
+
+// pullRequestProviders maps SCM providers to their constructors
+var pullRequestProviders = map[string]func(client *scmClient) PullRequestProvider{
+	SCMProviderGitea:  func(client *scmClient) PullRequestProvider { return &giteaProvider{client} },
+	SCMProviderGitHub: func(client *scmClient) PullRequestProvider { return &githubProvider{client} },
+	SCMProviderGitLab: func(client *scmClient) PullRequestProvider { return &gitlabProvider{client} },
+}
+
+// SCMProviders returns the sorted names of all SCM providers
+func SCMProviders() []string {
+	return sortedKeys(pullRequestProviders)
+}
+
+// NewPullRequestProvider returns the provider for the API at apiURL
+func NewPullRequestProvider(provider, apiURL, token string) (PullRequestProvider, error) {
+	newProvider, ok := pullRequestProviders[provider]
+	if !ok {
+		return nil, fmt.Errorf("%w: scm_provider %q%s (available: %s)", ErrInvalidConfig, provider, suggestion(provider, SCMProviders()), strings.Join(SCMProviders(), ", "))
+	}
+	// Gitea expects its own scheme; GitHub and GitLab accept OAuth and personal tokens as bearer tokens
+	auth := "Bearer " + token
+	if provider == SCMProviderGitea {
+		auth = "token " + token
+	}
+	return newProvider(&scmClient{
+		baseURL:       strings.TrimRight(apiURL, "/"),
+		authorization: auth,
+		client:        &http.Client{Timeout: scmTimeout},
+	}), nil
+}
+
+// DetectSCM fills in the provider and API URL from the repository link Drone
+// provides, e.g. https://github.com/org/repo. Values that are set are kept; only
+// github.com and gitlab.com can be recognized without scm_provider.
+func DetectSCM(provider, apiURL, repoLink string) (string, string, error) {
+	link, err := url.Parse(repoLink)
+	if err != nil || link.Host == "" {
+		link = nil
+	}
+
+	if provider == "" {
+		switch {
+		case link != nil && link.Host == "github.com":
+			provider = SCMProviderGitHub
+		case link != nil && link.Host == "gitlab.com":
+			provider = SCMProviderGitLab
+		default:
+			return "", "", fmt.Errorf("%w: set scm_provider to one of %s", ErrInvalidConfig, strings.Join(SCMProviders(), ", "))
+		}
+	}
+
+	if apiURL == "" {
+		if link == nil {
+			return "", "", fmt.Errorf("%w: set scm_url, DRONE_REPO_LINK is not available", ErrInvalidConfig)
+		}
+		base := link.Scheme + "://" + link.Host
+		switch {
+		case provider == SCMProviderGitHub && link.Host == "github.com":
+			apiURL = "https://api.github.com"
+		case provider == SCMProviderGitHub:
+			apiURL = base + "/api/v3"
+		case provider == SCMProviderGitea:
+			apiURL = base + "/api/v1"
+		case provider == SCMProviderGitLab:
+			apiURL = base + "/api/v4"
+		}
+	}
+	return provider, apiURL, nil
+}
+
+// netrcServesAPI reports whether the SCM API at apiURL is hosted on the netrc
+// machine, so the Drone clone credentials may be sent to it. GitHub serves its
+// API from api.github.com.
+func netrcServesAPI(netrc *Netrc, apiURL string) bool {
+	u, err := url.Parse(apiURL)
+	if err != nil || u.Host == "" {
+		return false
+	}
+	machine := strings.ToLower(netrc.Machine)
+	host := strings.ToLower(u.Hostname())
+	return host == machine || strings.ToLower(u.Host) == machine ||
+		(machine == "github.com" && host == "api.github.com")
+}
+
+// PullRequestBody renders the description of a pull request: the markdown report
+// with the AI response, the change summary and the cost. The diff is part of the
+// pull request itself, so the patch is left out.
+func PullRequestBody(report *Report) (string, error) {
+	withoutPatch := *report
+	withoutPatch.Patch = ""
+
+	var sb strings.Builder
+	if err := (markdownRenderer{}).Render(&sb, &withoutPatch); err != nil {
+		return "", err
+	}
+	body, truncated := truncateLines(sb.String(), maxPullRequestBody)
+	if truncated {
+		body += "\n_" + GetCatalog(report.Locale).T("report.body_cut") + "_\n"
+	}
+	return body, nil
+}
+
+// scmClient sends JSON requests to an SCM API
+type scmClient struct {
+	baseURL       string
+	authorization string
+	client        *http.Client
+}
+
+// do sends in as the JSON request body, when set, and decodes the response into out
+func (c *scmClient) do(ctx context.Context, method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Authorization", c.authorization)
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		detail, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%s %s returned %s: %s", method, redactURL(c.baseURL)+path, resp.Status, strings.TrimSpace(string(detail)))
+	}
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// githubProvider uses the GitHub REST API
+type githubProvider struct {
+	client *scmClient
+}
+
+type githubPull struct {
+	Number  int    `json:"number"`
+	HTMLURL string `json:"html_url"`
+}
+
+func (g *githubProvider) CreateOrUpdate(ctx context.Context, pr PullRequest) (*PullRequestResult, error) {
+	owner, _, _ := strings.Cut(pr.Repo, "/")
+	query := url.Values{"state": {"open"}, "head": {owner + ":" + pr.Head}, "base": {pr.Base}}
+	var open []githubPull
+	if err := g.client.do(ctx, http.MethodGet, "/repos/"+pr.Repo+"/pulls?"+query.Encode(), nil, &open); err != nil {
+		return nil, err
+	}
+
+	var pull githubPull
+	content := map[string]string{"title": pr.Title, "body": pr.Body}
+	if len(open) > 0 {
+		if err := g.client.do(ctx, http.MethodPatch, fmt.Sprintf("/repos/%s/pulls/%d", pr.Repo, open[0].Number), content, &pull); err != nil {
+			return nil, err
+		}
+		return &PullRequestResult{Number: pull.Number, URL: pull.HTMLURL, Updated: true}, nil
+	}
+
+	content["head"] = pr.Head
+	content["base"] = pr.Base
+	if err := g.client.do(ctx, http.MethodPost, "/repos/"+pr.Repo+"/pulls", content, &pull); err != nil {
+		return nil, err
+	}
+	return &PullRequestResult{Number: pull.Number, URL: pull.HTMLURL}, nil
+}
+
+// giteaProvider uses the Gitea API, which is modelled on GitHub's but cannot
+// filter pull requests by branch
+type giteaProvider struct {
+	client *scmClient
+}
+
+type giteaPull struct {
+	Number  int    `json:"number"`
+	HTMLURL string `json:"html_url"`
+	Head    struct {
+		Ref string `json:"ref"`
+	} `json:"head"`
+	Base struct {
+		Ref string `json:"ref"`
+	} `json:"base"`
+}
+
+// giteaPageSize is the number of open pull requests listed per request
+const giteaPageSize = 50
+
+func (g *giteaProvider) CreateOrUpdate(ctx context.Context, pr PullRequest) (*PullRequestResult, error) {
+	existing, err := g.findOpen(ctx, pr)
+	if err != nil {
+		return nil, err
+	}
+
+	var pull giteaPull
+	content := map[string]string{"title": pr.Title, "body": pr.Body}
+	if existing != nil {
+		if err := g.client.do(ctx, http.MethodPatch, fmt.Sprintf("/repos/%s/pulls/%d", pr.Repo, existing.Number), content, &pull); err != nil {
+			return nil, err
+		}
+		return &PullRequestResult{Number: pull.Number, URL: pull.HTMLURL, Updated: true}, nil
+	}
+
+	content["head"] = pr.Head
+	content["base"] = pr.Base
+	if err := g.client.do(ctx, http.MethodPost, "/repos/"+pr.Repo+"/pulls", content, &pull); err != nil {
+		return nil, err
+	}
+	return &PullRequestResult{Number: pull.Number, URL: pull.HTMLURL}, nil
+}
+
+// findOpen pages through the open pull requests for one from pr.Head into pr.Base
+func (g *giteaProvider) findOpen(ctx context.Context, pr PullRequest) (*giteaPull, error) {
+	for page := 1; ; page++ {
+		query := url.Values{"state": {"open"}, "limit": {fmt.Sprint(giteaPageSize)}, "page": {fmt.Sprint(page)}}
+		var open []giteaPull
+		if err := g.client.do(ctx, http.MethodGet, "/repos/"+pr.Repo+"/pulls?"+query.Encode(), nil, &open); err != nil {
+			return nil, err
+		}
+		for i := range open {
+			if open[i].Head.Ref == pr.Head && open[i].Base.Ref == pr.Base {
+				return &open[i], nil
+			}
+		}
+		if len(open) < giteaPageSize {
+			return nil, nil
+		}
+	}
+}
+
+// gitlabProvider uses the GitLab API, where pull requests are merge requests
+type gitlabProvider struct {
+	client *scmClient
+}
+
+type gitlabMergeRequest struct {
+	IID    int    `json:"iid"`
+	WebURL string `json:"web_url"`
+}
+
+func (g *gitlabProvider) CreateOrUpdate(ctx context.Context, pr PullRequest) (*PullRequestResult, error) {
+	// The project is addressed by its URL-encoded path
+	project := "/projects/" + url.PathEscape(pr.Repo) + "/merge_requests"
+	query := url.Values{"state": {"opened"}, "source_branch": {pr.Head}, "target_branch": {pr.Base}}
+	var open []gitlabMergeRequest
+	if err := g.client.do(ctx, http.MethodGet, project+"?"+query.Encode(), nil, &open); err != nil {
+		return nil, err
+	}
+
+	var mr gitlabMergeRequest
+	content := map[string]string{"title": pr.Title, "description": pr.Body}
+	if len(open) > 0 {
+		if err := g.client.do(ctx, http.MethodPut, fmt.Sprintf("%s/%d", project, open[0].IID), content, &mr); err != nil {
+			return nil, err
+		}
+		return &PullRequestResult{Number: mr.IID, URL: mr.WebURL, Updated: true}, nil
+	}
+
+	content["source_branch"] = pr.Head
+	content["target_branch"] = pr.Base
+	if err := g.client.do(ctx, http.MethodPost, project, content, &mr); err != nil {
+		return nil, err
+	}
+	return &PullRequestResult{Number: mr.IID, URL: mr.WebURL}, nil
+}
@@ -0,0 +1,309 @@
+package plugin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// fakeSCM serves one provider's pull request endpoints from a canned list of open pull requests
+type fakeSCM struct {
+	requests []string
+	auth     string
+	sent     map[string]string
+}
+
+func (f *fakeSCM) handler(list string, created string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		f.requests = append(f.requests, r.Method+" "+r.URL.EscapedPath()+"?"+r.URL.RawQuery)
+		f.auth = r.Header.Get("Authorization")
+		if r.Method == http.MethodGet {
+			// Later Gitea pages are empty
+			if r.URL.Query().Get("page") == "2" {
+				w.Write([]byte("[]"))
+				return
+			}
+			w.Write([]byte(list))
+			return
+		}
+		json.NewDecoder(r.Body).Decode(&f.sent)
+		w.Write([]byte(created))
+	}
+}
+
+func TestPullRequestProviders(t *testing.T) {
+	pr := PullRequest{Repo: "octo/app", Head: "gemini/fix-42", Base: "main", Title: "fix: lint", Body: "body"}
+
+	tests := []struct {
+		provider     string
+		list         string
+		response     string
+		wantRequests []string
+		wantAuth     string
+		wantSent     map[string]string
+		want         PullRequestResult
+	}{
+		{
+			provider: SCMProviderGitHub,
+			list:     `[]`,
+			response: `{"number": 7, "html_url": "https://github.com/octo/app/pull/7"}`,
+			wantRequests: []string{
+				"GET /repos/octo/app/pulls?base=main&head=octo%3Agemini%2Ffix-42&state=open",
+				"POST /repos/octo/app/pulls?",
+			},
+			wantAuth: "Bearer secret",
+			wantSent: map[string]string{"title": "fix: lint", "body": "body", "head": "gemini/fix-42", "base": "main"},
+			want:     PullRequestResult{Number: 7, URL: "https://github.com/octo/app/pull/7"},
+		},
+		{
+			provider: SCMProviderGitHub,
+			list:     `[{"number": 5}]`,
+			response: `{"number": 5, "html_url": "https://github.com/octo/app/pull/5"}`,
+			wantRequests: []string{
+				"GET /repos/octo/app/pulls?base=main&head=octo%3Agemini%2Ffix-42&state=open",
+				"PATCH /repos/octo/app/pulls/5?",
+			},
+			wantAuth: "Bearer secret",
+			wantSent: map[string]string{"title": "fix: lint", "body": "body"},
+			want:     PullRequestResult{Number: 5, URL: "https://github.com/octo/app/pull/5", Updated: true},
+		},
+		{
+			provider: SCMProviderGitea,
+			list:     `[{"number": 3, "head": {"ref": "gemini/fix-42"}, "base": {"ref": "develop"}}]`,
+			response: `{"number": 8, "html_url": "https://gitea.example.com/octo/app/pulls/8"}`,
+			wantRequests: []string{
+				"GET /repos/octo/app/pulls?limit=50&page=1&state=open",
+				"POST /repos/octo/app/pulls?",
+			},
+			wantAuth: "token secret",
+			wantSent: map[string]string{"title": "fix: lint", "body": "body", "head": "gemini/fix-42", "base": "main"},
+			want:     PullRequestResult{Number: 8, URL: "https://gitea.example.com/octo/app/pulls/8"},
+		},
+		{
+			provider: SCMProviderGitea,
+			list:     `[{"number": 3, "head": {"ref": "gemini/fix-42"}, "base": {"ref": "main"}}]`,
+			response: `{"number": 3, "html_url": "https://gitea.example.com/octo/app/pulls/3"}`,
+			wantRequests: []string{
+				"GET /repos/octo/app/pulls?limit=50&page=1&state=open",
+				"PATCH /repos/octo/app/pulls/3?",
+			},
+			wantAuth: "token secret",
+			wantSent: map[string]string{"title": "fix: lint", "body": "body"},
+			want:     PullRequestResult{Number: 3, URL: "https://gitea.example.com/octo/app/pulls/3", Updated: true},
+		},
+		{
+			provider: SCMProviderGitLab,
+			list:     `[]`,
+			response: `{"iid": 11, "web_url": "https://gitlab.com/octo/app/-/merge_requests/11"}`,
+			wantRequests: []string{
+				"GET /projects/octo%2Fapp/merge_requests?source_branch=gemini%2Ffix-42&state=opened&target_branch=main",
+				"POST /projects/octo%2Fapp/merge_requests?",
+			},
+			wantAuth: "Bearer secret",
+			wantSent: map[string]string{"title": "fix: lint", "description": "body", "source_branch": "gemini/fix-42", "target_branch": "main"},
+			want:     PullRequestResult{Number: 11, URL: "https://gitlab.com/octo/app/-/merge_requests/11"},
+		},
+		{
+			provider: SCMProviderGitLab,
+			list:     `[{"iid": 9}]`,
+			response: `{"iid": 9, "web_url": "https://gitlab.com/octo/app/-/merge_requests/9"}`,
+			wantRequests: []string{
+				"GET /projects/octo%2Fapp/merge_requests?source_branch=gemini%2Ffix-42&state=opened&target_branch=main",
+				"PUT /projects/octo%2Fapp/merge_requests/9?",
+			},
+			wantAuth: "Bearer secret",
+			wantSent: map[string]string{"title": "fix: lint", "description": "body"},
+			want:     PullRequestResult{Number: 9, URL: "https://gitlab.com/octo/app/-/merge_requests/9", Updated: true},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.provider+" "+tt.want.URL, func(t *testing.T) {
+			fake := &fakeSCM{}
+			server := httptest.NewServer(fake.handler(tt.list, tt.response))
+			defer server.Close()
+
+			provider, err := NewPullRequestProvider(tt.provider, server.URL+"/", "secret")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := provider.CreateOrUpdate(context.Background(), pr)
+			if err != nil {
+				t.Fatalf("CreateOrUpdate() error: %v", err)
+			}
+			if *got != tt.want {
+				t.Errorf("CreateOrUpdate() = %+v, want %+v", *got, tt.want)
+			}
+			if strings.Join(fake.requests, "\n") != strings.Join(tt.wantRequests, "\n") {
+				t.Errorf("requests:\n%s\nwant:\n%s", strings.Join(fake.requests, "\n"), strings.Join(tt.wantRequests, "\n"))
+			}
+			if fake.auth != tt.wantAuth {
+				t.Errorf("Authorization = %q, want %q", fake.auth, tt.wantAuth)
+			}
+			if len(fake.sent) != len(tt.wantSent) {
+				t.Errorf("sent %v, want %v", fake.sent, tt.wantSent)
+			}
+			for key, value := range tt.wantSent {
+				if fake.sent[key] != value {
+					t.Errorf("sent %s = %q, want %q", key, fake.sent[key], value)
+				}
+			}
+		})
+	}
+}
+
+func TestPullRequestProviderErrors(t *testing.T) {
+	if _, err := NewPullRequestProvider("githb", "https://api.github.com", "secret"); err == nil || !strings.Contains(err.Error(), `did you mean "github"?`) {
+		t.Errorf("NewPullRequestProvider() error = %v", err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"message": "Bad credentials"}`, http.StatusUnauthorized)
+	}))
+	defer server.Close()
+	provider, _ := NewPullRequestProvider(SCMProviderGitHub, server.URL, "secret")
+	_, err := provider.CreateOrUpdate(context.Background(), PullRequest{Repo: "octo/app", Head: "fix", Base: "main"})
+	if err == nil || !strings.Contains(err.Error(), "401") || !strings.Contains(err.Error(), "Bad credentials") {
+		t.Errorf("CreateOrUpdate() error = %v", err)
+	}
+}
+
+func TestDetectSCM(t *testing.T) {
+	tests := []struct {
+		provider, apiURL, link string
+		wantProvider, wantURL  string
+		wantErr                bool
+	}{
+		{link: "https://github.com/octo/app", wantProvider: "github", wantURL: "https://api.github.com"},
+		{link: "https://gitlab.com/octo/app", wantProvider: "gitlab", wantURL: "https://gitlab.com/api/v4"},
+		{provider: "gitea", link: "https://git.example.com/octo/app", wantProvider: "gitea", wantURL: "https://git.example.com/api/v1"},
+		{provider: "github", link: "https://ghe.example.com/octo/app", wantProvider: "github", wantURL: "https://ghe.example.com/api/v3"},
+		{provider: "gitlab", apiURL: "http://gitlab:8080/api/v4", wantProvider: "gitlab", wantURL: "http://gitlab:8080/api/v4"},
+		{link: "https://git.example.com/octo/app", wantErr: true},
+		{provider: "gitea", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		provider, apiURL, err := DetectSCM(tt.provider, tt.apiURL, tt.link)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("DetectSCM(%q, %q, %q) error = %v, wantErr %v", tt.provider, tt.apiURL, tt.link, err, tt.wantErr)
+			continue
+		}
+		if provider != tt.wantProvider || apiURL != tt.wantURL {
+			t.Errorf("DetectSCM(%q, %q, %q) = %q, %q, want %q, %q", tt.provider, tt.apiURL, tt.link, provider, apiURL, tt.wantProvider, tt.wantURL)
+		}
+	}
+}
+
+func TestPullRequestBody(t *testing.T) {
+	report := testReport()
+	report.AddChanges(&Patch{
+		Diff:    "diff --git a/main.go b/main.go\n",
+		Summary: PatchSummary{Files: []PatchFileStat{{Path: "main.go", Status: "M", Added: 1}}, Added: 1},
+	})
+
+	body, err := PullRequestBody(report)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"LGTM, one nit in main.go", "- `M` `main.go` (+1 -0)", "$0.0033"} {
+		if !strings.Contains(body, want) {
+			t.Errorf("body does not contain %q:\n%s", want, body)
+		}
+	}
+	if strings.Contains(body, "diff --git") {
+		t.Error("body should not contain the patch")
+	}
+
+	report.Result.Response.Response = strings.Repeat("finding\n", maxPullRequestBody/8)
+	body, _ = PullRequestBody(report)
+	if len(body) > maxPullRequestBody+200 || !strings.Contains(body, "truncated") {
+		t.Errorf("long body is %d bytes", len(body))
+	}
+}
+
+func TestOpenPullRequest(t *testing.T) {
+	fake := &fakeSCM{}
+	server := httptest.NewServer(fake.handler(`[]`, `{"number": 7, "html_url": "https://github.com/octo/app/pull/7"}`))
+	defer server.Close()
+
+	t.Setenv("DRONE_REPO", "octo/app")
+	t.Setenv("DRONE_REPO_LINK", "https://github.com/octo/app")
+	t.Setenv("DRONE_SOURCE_BRANCH", "feature")
+	t.Setenv("DRONE_NETRC_MACHINE", "127.0.0.1")
+	t.Setenv("DRONE_NETRC_USERNAME", "bot")
+	t.Setenv("DRONE_NETRC_PASSWORD", "netrc-token")
+
+	p := New(Config{Model: "gemini-2.5-pro", PullRequest: true, SCMURL: server.URL})
+	p.pushed = &PushResult{Branch: "gemini/fix-42", Subject: "fix: lint findings"}
+	if err := p.openPullRequest(context.Background(), &ExecutionResult{Response: &CLIResponse{Response: "Fixed 3 lint findings"}}); err != nil {
+		t.Fatalf("openPullRequest() error: %v", err)
+	}
+	if fake.auth != "Bearer netrc-token" {
+		t.Errorf("Authorization = %q, want the netrc password", fake.auth)
+	}
+	if fake.sent["base"] != "feature" || fake.sent["title"] != "fix: lint findings" || !strings.Contains(fake.sent["body"], "Fixed 3 lint findings") {
+		t.Errorf("sent %v", fake.sent)
+	}
+
+	t.Setenv("DRONE_NETRC_MACHINE", "")
+	if err := p.openPullRequest(context.Background(), &ExecutionResult{}); !errors.Is(err, ErrPullRequest) {
+		t.Errorf("openPullRequest() without a token error = %v", err)
+	}
+}
+
+func TestOpenPullRequestNetrcHostMismatch(t *testing.T) {
+	fake := &fakeSCM{}
+	server := httptest.NewServer(fake.handler(`[]`, `{"number": 7, "html_url": "https://github.com/octo/app/pull/7"}`))
+	defer server.Close()
+
+	t.Setenv("DRONE_REPO", "octo/app")
+	t.Setenv("DRONE_SOURCE_BRANCH", "feature")
+	t.Setenv("DRONE_NETRC_MACHINE", "github.com")
+	t.Setenv("DRONE_NETRC_USERNAME", "bot")
+	t.Setenv("DRONE_NETRC_PASSWORD", "netrc-token")
+
+	// scm_url points at another host than the one the clone credentials are for
+	p := New(Config{Model: "gemini-2.5-pro", PullRequest: true, SCMProvider: "github", SCMURL: server.URL})
+	p.pushed = &PushResult{Branch: "gemini/fix-42", Subject: "fix: lint findings"}
+	err := p.openPullRequest(context.Background(), &ExecutionResult{})
+	if !errors.Is(err, ErrPullRequest) || !strings.Contains(err.Error(), "set scm_token") {
+		t.Errorf("openPullRequest() error = %v, want scm_token required", err)
+	}
+	if fake.auth != "" {
+		t.Errorf("netrc credentials sent to %s: Authorization = %q", server.URL, fake.auth)
+	}
+
+	// An explicit scm_token is used for any host
+	p.config.SCMToken = "scm-token"
+	if err := p.openPullRequest(context.Background(), &ExecutionResult{Response: &CLIResponse{Response: "Fixed"}}); err != nil {
+		t.Fatalf("openPullRequest() with scm_token error: %v", err)
+	}
+	if fake.auth != "Bearer scm-token" {
+		t.Errorf("Authorization = %q, want scm_token", fake.auth)
+	}
+}
+
+func TestNetrcServesAPI(t *testing.T) {
+	tests := []struct {
+		machine, apiURL string
+		want            bool
+	}{
+		{"github.com", "https://api.github.com", true},
+		{"ghe.example.com", "https://ghe.example.com/api/v3", true},
+		{"gitea.local:3000", "http://gitea.local:3000/api/v1", true},
+		{"GitLab.com", "https://gitlab.com/api/v4", true},
+		{"github.com", "https://evil.example.com", false},
+		{"github.com", "https://api.github.com.evil.example.com", false},
+		{"github.com", "not a url", false},
+	}
+	for _, tt := range tests {
+		if got := netrcServesAPI(&Netrc{Machine: tt.machine}, tt.apiURL); got != tt.want {
+			t.Errorf("netrcServesAPI(%q, %q) = %v, want %v", tt.machine, tt.apiURL, got, tt.want)
+		}
+	}
+}
@@ -2,28 +2,46 @@ package plugin
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 )
 
 // ModelPricing contains pricing information for a model
 type ModelPricing struct {
-	Name                 string
-	InputPriceShort      float64 // per 1M tokens (context <= 200K)
-	InputPriceLong       float64 // per 1M tokens (context > 200K)
-	OutputPriceShort     float64 // per 1M tokens
-	OutputPriceLong      float64 // per 1M tokens
-	LongContextThreshold int     // tokens, 0 means no long context pricing
+	Name                 string  `yaml:"name" json:"name"`
+	InputPriceShort      float64 `yaml:"input_price" json:"input_price"`             // per 1M tokens (context <= threshold)
+	InputPriceLong       float64 `yaml:"input_price_long" json:"input_price_long"`   // per 1M tokens (context > threshold)
+	OutputPriceShort     float64 `yaml:"output_price" json:"output_price"`           // per 1M tokens, also applies to thinking tokens
+	OutputPriceLong      float64 `yaml:"output_price_long" json:"output_price_long"` // per 1M tokens
+	CachedPriceShort     float64 `yaml:"cached_price" json:"cached_price"`           // per 1M cached input tokens, 0 means no discount
+	CachedPriceLong      float64 `yaml:"cached_price_long" json:"cached_price_long"` // per 1M cached input tokens
+	LongContextThreshold int     `yaml:"long_context_threshold" json:"long_context_threshold"`
+}
+
+// CostBreakdown is the cost of a model's token usage split by billing category
+type CostBreakdown struct {
+	Input       float64 // uncached prompt tokens
+	CachedInput float64 // cached prompt tokens at the discounted rate
+	Output      float64 // candidate tokens
+	Thoughts    float64 // thinking tokens, billed as output
+	Tool        float64 // tool-use prompt tokens, billed as input
+	Total       float64
+	LongContext bool // long-context tier was applied
+	Known       bool // false when the model has no pricing; all costs are then zero
 }
 
 // PricingTable contains pricing for all supported models
 var PricingTable = map[string]ModelPricing{
 	// Gemini 3.0 Series (Preview)
 	"gemini-3-pro-preview": {
-		Name:             "Gemini 3 Pro",
-		InputPriceShort:  4.00,
-		InputPriceLong:   4.00,
-		OutputPriceShort: 12.00,
-		OutputPriceLong:  12.00,
+		Name:                 "Gemini 3 Pro",
+		InputPriceShort:      2.00,
+		InputPriceLong:       4.00,
+		OutputPriceShort:     12.00,
+		OutputPriceLong:      18.00,
+		CachedPriceShort:     0.20,
+		CachedPriceLong:      0.40,
+		LongContextThreshold: 200000,
 	},
 	"gemini-3-flash-preview": {
 		Name:             "Gemini 3 Flash",
@@ -31,6 +49,8 @@ var PricingTable = map[string]ModelPricing{
 		InputPriceLong:   0.50,
 		OutputPriceShort: 3.00,
 		OutputPriceLong:  3.00,
+		CachedPriceShort: 0.05,
+		CachedPriceLong:  0.05,
 	},
 
 	// Gemini 2.5 Series (Production)
@@ -40,6 +60,8 @@ var PricingTable = map[string]ModelPricing{
 		InputPriceLong:       2.50,
 		OutputPriceShort:     10.00,
 		OutputPriceLong:      15.00,
+		CachedPriceShort:     0.125,
+		CachedPriceLong:      0.25,
 		LongContextThreshold: 200000,
 	},
 	"gemini-2.5-flash": {
@@ -48,6 +70,8 @@ var PricingTable = map[string]ModelPricing{
 		InputPriceLong:   0.30,
 		OutputPriceShort: 2.50,
 		OutputPriceLong:  2.50,
+		CachedPriceShort: 0.03,
+		CachedPriceLong:  0.03,
 	},
 	"gemini-2.5-flash-lite": {
 		Name:             "Gemini 2.5 Flash-Lite",
@@ -55,6 +79,8 @@ var PricingTable = map[string]ModelPricing{
 		InputPriceLong:   0.10,
 		OutputPriceShort: 0.40,
 		OutputPriceLong:  0.40,
+		CachedPriceShort: 0.01,
+		CachedPriceLong:  0.01,
 	},
 
 	// Gemini 2.0 Series
@@ -64,6 +90,8 @@ var PricingTable = map[string]ModelPricing{
 		InputPriceLong:   0.15,
 		OutputPriceShort: 0.60,
 		OutputPriceLong:  0.60,
+		CachedPriceShort: 0.025,
+		CachedPriceLong:  0.025,
 	},
 	"gemini-2.0-flash-exp": {
 		Name:             "Gemini 2.0 Flash (Exp)",
@@ -82,61 +110,68 @@ var PricingTable = map[string]ModelPricing{
 
 	// Gemini 1.5 Series (legacy)
 	"gemini-1.5-pro": {
-		Name:             "Gemini 1.5 Pro",
-		InputPriceShort:  1.25,
-		InputPriceLong:   1.25,
-		OutputPriceShort: 5.00,
-		OutputPriceLong:  5.00,
+		Name:                 "Gemini 1.5 Pro",
+		InputPriceShort:      1.25,
+		InputPriceLong:       2.50,
+		OutputPriceShort:     5.00,
+		OutputPriceLong:      10.00,
+		CachedPriceShort:     0.3125,
+		CachedPriceLong:      0.625,
+		LongContextThreshold: 128000,
 	},
 	"gemini-1.5-flash": {
-		Name:             "Gemini 1.5 Flash",
-		InputPriceShort:  0.075,
-		InputPriceLong:   0.075,
-		OutputPriceShort: 0.30,
-		OutputPriceLong:  0.30,
+		Name:                 "Gemini 1.5 Flash",
+		InputPriceShort:      0.075,
+		InputPriceLong:       0.15,
+		OutputPriceShort:     0.30,
+		OutputPriceLong:      0.60,
+		CachedPriceShort:     0.01875,
+		CachedPriceLong:      0.0375,
+		LongContextThreshold: 128000,
 	},
 }
 
-// FormatStats formats CLI statistics as a readable string
+// FormatStats formats CLI statistics as a readable string using English labels
 func FormatStats(stats *CLIStats) string {
+	return FormatStatsLocalized(stats, LocaleEnglish)
+}
+
+// FormatStatsLocalized formats CLI statistics with the labels of a locale
+func FormatStatsLocalized(stats *CLIStats, locale string) string {
 	if stats == nil {
 		return ""
 	}
 
-	var sb strings.Builder
-
-	sb.WriteString("\n")
-	sb.WriteString("╔══════════════════════════════════════════════════════════════╗\n")
-	sb.WriteString("║                    📊 执行统计                                ║\n")
-	sb.WriteString("╠══════════════════════════════════════════════════════════════╣\n")
+	msg := GetCatalog(locale)
+	table := NewBoxTable(msg.T("stats.title"))
 
 	// Model statistics
 	if len(stats.Models) > 0 {
-		sb.WriteString("║  🤖 模型使用:                                                 ║\n")
+		table.Section()
+		table.Row(msg.T("stats.models"))
 		totalInputTokens := 0
 		totalOutputTokens := 0
 		totalThoughtsTokens := 0
 		totalCost := 0.0
+		costKnown := true
 
-		for modelName, modelStats := range stats.Models {
-			sb.WriteString(fmt.Sprintf("║    %-58s ║\n", modelName))
-			sb.WriteString(fmt.Sprintf("║      请求: %d, 错误: %d, 延迟: %dms%s\n",
+		for _, modelName := range sortedKeys(stats.Models) {
+			modelStats := stats.Models[modelName]
+			table.Row("  " + modelName)
+			table.Row("    " + msg.T("stats.requests",
 				modelStats.API.TotalRequests,
 				modelStats.API.TotalErrors,
-				modelStats.API.TotalLatencyMs,
-				strings.Repeat(" ", 20)))
+				modelStats.API.TotalLatencyMs))
 
 			tokens := modelStats.Tokens
-			sb.WriteString(fmt.Sprintf("║      输入: %d, 输出: %d, 缓存: %d%s\n",
-				tokens.Prompt,
-				tokens.Candidates,
-				tokens.Cached,
-				strings.Repeat(" ", 20)))
+			table.Row("    " + msg.T("stats.tokens", tokens.Prompt, tokens.Candidates, tokens.Cached))
 
 			if tokens.Thoughts > 0 {
-				sb.WriteString(fmt.Sprintf("║      🧠 思考 Tokens: %d%s\n",
-					tokens.Thoughts,
-					strings.Repeat(" ", 35)))
+				table.Row("    " + msg.T("stats.thoughts", tokens.Thoughts))
+			}
+
+			if tokens.Tool > 0 {
+				table.Row("    " + msg.T("stats.tool_tokens", tokens.Tool))
 			}
 
 			totalInputTokens += tokens.Prompt
@@ -144,86 +179,147 @@ func FormatStats(stats *CLIStats) string {
 			totalThoughtsTokens += tokens.Thoughts
 
 			// Calculate cost
-			cost := calculateModelCost(modelName, tokens)
-			totalCost += cost
+			cost := calculateCostBreakdown(modelName, modelStats)
+			totalCost += cost.Total
+			if !cost.Known {
+				costKnown = false
+				table.Row("    " + msg.T("stats.cost", formatCost(0, false, 6)+" "+msg.T("stats.no_pricing")))
+				continue
+			}
+
+			costText := formatCost(cost.Total, true, 6)
+			if cost.LongContext {
+				costText += " " + msg.T("stats.long_context")
+			}
+			table.Row("    " + msg.T("stats.cost", costText))
+			table.Row("       " + msg.T("stats.cost_input",
+				formatCost(cost.Input, true, 6),
+				formatCost(cost.CachedInput, true, 6),
+				formatCost(cost.Tool, true, 6)))
+			table.Row("       " + msg.T("stats.cost_output",
+				formatCost(cost.Output, true, 6),
+				formatCost(cost.Thoughts, true, 6)))
 		}
 
-		sb.WriteString("╠══════════════════════════════════════════════════════════════╣\n")
-		sb.WriteString(fmt.Sprintf("║  总输入 Tokens: %-46d ║\n", totalInputTokens))
-		sb.WriteString(fmt.Sprintf("║  总输出 Tokens: %-46d ║\n", totalOutputTokens))
+		table.Section()
+		table.Row(msg.T("stats.total_input", totalInputTokens))
+		table.Row(msg.T("stats.total_output", totalOutputTokens))
 		if totalThoughtsTokens > 0 {
-			sb.WriteString(fmt.Sprintf("║  🧠 总思考 Tokens: %-43d ║\n", totalThoughtsTokens))
+			table.Row(msg.T("stats.total_thoughts", totalThoughtsTokens))
 		}
-		sb.WriteString(fmt.Sprintf("║  💵 预估成本: $%-47.6f ║\n", totalCost))
+		table.Row(msg.T("stats.total_cost", formatCost(totalCost, costKnown, 6)))
 	}
 
 	// Tool statistics
 	if stats.Tools.TotalCalls > 0 {
-		sb.WriteString("╠══════════════════════════════════════════════════════════════╣\n")
-		sb.WriteString("║  🔧 工具调用:                                                 ║\n")
-		sb.WriteString(fmt.Sprintf("║    总调用: %d, 成功: %d, 失败: %d%s\n",
+		table.Section()
+		table.Row(msg.T("stats.tools"))
+		table.Row("  " + msg.T("stats.tool_calls",
 			stats.Tools.TotalCalls,
 			stats.Tools.TotalSuccess,
-			stats.Tools.TotalFail,
-			strings.Repeat(" ", 25)))
-		sb.WriteString(fmt.Sprintf("║    总耗时: %dms%s\n",
-			stats.Tools.TotalDurationMs,
-			strings.Repeat(" ", 43)))
+			stats.Tools.TotalFail))
+		table.Row("  " + msg.T("stats.tool_duration", stats.Tools.TotalDurationMs))
 
 		if len(stats.Tools.ByName) > 0 {
-			sb.WriteString("║    工具详情:                                                  ║\n")
-			for toolName, detail := range stats.Tools.ByName {
-				sb.WriteString(fmt.Sprintf("║      - %s: %d次 (%dms)%s\n",
-					toolName,
-					detail.Count,
-					detail.DurationMs,
-					strings.Repeat(" ", 30)))
+			table.Row("  " + msg.T("stats.tool_details"))
+			for _, toolName := range sortedKeys(stats.Tools.ByName) {
+				detail := stats.Tools.ByName[toolName]
+				table.Row("    " + msg.T("stats.tool_detail", toolName, detail.Count, detail.DurationMs))
 			}
 		}
 	}
 
 	// File statistics
 	if stats.Files.TotalLinesAdded > 0 || stats.Files.TotalLinesRemoved > 0 {
-		sb.WriteString("╠══════════════════════════════════════════════════════════════╣\n")
-		sb.WriteString("║  📁 文件修改:                                                 ║\n")
-		sb.WriteString(fmt.Sprintf("║    +%d 行添加, -%d 行删除%s\n",
-			stats.Files.TotalLinesAdded,
-			stats.Files.TotalLinesRemoved,
-			strings.Repeat(" ", 32)))
+		table.Section()
+		table.Row(msg.T("stats.files"))
+		table.Row("  " + msg.T("stats.lines", stats.Files.TotalLinesAdded, stats.Files.TotalLinesRemoved))
 	}
 
-	sb.WriteString("╚══════════════════════════════════════════════════════════════╝\n")
+	return "\n" + table.String()
+}
 
-	return sb.String()
+// sortedKeys returns the keys of a string-keyed map in sorted order
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
 }
 
-// calculateModelCost calculates the cost for a model's token usage
-func calculateModelCost(modelName string, tokens TokenStats) float64 {
-	pricing, ok := PricingTable[modelName]
-	if !ok {
-		// Try partial match
-		for key, p := range PricingTable {
-			if strings.Contains(strings.ToLower(modelName), strings.ToLower(key)) {
-				pricing = p
-				ok = true
-				break
-			}
+// lookupPricing finds the pricing for a model, falling back to a partial name match
+func lookupPricing(modelName string) (ModelPricing, bool) {
+	if pricing, ok := PricingTable[modelName]; ok {
+		return pricing, true
+	}
+
+	// Try partial match, preferring the longest key so gemini-2.5-flash-lite
+	// does not match gemini-2.5-flash
+	var best string
+	for key := range PricingTable {
+		if strings.Contains(strings.ToLower(modelName), strings.ToLower(key)) && len(key) > len(best) {
+			best = key
 		}
 	}
+	if best != "" {
+		return PricingTable[best], true
+	}
+
+	return ModelPricing{}, false
+}
 
+// calculateCostBreakdown prices a model's token usage by category. The long-context
+// tier applies when the average prompt per request exceeds the model's threshold.
+func calculateCostBreakdown(modelName string, stats ModelStats) CostBreakdown {
+	pricing, ok := lookupPricing(modelName)
 	if !ok {
-		// Default pricing
-		pricing = ModelPricing{
-			InputPriceShort:  1.00,
-			OutputPriceShort: 5.00,
-		}
+		// Never invent a price for an unknown model
+		return CostBreakdown{}
 	}
 
-	inputCost := float64(tokens.Prompt) / 1_000_000 * pricing.InputPriceShort
-	outputCost := float64(tokens.Candidates) / 1_000_000 * pricing.OutputPriceShort
-	thoughtsCost := float64(tokens.Thoughts) / 1_000_000 * pricing.OutputPriceShort
+	tokens := stats.Tokens
+	requests := stats.API.TotalRequests
+	if requests < 1 {
+		requests = 1
+	}
+
+	b := CostBreakdown{Known: true}
+	inputPrice := pricing.InputPriceShort
+	outputPrice := pricing.OutputPriceShort
+	cachedPrice := pricing.CachedPriceShort
+	if pricing.LongContextThreshold > 0 && tokens.Prompt/requests > pricing.LongContextThreshold {
+		b.LongContext = true
+		inputPrice = pricing.InputPriceLong
+		outputPrice = pricing.OutputPriceLong
+		cachedPrice = pricing.CachedPriceLong
+	}
+	if cachedPrice == 0 {
+		cachedPrice = inputPrice
+	}
+
+	// Prompt tokens include cached tokens
+	uncached := tokens.Prompt - tokens.Cached
+	if uncached < 0 {
+		uncached = 0
+	}
+
+	b.Input = float64(uncached) / 1_000_000 * inputPrice
+	b.CachedInput = float64(tokens.Cached) / 1_000_000 * cachedPrice
+	b.Output = float64(tokens.Candidates) / 1_000_000 * outputPrice
+	b.Thoughts = float64(tokens.Thoughts) / 1_000_000 * outputPrice
+	b.Tool = float64(tokens.Tool) / 1_000_000 * inputPrice
+	b.Total = b.Input + b.CachedInput + b.Output + b.Thoughts + b.Tool
+
+	return b
+}
 
-	return inputCost + outputCost + thoughtsCost
+// calculateModelCost calculates the cost for a model's token usage.
+// It returns false when the model has no pricing.
+func calculateModelCost(modelName string, stats ModelStats) (float64, bool) {
+	b := calculateCostBreakdown(modelName, stats)
+	return b.Total, b.Known
 }
 
 // FormatStatsSimple returns a one-line summary
@@ -234,14 +330,17 @@ func FormatStatsSimple(stats *CLIStats) string {
 
 	totalTokens := 0
 	totalCost := 0.0
+	costKnown := true
 
 	for modelName, modelStats := range stats.Models {
 		totalTokens += modelStats.Tokens.Total
-		totalCost += calculateModelCost(modelName, modelStats.Tokens)
+		cost, known := calculateModelCost(modelName, modelStats)
+		totalCost += cost
+		costKnown = costKnown && known
 	}
 
-	return fmt.Sprintf("Tokens: %d, Tools: %d, Cost: $%.4f",
+	return fmt.Sprintf("Tokens: %d, Tools: %d, Cost: %s",
 		totalTokens,
 		stats.Tools.TotalCalls,
-		totalCost)
+		formatCost(totalCost, costKnown, 4))
 }
@@ -0,0 +1,134 @@
+package plugin
+
+import (
+	"strings"
+	"unicode"
+)
+
+// minTableWidth is the minimum inner width of a rendered box
+const minTableWidth = 62
+
+// BoxTable renders a bordered box whose borders line up regardless of the
+// display width of its content (CJK characters and emoji take two columns)
+type BoxTable struct {
+	title    string
+	sections [][]string
+}
+
+// NewBoxTable creates a box with a centered title
+func NewBoxTable(title string) *BoxTable {
+	return &BoxTable{title: title}
+}
+
+// Section starts a new section, separated from the previous one by a divider
+func (t *BoxTable) Section() {
+	t.sections = append(t.sections, nil)
+}
+
+// Row adds a line to the current section
+func (t *BoxTable) Row(line string) {
+	if len(t.sections) == 0 {
+		t.Section()
+	}
+	last := len(t.sections) - 1
+	t.sections[last] = append(t.sections[last], line)
+}
+
+// String renders the box
+func (t *BoxTable) String() string {
+	width := minTableWidth
+	if w := displayWidth(t.title) + 4; w > width {
+		width = w
+	}
+	for _, section := range t.sections {
+		for _, line := range section {
+			if w := displayWidth(line) + 2; w > width {
+				width = w
+			}
+		}
+	}
+
+	var sb strings.Builder
+	border := strings.Repeat("═", width)
+
+	sb.WriteString("╔" + border + "╗\n")
+	left := (width - displayWidth(t.title)) / 2
+	sb.WriteString("║" + padRight(strings.Repeat(" ", left)+t.title, width) + "║\n")
+
+	for _, section := range t.sections {
+		if len(section) == 0 {
+			continue
+		}
+		sb.WriteString("╠" + border + "╣\n")
+		for _, line := range section {
+			sb.WriteString("║" + padRight("  "+line, width) + "║\n")
+		}
+	}
+
+	sb.WriteString("╚" + border + "╝\n")
+	return sb.String()
+}
+
+// padRight pads s with spaces to the given display width
+func padRight(s string, width int) string {
+	if pad := width - displayWidth(s); pad > 0 {
+		return s + strings.Repeat(" ", pad)
+	}
+	return s
+}
+
+// displayWidth returns the number of terminal columns a string occupies
+func displayWidth(s string) int {
+	width := 0
+	prev := 0
+	for _, r := range s {
+		w := runeWidth(r)
+		// VS16 turns the preceding character into a wide emoji (e.g. ⚠️)
+		if r == 0xFE0F && prev == 1 {
+			w = 1
+		}
+		width += w
+		if w > 0 {
+			prev = w
+		}
+	}
+	return width
+}
+
+// runeWidth returns the display width of a single rune
+func runeWidth(r rune) int {
+	switch {
+	case r == 0 || r == 0x200B || r == 0x200D || r == 0xFE0F || r == 0xFE0E:
+		return 0
+	case unicode.Is(unicode.Mn, r) || unicode.Is(unicode.Me, r) || unicode.Is(unicode.Cf, r):
+		return 0
+	case isWide(r):
+		return 2
+	}
+	return 1
+}
+
+// isWide reports whether r is an East Asian wide/fullwidth character or an emoji
+func isWide(r rune) bool {
+	return (r >= 0x1100 && r <= 0x115F) || // Hangul Jamo
+		(r >= 0x2E80 && r <= 0x303E) || // CJK radicals, punctuation
+		(r >= 0x3041 && r <= 0x33FF) || // Hiragana, Katakana, CJK symbols
+		(r >= 0x3400 && r <= 0x4DBF) || // CJK Extension A
+		(r >= 0x4E00 && r <= 0x9FFF) || // CJK Unified Ideographs
+		(r >= 0xA000 && r <= 0xA4CF) || // Yi
+		(r >= 0xAC00 && r <= 0xD7A3) || // Hangul syllables
+		(r >= 0xF900 && r <= 0xFAFF) || // CJK compatibility ideographs
+		(r >= 0xFE30 && r <= 0xFE4F) || // CJK compatibility forms
+		(r >= 0xFF00 && r <= 0xFF60) || // Fullwidth forms
+		(r >= 0xFFE0 && r <= 0xFFE6) ||
+		(r >= 0x1F300 && r <= 0x1F64F) || // Symbols, pictographs, emoticons
+		(r >= 0x1F680 && r <= 0x1F6FF) || // Transport and map symbols
+		(r >= 0x1F900 && r <= 0x1FAFF) || // Supplemental symbols and pictographs
+		(r >= 0x20000 && r <= 0x3FFFD) || // CJK Extension B and beyond
+		r == 0x231A || r == 0x231B || r == 0x23F0 || r == 0x23F3 ||
+		(r >= 0x25FD && r <= 0x25FE) ||
+		(r >= 0x2614 && r <= 0x2615) ||
+		r == 0x26A1 || r == 0x26D4 || r == 0x2705 || r == 0x274C ||
+		(r >= 0x2753 && r <= 0x2755) || r == 0x2757 ||
+		(r >= 0x2795 && r <= 0x2797) || r == 0x2B50 || r == 0x2B55
+}
@@ -0,0 +1,73 @@
+package plugin
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDisplayWidth(t *testing.T) {
+	tests := []struct {
+		input string
+		want  int
+	}{
+		{"abc", 3},
+		{"执行统计", 8},
+		{"📊 Stats", 8},
+		{"⚠️ x", 4},
+		{"é", 1}, // combining accent
+		{"", 0},
+	}
+
+	for _, tt := range tests {
+		if got := displayWidth(tt.input); got != tt.want {
+			t.Errorf("displayWidth(%q) = %d, want %d", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestFormatStatsAlignment(t *testing.T) {
+	stats := &CLIStats{
+		Models: map[string]ModelStats{
+			"gemini-2.5-pro": {
+				API:    APIStats{TotalRequests: 2, TotalLatencyMs: 5000},
+				Tokens: TokenStats{Prompt: 1000, Candidates: 500, Total: 1500, Cached: 200, Thoughts: 100, Tool: 50},
+			},
+		},
+		Tools: ToolStats{
+			TotalCalls:   1,
+			TotalSuccess: 1,
+			ByName:       map[string]ToolDetail{"run_shell_command": {Count: 1, DurationMs: 900}},
+		},
+		Files: FileStats{TotalLinesAdded: 10, TotalLinesRemoved: 5},
+	}
+
+	for _, locale := range Locales() {
+		t.Run(locale, func(t *testing.T) {
+			formatted := strings.TrimSpace(FormatStatsLocalized(stats, locale))
+			lines := strings.Split(formatted, "\n")
+			want := displayWidth(lines[0])
+			for i, line := range lines {
+				if got := displayWidth(line); got != want {
+					t.Errorf("line %d has width %d, want %d: %q", i, got, want, line)
+				}
+			}
+		})
+	}
+
+	if !strings.Contains(FormatStatsLocalized(stats, "zh-CN"), "执行统计") {
+		t.Error("zh-CN should use the Chinese catalog")
+	}
+	if !strings.Contains(FormatStats(stats), "Execution Statistics") {
+		t.Error("FormatStats should default to English")
+	}
+}
+
+func TestCatalogsComplete(t *testing.T) {
+	for locale, catalog := range catalogs {
+		for key := range catalogs[LocaleEnglish] {
+			if _, ok := catalog[key]; !ok {
+				t.Errorf("locale %s is missing message %q", locale, key)
+			}
+		}
+	}
+}
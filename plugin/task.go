@@ -0,0 +1,130 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Built-in task names
+const (
+	TaskReview        = "review"
+	TaskSecurityAudit = "security-audit"
+	TaskReleaseNotes  = "release-notes"
+	TaskTestGen       = "test-gen"
+	TaskCommitLint    = "commit-lint"
+)
+
+// TaskPreset is a curated prompt together with the git context it needs
+type TaskPreset struct {
+	Name   string
+	Prompt string
+
+	// BuildContext collects the task-specific context passed via stdin
+	BuildContext func(g *GitAnalyzer, sha string) (string, error)
+}
+
+// TaskPresets contains all built-in tasks
+var TaskPresets = map[string]TaskPreset{
+	TaskReview: {
+		Name: "Code Review",
+		Prompt: `You are a senior software engineer reviewing the commit below.
+Check for:
+1. Correctness: logic errors, unhandled edge cases, broken error handling
+2. Security: injection, unsafe input handling, sensitive data exposure
+3. Performance: unnecessary work, allocations in hot paths, missing caching
+4. Maintainability: naming, duplication, readability, missing tests
+
+Report each finding on its own line with its file and line, starting with a
+severity level: "CRITICAL:", "WARNING:" or "INFO:". Finish with a one-paragraph summary.`,
+		BuildContext: func(g *GitAnalyzer, sha string) (string, error) {
+			return g.BuildGitContext(sha)
+		},
+	},
+	TaskSecurityAudit: {
+		Name: "Security Audit",
+		Prompt: `You are an application security engineer auditing the commit below.
+Look for:
+- Injection (SQL, command, template, path traversal)
+- Cross-site scripting and unsafe output encoding
+- Authentication and authorization flaws
+- Hardcoded secrets, tokens or credentials
+- Insecure cryptography and randomness
+- Unsafe deserialization and SSRF
+- Vulnerable dependency changes
+
+Start each finding on its own line with a severity ("CRITICAL:", "WARNING:" or
+"INFO:"), then give the file and line, the attack scenario and a concrete fix.
+If nothing is found, say so explicitly.`,
+		BuildContext: func(g *GitAnalyzer, sha string) (string, error) {
+			return g.BuildGitContext(sha)
+		},
+	},
+	TaskReleaseNotes: {
+		Name: "Release Notes",
+		Prompt: `Write release notes in Markdown CHANGELOG format from the release log below.
+Start with a "## <version>" heading using the "To" tag when present. The log is
+already grouped by conventional-commit type; keep the groups, list "Breaking
+Changes" first and omit empty groups. Write one concise, user-facing line per
+change, reference the pull request number when present and credit the author.
+End with the list of contributors. Output only the release notes.`,
+		BuildContext: func(g *GitAnalyzer, sha string) (string, error) {
+			return g.BuildReleaseContext(sha)
+		},
+	},
+	TaskTestGen: {
+		Name: "Test Generation",
+		Prompt: `Write unit tests for the changed functions below.
+Follow the existing test conventions of the repository (framework, file layout,
+naming, table-driven style where used). Cover the normal path, edge cases and
+error paths. Output only the test code, grouped by target test file.`,
+		BuildContext: func(g *GitAnalyzer, sha string) (string, error) {
+			return g.BuildChangedFunctionsContext(sha)
+		},
+	},
+	TaskCommitLint: {
+		Name: "Commit Lint",
+		Prompt: `Check the commit messages below against the Conventional Commits specification
+(type(scope)!: subject). Verify the type is one of feat, fix, docs, style,
+refactor, perf, test, build, ci, chore or revert, the subject is imperative and
+under 72 characters, and the body explains why. For each commit report PASS or
+FAIL with the reasons and suggest a corrected message.`,
+		BuildContext: func(g *GitAnalyzer, sha string) (string, error) {
+			return g.BuildCommitMessagesContext(sha, commitLintBase(g))
+		},
+	},
+}
+
+// LookupTask returns the preset for a task name
+func LookupTask(name string) (TaskPreset, error) {
+	preset, ok := TaskPresets[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return TaskPreset{}, fmt.Errorf("%w: %q%s (available: %s)", ErrUnknownTask, name, suggestion(name, TaskNames()), strings.Join(TaskNames(), ", "))
+	}
+	return preset, nil
+}
+
+// TaskNames returns the sorted names of all built-in tasks
+func TaskNames() []string {
+	names := make([]string, 0, len(TaskPresets))
+	for name := range TaskPresets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// commitLintBase returns the commit before the pushed range, so every commit
+// of a multi-commit push is linted. Empty means lint only the current commit.
+func commitLintBase(g *GitAnalyzer) string {
+	before := os.Getenv("DRONE_COMMIT_BEFORE")
+	if before == "" || strings.Trim(before, "0") == "" {
+		return ""
+	}
+	// The before commit may not exist in a shallow clone
+	if _, err := g.runGitCommand("cat-file", "-e", before+"^{commit}"); err != nil {
+		return ""
+	}
+	return before
+}
@@ -0,0 +1,121 @@
+package plugin
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newTestRepo creates a temporary git repository with a committer identity
+func newTestRepo(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+
+	dir := t.TempDir()
+	runGit(t, dir, "init", "-q", "-b", "main")
+	runGit(t, dir, "config", "user.name", "Test User")
+	runGit(t, dir, "config", "user.email", "test@example.com")
+	runGit(t, dir, "config", "commit.gpgsign", "false")
+	return dir
+}
+
+// runGit runs a git command in dir and fails the test on error
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s failed: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+// commitFile writes a file and commits it with the given message
+func commitFile(t *testing.T, dir, name, content, message string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	runGit(t, dir, "add", name)
+	runGit(t, dir, "commit", "-q", "-m", message)
+	return runGit(t, dir, "rev-parse", "HEAD")
+}
+
+func TestLookupTask(t *testing.T) {
+	for _, name := range []string{TaskReview, TaskSecurityAudit, TaskReleaseNotes, TaskTestGen, TaskCommitLint} {
+		preset, err := LookupTask(name)
+		if err != nil {
+			t.Errorf("LookupTask(%q) unexpected error: %v", name, err)
+			continue
+		}
+		if preset.Prompt == "" || preset.BuildContext == nil {
+			t.Errorf("LookupTask(%q) preset is incomplete", name)
+		}
+	}
+
+	if _, err := LookupTask("reveiw"); !errors.Is(err, ErrUnknownTask) {
+		t.Errorf("LookupTask(unknown) error = %v, want ErrUnknownTask", err)
+	}
+}
+
+func TestTaskContexts(t *testing.T) {
+	t.Setenv("DRONE_TAG", "")
+
+	dir := newTestRepo(t)
+	commitFile(t, dir, "calc.go", "package calc\n\nfunc Add(a, b int) int {\n\treturn a + b\n}\n", "feat: add calculator")
+	runGit(t, dir, "tag", "v1.0.0")
+	commitFile(t, dir, "calc.go", "package calc\n\nfunc Add(a, b int) int {\n\tsum := a + b\n\treturn sum\n}\n", "refactor: name the sum\n\nMakes debugging easier.")
+	sha := commitFile(t, dir, "README.md", "# calc\n", "docs: add readme")
+
+	analyzer := NewGitAnalyzer(dir, false)
+
+	t.Run("release-notes", func(t *testing.T) {
+		ctx, err := TaskPresets[TaskReleaseNotes].BuildContext(analyzer, sha)
+		if err != nil {
+			t.Fatalf("BuildContext() error: %v", err)
+		}
+		for _, want := range []string{"From: v1.0.0", "refactor: name the sum", "docs: add readme"} {
+			if !strings.Contains(ctx, want) {
+				t.Errorf("release context missing %q:\n%s", want, ctx)
+			}
+		}
+		if strings.Contains(ctx, "feat: add calculator") {
+			t.Errorf("release context should not include commits before the previous tag:\n%s", ctx)
+		}
+	})
+
+	t.Run("commit-lint", func(t *testing.T) {
+		t.Setenv("DRONE_COMMIT_BEFORE", "")
+		ctx, err := TaskPresets[TaskCommitLint].BuildContext(analyzer, sha)
+		if err != nil {
+			t.Fatalf("BuildContext() error: %v", err)
+		}
+		if !strings.Contains(ctx, "docs: add readme") {
+			t.Errorf("commit-lint context missing commit message:\n%s", ctx)
+		}
+		if strings.Contains(ctx, "diff --git") {
+			t.Errorf("commit-lint context should contain only messages:\n%s", ctx)
+		}
+	})
+
+	t.Run("test-gen", func(t *testing.T) {
+		refactor := runGit(t, dir, "rev-parse", "HEAD~1")
+		ctx, err := TaskPresets[TaskTestGen].BuildContext(analyzer, refactor)
+		if err != nil {
+			t.Fatalf("BuildContext() error: %v", err)
+		}
+		if !strings.Contains(ctx, "calc.go:") || !strings.Contains(ctx, "func Add(a, b int) int") {
+			t.Errorf("test-gen context missing changed function:\n%s", ctx)
+		}
+	})
+}
@@ -0,0 +1,199 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// tracerName is the instrumentation scope of the plugin's spans
+const tracerName = "github.com/JimmaaBinyamin/drone-gemini-cli-plugin"
+
+// traceShutdownTimeout bounds flushing spans at the end of a run
+const traceShutdownTimeout = 5 * time.Second
+
+// TracingEnabled reports whether spans should be exported, either to TraceEndpoint
+// or to the standard OTEL_EXPORTER_OTLP_* endpoint
+func TracingEnabled(cfg *Config) bool {
+	return cfg.TraceEndpoint != "" ||
+		os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" ||
+		os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// NewTracerProvider creates a tracer provider that exports spans over OTLP/HTTP.
+// It returns a no-op provider when tracing is not configured. The returned
+// shutdown function flushes pending spans.
+func NewTracerProvider(cfg *Config) (trace.TracerProvider, func(context.Context) error, error) {
+	if !TracingEnabled(cfg) {
+		return noop.NewTracerProvider(), func(context.Context) error { return nil }, nil
+	}
+
+	var opts []otlptracehttp.Option
+	if cfg.TraceEndpoint != "" {
+		opts = append(opts, otlptracehttp.WithEndpointURL(cfg.TraceEndpoint))
+	}
+	if cfg.TraceHeaders != "" {
+		headers, err := parseTraceHeaders(cfg.TraceHeaders)
+		if err != nil {
+			return nil, nil, err
+		}
+		opts = append(opts, otlptracehttp.WithHeaders(headers))
+	}
+
+	exporter, err := otlptracehttp.New(context.Background(), opts...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create OTLP exporter: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(traceResource(cfg)),
+	)
+	return provider, provider.Shutdown, nil
+}
+
+// traceResource describes the plugin and the Drone build it runs in
+func traceResource(cfg *Config) *resource.Resource {
+	attrs := []attribute.KeyValue{attribute.String("service.name", cfg.TraceServiceName)}
+	for _, env := range []struct{ key, name string }{
+		{"drone.repo", "DRONE_REPO"},
+		{"drone.branch", "DRONE_BRANCH"},
+		{"drone.build.event", "DRONE_BUILD_EVENT"},
+		{"drone.build.number", "DRONE_BUILD_NUMBER"},
+		{"drone.commit.sha", "DRONE_COMMIT_SHA"},
+	} {
+		if value := os.Getenv(env.name); value != "" {
+			attrs = append(attrs, attribute.String(env.key, value))
+		}
+	}
+	return resource.NewSchemaless(attrs...)
+}
+
+// parseTraceHeaders parses comma-separated key=value pairs
+func parseTraceHeaders(value string) (map[string]string, error) {
+	headers := map[string]string{}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, val, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(key) == "" {
+			return nil, fmt.Errorf("invalid trace_headers entry %q: expected key=value", pair)
+		}
+		headers[strings.TrimSpace(key)] = strings.TrimSpace(val)
+	}
+	return headers, nil
+}
+
+// startSpan starts a child span of the span in ctx, using the same tracer provider.
+// Without a span in ctx the span is a no-op.
+func startSpan(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	tracer := trace.SpanFromContext(ctx).TracerProvider().Tracer(tracerName)
+	return tracer.Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// endSpan records err on the span, if any, and ends it
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// recordToolSpans creates a span for each tool call in a stream-json run, timed
+// by the tool_use and tool_result event timestamps
+func recordToolSpans(ctx context.Context, events []StreamEvent) {
+	tracer := trace.SpanFromContext(ctx).TracerProvider().Tracer(tracerName)
+	pending := map[string]StreamEvent{}
+
+	for _, event := range events {
+		switch event.Type {
+		case "tool_use":
+			pending[event.ToolID] = event
+		case "tool_result":
+			use, ok := pending[event.ToolID]
+			if !ok {
+				continue
+			}
+			delete(pending, event.ToolID)
+
+			startOpts := []trace.SpanStartOption{trace.WithAttributes(
+				attribute.String("tool.name", use.ToolName),
+				attribute.String("tool.id", use.ToolID),
+				attribute.String("tool.status", event.Status),
+			)}
+			var endOpts []trace.SpanEndOption
+			if start, end, ok := eventTimes(use, event); ok {
+				startOpts = append(startOpts, trace.WithTimestamp(start))
+				endOpts = append(endOpts, trace.WithTimestamp(end))
+			}
+
+			_, span := tracer.Start(ctx, "tool "+use.ToolName, startOpts...)
+			if event.Status != "" && event.Status != "success" {
+				span.SetStatus(codes.Error, truncateString(event.Output, 200))
+			}
+			span.End(endOpts...)
+		}
+	}
+
+	// Calls without a result were still running when the CLI exited
+	for _, use := range pending {
+		_, span := tracer.Start(ctx, "tool "+use.ToolName, trace.WithAttributes(
+			attribute.String("tool.name", use.ToolName),
+			attribute.String("tool.id", use.ToolID),
+		))
+		span.SetStatus(codes.Error, "no tool_result event")
+		span.End()
+	}
+}
+
+// eventTimes parses the timestamps of a tool_use and its tool_result
+func eventTimes(use, result StreamEvent) (time.Time, time.Time, bool) {
+	start, err := time.Parse(time.RFC3339Nano, use.Timestamp)
+	if err != nil {
+		return time.Time{}, time.Time{}, false
+	}
+	end, err := time.Parse(time.RFC3339Nano, result.Timestamp)
+	if err != nil || end.Before(start) {
+		return time.Time{}, time.Time{}, false
+	}
+	return start, end, true
+}
+
+// resultAttributes describes the outcome of a CLI run on its span
+func resultAttributes(result *ExecutionResult) []attribute.KeyValue {
+	if result == nil {
+		return nil
+	}
+	attrs := []attribute.KeyValue{
+		attribute.Int("gemini.exit_code", result.ExitCode),
+		attribute.Bool("gemini.cached", result.Cached),
+	}
+	if result.Response == nil || result.Response.Stats == nil {
+		return attrs
+	}
+
+	var input, output, tools int
+	for _, stats := range result.Response.Stats.Models {
+		input += stats.Tokens.Prompt
+		output += stats.Tokens.Candidates
+	}
+	tools = result.Response.Stats.Tools.TotalCalls
+	return append(attrs,
+		attribute.Int("gemini.tokens.input", input),
+		attribute.Int("gemini.tokens.output", output),
+		attribute.Int("gemini.tool_calls", tools),
+	)
+}
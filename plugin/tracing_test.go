@@ -0,0 +1,119 @@
+package plugin
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestExecSpans(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+
+	replay, err := filepath.Abs(filepath.Join("testdata", "replay", "stream-tools.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := New(Config{
+		Prompt:       "Summarize this project",
+		Target:       t.TempDir(),
+		Model:        "gemini-2.5-pro",
+		OutputFormat: "stream-json",
+		ReplayFile:   replay,
+		Timeout:      60,
+	})
+	p.tracerProvider = provider
+
+	if err := p.Exec(context.Background()); err != nil {
+		t.Fatalf("Exec() error: %v", err)
+	}
+
+	spans := map[string]tracetest.SpanStub{}
+	for _, span := range exporter.GetSpans() {
+		spans[span.Name] = span
+	}
+
+	root, ok := spans["plugin.exec"]
+	if !ok {
+		t.Fatalf("missing root span, got %v", spanNames(exporter.GetSpans()))
+	}
+	for _, name := range []string{"config.load", "cli.replay", "report"} {
+		span, ok := spans[name]
+		if !ok {
+			t.Errorf("missing span %q, got %v", name, spanNames(exporter.GetSpans()))
+			continue
+		}
+		if span.Parent.SpanID() != root.SpanContext.SpanID() {
+			t.Errorf("span %q is not a child of plugin.exec", name)
+		}
+	}
+
+	tool, ok := spans["tool list_directory"]
+	if !ok {
+		t.Fatalf("missing tool span, got %v", spanNames(exporter.GetSpans()))
+	}
+	if tool.Parent.SpanID() != spans["cli.replay"].SpanContext.SpanID() {
+		t.Error("tool span is not a child of cli.replay")
+	}
+	// Timed by the tool_use and tool_result events
+	if got := tool.EndTime.Sub(tool.StartTime).Seconds(); got != 1 {
+		t.Errorf("tool span duration = %vs, want 1s", got)
+	}
+}
+
+func spanNames(spans tracetest.SpanStubs) []string {
+	names := make([]string, 0, len(spans))
+	for _, span := range spans {
+		names = append(names, span.Name)
+	}
+	return names
+}
+
+func TestNewTracerProviderOTLP(t *testing.T) {
+	var path, auth string
+	var size int
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		path, auth, size = r.URL.Path, r.Header.Get("Authorization"), len(body)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer collector.Close()
+
+	provider, shutdown, err := NewTracerProvider(&Config{
+		TraceEndpoint:    collector.URL,
+		TraceHeaders:     "Authorization=Bearer token",
+		TraceServiceName: "test",
+	})
+	if err != nil {
+		t.Fatalf("NewTracerProvider() error: %v", err)
+	}
+
+	_, span := provider.Tracer(tracerName).Start(context.Background(), "plugin.exec")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("shutdown error: %v", err)
+	}
+
+	if path != "/v1/traces" || auth != "Bearer token" || size == 0 {
+		t.Errorf("collector got path %q, auth %q, %d bytes", path, auth, size)
+	}
+}
+
+func TestParseTraceHeaders(t *testing.T) {
+	headers, err := parseTraceHeaders("x-api-key=abc, x-team = ai ,")
+	if err != nil {
+		t.Fatalf("parseTraceHeaders() error: %v", err)
+	}
+	if headers["x-api-key"] != "abc" || headers["x-team"] != "ai" || len(headers) != 2 {
+		t.Errorf("parseTraceHeaders() = %v", headers)
+	}
+	if _, err := parseTraceHeaders("novalue"); err == nil {
+		t.Error("parseTraceHeaders(novalue) should fail")
+	}
+}
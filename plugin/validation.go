@@ -0,0 +1,156 @@
+package plugin
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// Valid values of enum settings
+var (
+	OutputFormats = []string{"text", "json", "stream-json"}
+	ApprovalModes = []string{"default", "auto_edit", "yolo"}
+	BudgetActions = []string{BudgetActionFail, BudgetActionWarn}
+
+	// FailOnSeverities are ordered from most to least severe
+	FailOnSeverities = []string{"critical", "warning", "info"}
+)
+
+// maxModelSuggestionDistance is how close an unknown model name must be to a
+// priced model to be suggested as a possible typo
+const maxModelSuggestionDistance = 2
+
+// ValidationError collects every problem found in a configuration
+type ValidationError struct {
+	Problems []error
+}
+
+// Error lists all problems, one per line
+func (e *ValidationError) Error() string {
+	if len(e.Problems) == 1 {
+		return fmt.Sprintf("%v: %v", ErrInvalidConfig, e.Problems[0])
+	}
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("%v: %d problems", ErrInvalidConfig, len(e.Problems)))
+	for _, problem := range e.Problems {
+		sb.WriteString("\n  - ")
+		sb.WriteString(problem.Error())
+	}
+	return sb.String()
+}
+
+// Unwrap exposes ErrInvalidConfig and the individual problems to errors.Is
+func (e *ValidationError) Unwrap() []error {
+	return append([]error{ErrInvalidConfig}, e.Problems...)
+}
+
+// validator accumulates problems while checking a configuration
+type validator struct {
+	problems []error
+}
+
+// add records a problem
+func (v *validator) add(err error) {
+	v.problems = append(v.problems, err)
+}
+
+// addf records a formatted problem
+func (v *validator) addf(format string, args ...interface{}) {
+	v.add(fmt.Errorf(format, args...))
+}
+
+// enum checks that a setting is empty or one of the valid values
+func (v *validator) enum(setting, value string, valid []string) {
+	if value == "" {
+		return
+	}
+	for _, candidate := range valid {
+		if value == candidate {
+			return
+		}
+	}
+	v.addf("%s %q is not valid%s (valid: %s)", setting, value, suggestion(value, valid), strings.Join(valid, ", "))
+}
+
+// err returns the collected problems as a ValidationError, or nil
+func (v *validator) err() error {
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: v.problems}
+}
+
+// suggestion returns `; did you mean "x"?` for the closest valid value, or ""
+// when no value is close enough to be a likely typo
+func suggestion(value string, valid []string) string {
+	if match, ok := closestMatch(value, valid, 1+len(value)/3); ok {
+		return fmt.Sprintf("; did you mean %q?", match)
+	}
+	return ""
+}
+
+// closestMatch returns the candidate with the smallest edit distance to value,
+// if that distance is at most maxDistance
+func closestMatch(value string, candidates []string, maxDistance int) (string, bool) {
+	value = strings.ToLower(value)
+	best, bestDistance := "", maxDistance+1
+	for _, candidate := range candidates {
+		if d := levenshtein(value, strings.ToLower(candidate)); d < bestDistance {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best, best != ""
+}
+
+// levenshtein returns the edit distance between two strings
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(rb)]
+}
+
+// suggestModel returns the priced model one or two edits away from an unpriced
+// model name, so a likely typo can be pointed out. It is only a hint: new models
+// are not priced yet and must still run.
+func suggestModel(model string) (string, bool) {
+	return closestMatch(model, sortedKeys(PricingTable), maxModelSuggestionDistance)
+}
+
+// validateAuth checks that the authentication settings form a usable combination
+func (v *validator) validateAuth(c *Config) {
+	if c.GCPProject != "" && c.APIKey == "" && c.GCPCredentials == "" {
+		v.addf("gcp_project %q is set without credentials: set api_key (Vertex AI API key) or gcp_credentials (service account)", c.GCPProject)
+	}
+	if c.GCPCredentials != "" && c.GCPProject == "" {
+		v.addf("gcp_credentials is set without gcp_project: Vertex AI needs a project, otherwise the credentials are ignored")
+	}
+}
+
+// validateTarget checks that the target directory exists
+func (v *validator) validateTarget(target string) {
+	if target == "" {
+		return
+	}
+	info, err := os.Stat(target)
+	switch {
+	case err != nil:
+		v.addf("target %q does not exist", target)
+	case !info.IsDir():
+		v.addf("target %q is not a directory", target)
+	}
+}
@@ -0,0 +1,233 @@
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// maxVerifyOutput bounds the verify_command output kept for the repair prompt and
+// the report. The end is kept, where test runners summarize failures.
+const maxVerifyOutput = 16 * 1024
+
+// verifyWaitDelay bounds the wait for the output of a verify_command that was killed
+const verifyWaitDelay = 2 * time.Second
+
+// VerifyResult is the outcome of one run of the verify_command
+type VerifyResult struct {
+	ExitCode   int    `json:"exit_code"`
+	TimedOut   bool   `json:"timed_out,omitempty"`
+	DurationMs int64  `json:"duration_ms"`
+	Output     string `json:"output"`
+	Truncated  bool   `json:"output_truncated,omitempty"`
+}
+
+// Passed reports whether the command succeeded
+func (r *VerifyResult) Passed() bool {
+	return r.ExitCode == 0 && !r.TimedOut
+}
+
+// Status describes the result, e.g. "failed (exit 1)"
+func (r *VerifyResult) Status(msg Catalog) string {
+	switch {
+	case r.TimedOut:
+		return msg.T("report.verify_timeout")
+	case r.ExitCode != 0:
+		return msg.T("report.verify_failed", r.ExitCode)
+	}
+	return msg.T("report.verify_passed")
+}
+
+// VerifyAttempt is one agent run followed by the verify_command. Attempt 1 is the
+// initial run, later attempts are repairs.
+type VerifyAttempt struct {
+	Attempt  int           `json:"attempt"`
+	Changes  *PatchSummary `json:"changes,omitempty"`
+	Patch    string        `json:"-"`
+	Response string        `json:"response,omitempty"` // the agent's answer to a repair prompt
+	Verify   *VerifyResult `json:"verify"`
+	Usage    BudgetUsage   `json:"usage"`
+}
+
+// Verification is the outcome of the verify and repair loop
+type Verification struct {
+	Command  string          `json:"command"`
+	Passed   bool            `json:"passed"`
+	Stopped  string          `json:"stopped,omitempty"` // why repairs ended before verification passed
+	Attempts []VerifyAttempt `json:"attempts"`
+}
+
+// VerifyEnv returns the environment of the verify_command: like the gemini CLI it
+// only gets the allowlisted variables and env_passthrough, and no authentication,
+// since it runs code the agent may just have edited
+func VerifyEnv(cfg *Config) []string {
+	allowed := append(append([]string(nil), baseEnvKeys...), splitList(cfg.EnvPassthrough)...)
+	return filterEnv(os.Environ(), allowed)
+}
+
+// RunVerifyCommand runs command with sh -c in dir and env and captures its combined
+// output. A non-zero exit code or a timeout is a failed verification, not an error.
+func RunVerifyCommand(ctx context.Context, dir, command string, env []string, timeout time.Duration) (*VerifyResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var output bytes.Buffer
+	cmd := exec.CommandContext(ctx, "sh", "-c", command)
+	cmd.Dir = dir
+	cmd.Env = env
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	// The command runs in its own process group so a timeout or cancellation also
+	// kills the processes it started, such as test binaries
+	setProcessGroup(cmd)
+	// Background processes that keep the output open must not block the step after a timeout
+	cmd.WaitDelay = verifyWaitDelay
+
+	start := time.Now()
+	err := cmd.Run()
+	// Stop processes the command left running in the background
+	killProcessGroup(cmd)
+	result := &VerifyResult{DurationMs: time.Since(start).Milliseconds()}
+	// A command that passed just as the timeout fired is not a timeout
+	result.TimedOut, _ = stopReason(ctx, err)
+	result.Output, result.Truncated = tailLines(output.String(), maxVerifyOutput)
+
+	if err != nil {
+		var exitErr *exec.ExitError
+		if !errors.As(err, &exitErr) {
+			return nil, fmt.Errorf("failed to run verify_command: %w", err)
+		}
+		result.ExitCode = exitErr.ExitCode()
+	}
+	return result, nil
+}
+
+// RepairPrompt asks the agent to fix what the verify_command reports. The original
+// prompt is repeated so the repair keeps its constraints; the command output is
+// passed on stdin.
+func RepairPrompt(prompt, command string, verify *VerifyResult) string {
+	outcome := fmt.Sprintf("failed with exit code %d", verify.ExitCode)
+	if verify.TimedOut {
+		outcome = "timed out"
+	}
+	return fmt.Sprintf(`Your changes were verified by running %q, which %s. Its output is provided on stdin.
+
+Fix the code so that the verification passes. Do not weaken, skip or delete tests to make them pass, and do not change how the verification is run.
+
+The original task was:
+
+%s`, command, outcome, strings.TrimSpace(prompt))
+}
+
+// tailLines keeps the last limit bytes of text, starting at a full line when possible
+func tailLines(text string, limit int) (string, bool) {
+	if len(text) <= limit {
+		return text, false
+	}
+	tail := text[len(text)-limit:]
+	if i := strings.Index(tail, "\n"); i >= 0 && i+1 < len(tail) {
+		tail = tail[i+1:]
+	}
+	return tail, true
+}
+
+// addUsage sums the usage of two runs
+func addUsage(a, b BudgetUsage) BudgetUsage {
+	return BudgetUsage{
+		Tokens:      a.Tokens + b.Tokens,
+		CostUSD:     a.CostUSD + b.CostUSD,
+		UnknownCost: a.UnknownCost || b.UnknownCost,
+	}
+}
+
+// resultStats returns the statistics of a result, or nil
+func resultStats(result *ExecutionResult) *CLIStats {
+	if result == nil || result.Response == nil {
+		return nil
+	}
+	return result.Response.Stats
+}
+
+// mergeResults combines a run with a later repair run so usage, budgets and the
+// ledger cover both. The first response is kept; the exit code is the latest one.
+func mergeResults(first, repair *ExecutionResult) *ExecutionResult {
+	merged := *first
+	merged.ExitCode = repair.ExitCode
+	merged.Cached = false
+	merged.Events = append(append([]StreamEvent(nil), first.Events...), repair.Events...)
+	if first.Response != nil {
+		response := *first.Response
+		response.Stats = mergeStats(resultStats(first), resultStats(repair))
+		merged.Response = &response
+	}
+	return &merged
+}
+
+// mergeStats sums the statistics of two runs
+func mergeStats(a, b *CLIStats) *CLIStats {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+
+	merged := &CLIStats{
+		Models: map[string]ModelStats{},
+		Tools:  a.Tools,
+		Files: FileStats{
+			TotalLinesAdded:   a.Files.TotalLinesAdded + b.Files.TotalLinesAdded,
+			TotalLinesRemoved: a.Files.TotalLinesRemoved + b.Files.TotalLinesRemoved,
+		},
+	}
+	for _, stats := range []*CLIStats{a, b} {
+		for name, m := range stats.Models {
+			sum := merged.Models[name]
+			sum.API.TotalRequests += m.API.TotalRequests
+			sum.API.TotalErrors += m.API.TotalErrors
+			sum.API.TotalLatencyMs += m.API.TotalLatencyMs
+			sum.Tokens.Prompt += m.Tokens.Prompt
+			sum.Tokens.Candidates += m.Tokens.Candidates
+			sum.Tokens.Total += m.Tokens.Total
+			sum.Tokens.Cached += m.Tokens.Cached
+			sum.Tokens.Thoughts += m.Tokens.Thoughts
+			sum.Tokens.Tool += m.Tokens.Tool
+			merged.Models[name] = sum
+		}
+	}
+
+	tools := &merged.Tools
+	tools.TotalCalls += b.Tools.TotalCalls
+	tools.TotalSuccess += b.Tools.TotalSuccess
+	tools.TotalFail += b.Tools.TotalFail
+	tools.TotalDurationMs += b.Tools.TotalDurationMs
+	tools.TotalDecisions = addDecisions(tools.TotalDecisions, b.Tools.TotalDecisions)
+	tools.ByName = map[string]ToolDetail{}
+	for _, byName := range []map[string]ToolDetail{a.Tools.ByName, b.Tools.ByName} {
+		for name, d := range byName {
+			sum := tools.ByName[name]
+			sum.Count += d.Count
+			sum.Success += d.Success
+			sum.Fail += d.Fail
+			sum.DurationMs += d.DurationMs
+			sum.Decisions = addDecisions(sum.Decisions, d.Decisions)
+			tools.ByName[name] = sum
+		}
+	}
+	return merged
+}
+
+// addDecisions sums tool decision counts
+func addDecisions(a, b ToolDecisions) ToolDecisions {
+	return ToolDecisions{
+		Accept:     a.Accept + b.Accept,
+		Reject:     a.Reject + b.Reject,
+		Modify:     a.Modify + b.Modify,
+		AutoAccept: a.AutoAccept + b.AutoAccept,
+	}
+}
@@ -0,0 +1,296 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunVerifyCommand(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name         string
+		command      string
+		timeout      time.Duration
+		wantPassed   bool
+		wantExitCode int
+		wantTimedOut bool
+		wantOutput   string
+	}{
+		{name: "passes", command: "echo ok", timeout: 10 * time.Second, wantPassed: true, wantOutput: "ok\n"},
+		{name: "fails with output", command: "echo FAIL: TestParse >&2; exit 3", timeout: 10 * time.Second, wantExitCode: 3, wantOutput: "FAIL: TestParse\n"},
+		{name: "times out", command: "sleep 5", timeout: 100 * time.Millisecond, wantExitCode: -1, wantTimedOut: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := RunVerifyCommand(context.Background(), dir, tt.command, os.Environ(), tt.timeout)
+			if err != nil {
+				t.Fatalf("RunVerifyCommand() error: %v", err)
+			}
+			if result.Passed() != tt.wantPassed || result.ExitCode != tt.wantExitCode || result.TimedOut != tt.wantTimedOut {
+				t.Errorf("RunVerifyCommand() = %+v", result)
+			}
+			if result.Output != tt.wantOutput {
+				t.Errorf("Output = %q, want %q", result.Output, tt.wantOutput)
+			}
+		})
+	}
+}
+
+func TestVerifyEnv(t *testing.T) {
+	t.Setenv("DRONE_NETRC_PASSWORD", "clone-token")
+	t.Setenv("PLUGIN_API_KEY", "AIza-secret")
+	t.Setenv("GEMINI_API_KEY", "AIza-secret")
+	t.Setenv("GOFLAGS", "-mod=mod")
+
+	env := VerifyEnv(&Config{EnvPassthrough: "GOFLAGS"})
+	result, err := RunVerifyCommand(context.Background(), t.TempDir(), "env", env, 10*time.Second)
+	if err != nil {
+		t.Fatalf("RunVerifyCommand() error: %v", err)
+	}
+	for _, leaked := range []string{"DRONE_NETRC_PASSWORD", "PLUGIN_API_KEY", "GEMINI_API_KEY"} {
+		if strings.Contains(result.Output, leaked+"=") {
+			t.Errorf("verify_command environment contains %s", leaked)
+		}
+	}
+	for _, want := range []string{"PATH=", "GOFLAGS=-mod=mod"} {
+		if !strings.Contains(result.Output, want) {
+			t.Errorf("verify_command environment is missing %s", want)
+		}
+	}
+}
+
+func TestRunVerifyCommandKillsProcessGroup(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("process groups are only used on Linux")
+	}
+	dir := t.TempDir()
+	pidFile := filepath.Join(dir, "pid")
+
+	// A test binary started in the background outlives sh unless the group is killed
+	command := "sleep 30 & echo $! > " + pidFile + "; wait"
+	result, err := RunVerifyCommand(context.Background(), dir, command, os.Environ(), 200*time.Millisecond)
+	if err != nil {
+		t.Fatalf("RunVerifyCommand() error: %v", err)
+	}
+	if !result.TimedOut {
+		t.Errorf("RunVerifyCommand() = %+v, want timed out", result)
+	}
+
+	data, err := os.ReadFile(pidFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stat := "/proc/" + strings.TrimSpace(string(data)) + "/stat"
+	deadline := time.Now().Add(2 * time.Second)
+	for processRunning(stat) {
+		if time.Now().After(deadline) {
+			t.Fatal("background process of verify_command is still running after the timeout")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// processRunning reports whether the process of a /proc stat file exists and is not a zombie
+func processRunning(stat string) bool {
+	data, err := os.ReadFile(stat)
+	if err != nil {
+		return false
+	}
+	// The state follows the parenthesised command name
+	fields := strings.Fields(string(data[strings.LastIndex(string(data), ")")+1:]))
+	return len(fields) > 0 && fields[0] != "Z"
+}
+
+func TestTailLines(t *testing.T) {
+	text := strings.Repeat("ok   pkg/a\n", 3000) + "--- FAIL: TestParse\nFAIL\n"
+	tail, truncated := tailLines(text, maxVerifyOutput)
+	if !truncated || len(tail) > maxVerifyOutput || !strings.HasPrefix(tail, "ok   pkg/a\n") || !strings.HasSuffix(tail, "FAIL\n") {
+		t.Errorf("tailLines() = %d bytes, truncated %v", len(tail), truncated)
+	}
+	if tail, truncated := tailLines("short\n", maxVerifyOutput); truncated || tail != "short\n" {
+		t.Errorf("tailLines() of short text = %q, %v", tail, truncated)
+	}
+}
+
+func TestMergeResults(t *testing.T) {
+	first := &ExecutionResult{ExitCode: 0, Response: &CLIResponse{Response: "fixed", Stats: &CLIStats{
+		Models: map[string]ModelStats{"gemini-2.5-pro": {API: APIStats{TotalRequests: 2}, Tokens: TokenStats{Prompt: 1000, Total: 1100}}},
+		Tools:  ToolStats{TotalCalls: 1, ByName: map[string]ToolDetail{"replace": {Count: 1}}},
+		Files:  FileStats{TotalLinesAdded: 5},
+	}}}
+	repair := &ExecutionResult{ExitCode: 1, Response: &CLIResponse{Response: "repaired", Stats: &CLIStats{
+		Models: map[string]ModelStats{
+			"gemini-2.5-pro":   {API: APIStats{TotalRequests: 1}, Tokens: TokenStats{Prompt: 500, Total: 600}},
+			"gemini-2.5-flash": {Tokens: TokenStats{Prompt: 10, Total: 12}},
+		},
+		Tools: ToolStats{TotalCalls: 2, ByName: map[string]ToolDetail{"replace": {Count: 1}, "run_shell_command": {Count: 1}}},
+		Files: FileStats{TotalLinesAdded: 1, TotalLinesRemoved: 1},
+	}}}
+
+	merged := mergeResults(first, repair)
+	stats := merged.Response.Stats
+	pro := stats.Models["gemini-2.5-pro"]
+	if merged.Response.Response != "fixed" || merged.ExitCode != 1 {
+		t.Errorf("merged response %q exit %d", merged.Response.Response, merged.ExitCode)
+	}
+	if pro.API.TotalRequests != 3 || pro.Tokens.Prompt != 1500 || pro.Tokens.Total != 1700 || len(stats.Models) != 2 {
+		t.Errorf("merged models = %+v", stats.Models)
+	}
+	if stats.Tools.TotalCalls != 3 || stats.Tools.ByName["replace"].Count != 2 || stats.Files.TotalLinesAdded != 6 {
+		t.Errorf("merged tools %+v, files %+v", stats.Tools, stats.Files)
+	}
+	if first.Response.Stats.Models["gemini-2.5-pro"].Tokens.Total != 1100 {
+		t.Error("mergeResults() modified the first result")
+	}
+}
+
+func TestReportVerification(t *testing.T) {
+	report := testReport()
+	report.Verification = &Verification{
+		Command: "go test ./...",
+		Passed:  true,
+		Attempts: []VerifyAttempt{
+			{
+				Attempt: 1,
+				Changes: &PatchSummary{Files: []PatchFileStat{{Path: "main.go", Status: "M", Added: 2, Removed: 1}}, Added: 2, Removed: 1},
+				Patch:   "diff --git a/main.go b/main.go\n",
+				Verify:  &VerifyResult{ExitCode: 1, Output: "--- FAIL: TestParse\n"},
+				Usage:   BudgetUsage{Tokens: 1100, CostUSD: 0.0125},
+			},
+			{
+				Attempt:  2,
+				Response: "Fixed the parser",
+				Verify:   &VerifyResult{Output: "ok\n"},
+				Usage:    BudgetUsage{Tokens: 600, CostUSD: 0.004},
+			},
+		},
+	}
+
+	for format, want := range map[string][]string{
+		ReportFormatPlain: {
+			"--- Verification: go test ./... ---",
+			"  Attempt 1: 1 files changed, +2 -1 · failed (exit 1) · $0.0125",
+			"  Attempt 2: - · passed · $0.0040",
+		},
+		ReportFormatMarkdown: {
+			"### Verification: `go test ./...`",
+			"| 1 | 1 files changed, +2 -1 | ❌ failed (exit 1) | $0.0125 |",
+			"| 2 | - | ✅ passed | $0.0040 |",
+			"<summary>Attempt 2</summary>\n\nFixed the parser\n",
+			"````text\n--- FAIL: TestParse\n````",
+		},
+		ReportFormatJSON: {`"verification": {`, `"passed": true`, `"exit_code": 1`},
+	} {
+		renderer, _ := NewReportRenderer(format)
+		var sb strings.Builder
+		if err := renderer.Render(&sb, report); err != nil {
+			t.Fatalf("%s Render() error: %v", format, err)
+		}
+		for _, s := range want {
+			if !strings.Contains(sb.String(), s) {
+				t.Errorf("%s report missing %q:\n%s", format, s, sb.String())
+			}
+		}
+	}
+}
+
+// installFakeGemini puts a gemini script on PATH that writes status.txt in the
+// working directory: "broken" on the first run and "fixed" on later runs
+func installFakeGemini(t *testing.T) {
+	t.Helper()
+	bin := t.TempDir()
+	counter := filepath.Join(bin, "runs")
+	script := `#!/bin/sh
+if [ "$1" = "--version" ]; then echo 0.0.0-test; exit 0; fi
+cat > /dev/null
+n=$(($(cat ` + counter + ` 2>/dev/null || echo 0) + 1))
+echo $n > ` + counter + `
+if [ $n -ge 2 ]; then echo fixed > status.txt; else echo broken > status.txt; fi
+echo '{"response": "run '$n'", "stats": {"models": {"gemini-2.5-pro": {"api": {"totalRequests": 1}, "tokens": {"prompt": 1000, "candidates": 100, "total": 1100}}}}}'
+`
+	if err := os.WriteFile(filepath.Join(bin, "gemini"), []byte(script), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", bin+string(os.PathListSeparator)+os.Getenv("PATH"))
+}
+
+func TestVerifyChanges(t *testing.T) {
+	tests := []struct {
+		name         string
+		maxRepairs   int
+		maxTokens    int
+		wantAttempts int
+		wantPassed   bool
+		wantStopped  string
+	}{
+		{name: "repaired", maxRepairs: 2, wantAttempts: 2, wantPassed: true},
+		{name: "no repairs", maxRepairs: 0, wantAttempts: 1, wantStopped: "no repairs left"},
+		{name: "budget", maxRepairs: 2, maxTokens: 2000, wantAttempts: 1, wantStopped: "would exceed max_tokens 2000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			installFakeGemini(t)
+			dir := newTestRepo(t)
+			commitFile(t, dir, "status.txt", "unknown\n", "status")
+
+			p := New(Config{
+				Target:           dir,
+				Prompt:           "Fix the status",
+				Model:            "gemini-2.5-pro",
+				OutputFormat:     "json",
+				Timeout:          30,
+				Yolo:             true,
+				MaxTokens:        tt.maxTokens,
+				BudgetAction:     BudgetActionFail,
+				VerifyCommand:    "echo checked > verify.log; grep -qx fixed status.txt",
+				VerifyMaxRepairs: tt.maxRepairs,
+				VerifyTimeout:    10,
+			})
+			snapshot, err := p.snapshotWorktree()
+			if err != nil {
+				t.Fatal(err)
+			}
+			result, err := p.execute(context.Background(), p.config.Prompt, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			combined, err := p.verifyChanges(context.Background(), snapshot, result, p.config.Prompt)
+			v := p.verification
+			if len(v.Attempts) != tt.wantAttempts || v.Passed != tt.wantPassed || !strings.Contains(v.Stopped, tt.wantStopped) {
+				t.Fatalf("verification = passed %v, %d attempts, stopped %q", v.Passed, len(v.Attempts), v.Stopped)
+			}
+			if tt.wantPassed != (err == nil) || (err != nil && !errors.Is(err, ErrVerifyFailed)) {
+				t.Errorf("verifyChanges() error = %v", err)
+			}
+
+			first := v.Attempts[0]
+			if first.Verify.ExitCode != 1 || first.Changes == nil || first.Changes.Files[0].Path != "status.txt" || first.Usage.Tokens != 1100 {
+				t.Errorf("attempt 1 = %+v", first)
+			}
+			if _, err := os.Stat(filepath.Join(dir, "verify.log")); !os.IsNotExist(err) {
+				t.Error("files written by verify_command should be reverted")
+			}
+			if !tt.wantPassed {
+				return
+			}
+
+			repair := v.Attempts[1]
+			if !repair.Verify.Passed() || repair.Response != "run 2" || !strings.Contains(repair.Patch, "+fixed") {
+				t.Errorf("attempt 2 = %+v", repair)
+			}
+			if total := combined.Response.Stats.Models["gemini-2.5-pro"].Tokens.Total; total != 2200 || combined.Response.Response != "run 1" {
+				t.Errorf("combined result: %d tokens, response %q", total, combined.Response.Response)
+			}
+		})
+	}
+}